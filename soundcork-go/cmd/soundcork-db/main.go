@@ -0,0 +1,76 @@
+// Command soundcork-db copies the soundcork data between the XML directory
+// tree and the SQLite database.
+//
+//	soundcork-db import -data data -db data/soundcork.db
+//	soundcork-db export -data data-rollback -db data/soundcork.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s import|export [-data DIR] [-db FILE]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "  import  copies the XML tree in DIR into the SQLite database FILE")
+	fmt.Fprintln(os.Stderr, "  export  writes the SQLite database FILE back to the XML tree in DIR")
+	fmt.Fprintln(os.Stderr)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	dataDir := fs.String("data", "data", "XML data directory")
+	dbPath := fs.String("db", "", "SQLite database (default DIR/soundcork.db)")
+	fs.Parse(os.Args[2:])
+
+	if *dbPath == "" {
+		*dbPath = filepath.Join(*dataDir, "soundcork.db")
+	}
+
+	switch cmd {
+	case "import":
+		if _, err := os.Stat(*dataDir); err != nil {
+			log.Fatalf("Cannot read data directory: %v", err)
+		}
+		db, err := datastore.NewSQLiteStore(*dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *dbPath, err)
+		}
+		defer db.Close()
+		if err := datastore.Copy(db, datastore.NewDataStore(*dataDir)); err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		log.Printf("Imported %s into %s", *dataDir, *dbPath)
+	case "export":
+		if _, err := os.Stat(*dbPath); err != nil {
+			log.Fatalf("Cannot read database: %v", err)
+		}
+		db, err := datastore.NewSQLiteStore(*dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *dbPath, err)
+		}
+		defer db.Close()
+		if err := datastore.Copy(datastore.NewDataStore(*dataDir), db); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Printf("Exported %s to %s", *dbPath, *dataDir)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
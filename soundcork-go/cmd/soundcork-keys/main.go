@@ -0,0 +1,107 @@
+// Command soundcork-keys manages the key that soundcork encrypts the
+// credentials of configured sources with (SOURCE_SECRET_KEY or
+// SOURCE_SECRET_KEY_FILE).
+//
+//	soundcork-keys generate > new.key
+//	soundcork-keys rotate -data data -old-key-file old.key -new-key-file new.key
+//	soundcork-keys rotate -backend sqlite -db data/soundcork.db -new-key-file new.key
+//
+// Stop soundcork before rotating, and start it with the new key afterwards.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/secrets"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s generate | rotate [-backend xml|sqlite] [-data DIR] [-db FILE] [-old-key-file FILE] [-new-key-file FILE]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "  generate  prints a new random key")
+	fmt.Fprintln(os.Stderr, "  rotate    re-encrypts all source secrets from the old key to the new one;")
+	fmt.Fprintln(os.Stderr, "            without -old-key-file they are read as plaintext,")
+	fmt.Fprintln(os.Stderr, "            without -new-key-file they are written as plaintext")
+	fmt.Fprintln(os.Stderr)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	backend := fs.String("backend", "xml", "datastore backend, xml or sqlite")
+	dataDir := fs.String("data", "data", "XML data directory")
+	dbPath := fs.String("db", "", "SQLite database (default DIR/soundcork.db)")
+	oldKeyFile := fs.String("old-key-file", "", "file with the current key")
+	newKeyFile := fs.String("new-key-file", "", "file with the new key")
+	fs.Parse(os.Args[2:])
+
+	switch cmd {
+	case "generate":
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Println(key)
+	case "rotate":
+		oldBox, err := secrets.LoadBox("", *oldKeyFile)
+		if err != nil {
+			log.Fatalf("Invalid old key: %v", err)
+		}
+		newBox, err := secrets.LoadBox("", *newKeyFile)
+		if err != nil {
+			log.Fatalf("Invalid new key: %v", err)
+		}
+
+		var s datastore.Store
+		switch *backend {
+		case "xml":
+			if _, err := os.Stat(*dataDir); err != nil {
+				log.Fatalf("Cannot read data directory: %v", err)
+			}
+			s = datastore.NewDataStore(*dataDir)
+		case "sqlite":
+			if *dbPath == "" {
+				*dbPath = filepath.Join(*dataDir, "soundcork.db")
+			}
+			if _, err := os.Stat(*dbPath); err != nil {
+				log.Fatalf("Cannot read database: %v", err)
+			}
+			db, err := datastore.NewSQLiteStore(*dbPath)
+			if err != nil {
+				log.Fatalf("Failed to open %s: %v", *dbPath, err)
+			}
+			defer db.Close()
+			s = db
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+		s.SetSecretBox(newBox)
+
+		n, err := datastore.RotateSecrets(s, oldBox)
+		if err != nil {
+			log.Fatalf("Rotation failed after %d accounts: %v", n, err)
+		}
+		if newBox != nil {
+			log.Printf("Encrypted the source secrets of %d accounts with key %s", n, newBox.KeyID())
+		} else {
+			log.Printf("Decrypted the source secrets of %d accounts", n)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,277 @@
+// Package auth protects the management API with passwords, session cookies
+// for the management page and API tokens for scripts.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/atomicfile"
+)
+
+// Role is what a user or token may do.
+type Role string
+
+const (
+	// RoleAdmin may use the whole management API.
+	RoleAdmin Role = "admin"
+	// RoleReadOnly may view devices, events and settings but not change
+	// anything, migrate speakers or take backups.
+	RoleReadOnly Role = "read-only"
+)
+
+const (
+	// SessionCookie is the name of the cookie holding the session ID.
+	SessionCookie = "soundcork_session"
+	// SessionTTL is how long a login lasts.
+	SessionTTL = 12 * time.Hour
+	// tokenPrefix marks API tokens, which makes them easy to find in scripts
+	// and logs.
+	tokenPrefix = "sct_"
+)
+
+// ErrInvalidCredentials is returned by Login for an unknown password.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Config holds the credentials set by the administrator. Authentication is
+// enabled if an admin password or token is set.
+type Config struct {
+	AdminPassword    string
+	ReadOnlyPassword string
+	// AdminToken is accepted as API token with the admin role, e.g. to
+	// provision API tokens from scripts.
+	AdminToken string
+}
+
+// APIToken is a token created for a script. Only a hash of the token is
+// kept.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed,omitzero"`
+}
+
+type session struct {
+	role    Role
+	expires time.Time
+}
+
+// Manager checks credentials and keeps the sessions in memory and the API
+// tokens in a file.
+type Manager struct {
+	cfg  Config
+	path string
+
+	mu       sync.Mutex
+	sessions map[string]session
+	tokens   []APIToken
+}
+
+// NewManager creates a manager for cfg. If path is set, API tokens are loaded
+// from and saved to that file.
+func NewManager(cfg Config, path string) (*Manager, error) {
+	m := &Manager{cfg: cfg, path: path, sessions: make(map[string]session)}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m.tokens); err != nil {
+		return m, fmt.Errorf("malformed API tokens at %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Enabled reports whether credentials are configured. Without them, the
+// management API is open.
+func (m *Manager) Enabled() bool {
+	return m.cfg.AdminPassword != "" || m.cfg.AdminToken != ""
+}
+
+// Login checks password and starts a session with its role.
+func (m *Manager) Login(password string) (string, Role, error) {
+	var role Role
+	switch {
+	case equal(password, m.cfg.AdminPassword):
+		role = RoleAdmin
+	case equal(password, m.cfg.ReadOnlyPassword):
+		role = RoleReadOnly
+	default:
+		return "", "", ErrInvalidCredentials
+	}
+
+	id, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for sid, s := range m.sessions {
+		if now.After(s.expires) {
+			delete(m.sessions, sid)
+		}
+	}
+	m.sessions[id] = session{role: role, expires: now.Add(SessionTTL)}
+	return id, role, nil
+}
+
+// Logout ends a session.
+func (m *Manager) Logout(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
+
+// Authenticate returns the role of the session cookie or API token of r.
+func (m *Manager) Authenticate(r *http.Request) (Role, bool) {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		m.mu.Lock()
+		s, ok := m.sessions[c.Value]
+		m.mu.Unlock()
+		if ok && time.Now().Before(s.expires) {
+			return s.role, true
+		}
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	if equal(token, m.cfg.AdminToken) {
+		return RoleAdmin, true
+	}
+	return m.useToken(token)
+}
+
+func (m *Manager) useToken(token string) (Role, bool) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return "", false
+	}
+	hash := hashToken(token)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			// Not saved, the time of last use is only kept until the next change
+			m.tokens[i].LastUsed = time.Now()
+			return t.Role, true
+		}
+	}
+	return "", false
+}
+
+// CreateToken creates an API token with role. The token is only returned
+// here.
+func (m *Manager) CreateToken(name string, role Role) (string, *APIToken, error) {
+	if role != RoleAdmin && role != RoleReadOnly {
+		return "", nil, fmt.Errorf("unknown role %q", role)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+	token := tokenPrefix + secret
+	t := APIToken{ID: id, Name: name, Role: role, Hash: hashToken(token), CreatedAt: time.Now()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens = append(m.tokens, t)
+	if err := m.save(); err != nil {
+		m.tokens = m.tokens[:len(m.tokens)-1]
+		return "", nil, err
+	}
+	return token, &t, nil
+}
+
+// Tokens returns the API tokens without their hashes.
+func (m *Manager) Tokens() []APIToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := make([]APIToken, len(m.tokens))
+	for i, t := range m.tokens {
+		t.Hash = ""
+		tokens[i] = t
+	}
+	return tokens
+}
+
+// DeleteToken revokes an API token. It returns an error wrapping
+// os.ErrNotExist for unknown IDs.
+func (m *Manager) DeleteToken(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.tokens, func(t APIToken) bool { return t.ID == id })
+	if i < 0 {
+		return fmt.Errorf("API token %s: %w", id, os.ErrNotExist)
+	}
+	previous := m.tokens
+	m.tokens = slices.Delete(slices.Clone(m.tokens), i, i+1)
+	if err := m.save(); err != nil {
+		m.tokens = previous
+		return err
+	}
+	return nil
+}
+
+// save writes the API tokens. The caller must hold m.mu.
+func (m *Manager) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(m.path, data, 0600)
+}
+
+// equal compares a presented credential with a configured one in constant
+// time. An unset credential never matches.
+func equal(presented, configured string) bool {
+	if configured == "" {
+		return false
+	}
+	p, c := sha256.Sum256([]byte(presented)), sha256.Sum256([]byte(configured))
+	return subtle.ConstantTimeCompare(p[:], c[:]) == 1
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
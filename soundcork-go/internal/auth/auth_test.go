@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLogin(t *testing.T) {
+	m, _ := NewManager(Config{}, "")
+	if m.Enabled() {
+		t.Error("Expected authentication to be disabled without credentials")
+	}
+	if _, _, err := m.Login(""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected an empty password to be rejected, got %v", err)
+	}
+
+	m, _ = NewManager(Config{AdminPassword: "admin", ReadOnlyPassword: "viewer"}, "")
+	if !m.Enabled() {
+		t.Error("Expected authentication to be enabled")
+	}
+	if _, _, err := m.Login("wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	for password, want := range map[string]Role{"admin": RoleAdmin, "viewer": RoleReadOnly} {
+		id, role, err := m.Login(password)
+		if err != nil || role != want {
+			t.Fatalf("Login returned %s (%v), expected %s", role, err, want)
+		}
+		r, _ := http.NewRequest(http.MethodGet, "/setup/devices", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookie, Value: id})
+		if role, ok := m.Authenticate(r); !ok || role != want {
+			t.Errorf("Expected session with role %s, got %s %v", want, role, ok)
+		}
+
+		m.Logout(id)
+		if _, ok := m.Authenticate(r); ok {
+			t.Error("Expected the session to end with the logout")
+		}
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_tokens.json")
+	m, err := NewManager(Config{AdminToken: "bootstrap"}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bearer := func(token string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, "/setup/devices", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+	if role, ok := m.Authenticate(bearer("bootstrap")); !ok || role != RoleAdmin {
+		t.Errorf("Expected the admin token to be accepted, got %s %v", role, ok)
+	}
+
+	if _, _, err := m.CreateToken("backup", "root"); err == nil {
+		t.Error("Expected error for an unknown role")
+	}
+	token, created, err := m.CreateToken("monitoring", RoleReadOnly)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), token) {
+		t.Error("Expected only a hash of the token to be stored")
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the tokens to be readable by the owner only, got %v", info.Mode())
+	}
+
+	// Tokens survive a restart
+	m, _ = NewManager(Config{AdminToken: "bootstrap"}, path)
+	if role, ok := m.Authenticate(bearer(token)); !ok || role != RoleReadOnly {
+		t.Errorf("Expected the API token to be accepted, got %s %v", role, ok)
+	}
+	if _, ok := m.Authenticate(bearer(token + "0")); ok {
+		t.Error("Expected an unknown token to be rejected")
+	}
+	tokens := m.Tokens()
+	if len(tokens) != 1 || tokens[0].Name != "monitoring" || tokens[0].Hash != "" || tokens[0].LastUsed.IsZero() {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+
+	if err := m.DeleteToken("unknown"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+	if err := m.DeleteToken(created.ID); err != nil {
+		t.Fatalf("DeleteToken failed: %v", err)
+	}
+	if _, ok := m.Authenticate(bearer(token)); ok {
+		t.Error("Expected a deleted token to be rejected")
+	}
+}
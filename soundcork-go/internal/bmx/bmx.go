@@ -1,33 +1,151 @@
 package bmx
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gesellix/bose-soundtouch-api/internal/models"
 )
 
 const (
-	TuneInDescribe = "https://opml.radiotime.com/describe.ashx?id=%s"
-	TuneInStream   = "http://opml.radiotime.com/Tune.ashx?id=%s&formats=mp3,aac,ogg"
+	DefaultTuneInBaseURL = "https://opml.radiotime.com"
+	TuneInDescribePath   = "/describe.ashx?id=%s"
+	TuneInStreamPath     = "/Tune.ashx?id=%s&formats=mp3,aac,ogg"
+	TuneInBrowsePath     = "/Browse.ashx?c=pbrowse&id=%s"
+
+	// DefaultTimeout bounds every upstream request made by a Client.
+	DefaultTimeout = 10 * time.Second
 )
 
-func TuneInPlayback(stationID string) (*models.BmxPlaybackResponse, error) {
-	describeURL := fmt.Sprintf(TuneInDescribe, stationID)
-	resp, err := http.Get(describeURL)
+// Client resolves BMX playback data against a TuneIn compatible upstream.
+// BaseURL can point to a mirror or a local stand-in server.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Cache is optional; when set, resolved playback responses are reused
+	// within its TTL and served stale if the upstream fails.
+	Cache *Cache
+	// ProbeTimeout enables probing candidate streams before answering,
+	// so that a reachable stream comes first. Zero disables probing.
+	ProbeTimeout time.Duration
+	// Recorder optionally keeps probe results to rank streams across lookups.
+	Recorder StreamRecorder
+
+	nowPlayingMu sync.Mutex
+	nowPlaying   map[string]nowPlayingEntry
+}
+
+// NewClient creates a Client for the given base URL. An empty base URL selects
+// DefaultTuneInBaseURL, a nil httpClient one with DefaultTimeout.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultTuneInBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream %s returned %s", req.URL.Path, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (c *Client) describe(ctx context.Context, id string) ([]byte, error) {
+	return c.get(ctx, fmt.Sprintf(TuneInDescribePath, url.QueryEscape(id)))
+}
+
+func (c *Client) streamURLs(ctx context.Context, id string) ([]string, error) {
+	body, err := c.get(ctx, fmt.Sprintf(TuneInStreamPath, url.QueryEscape(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	var streamURLList []string
+	for _, sURL := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		sURL = strings.TrimSpace(sURL)
+		if sURL != "" {
+			streamURLList = append(streamURLList, sURL)
+		}
+	}
+	if len(streamURLList) == 0 {
+		return nil, fmt.Errorf("no streams found")
+	}
+
+	return streamURLList, nil
+}
+
+// cached resolves key through fetch, consulting the cache first if one is
+// configured. The response is the caller's to modify.
+func (c *Client) cached(key string, fetch func() (*models.BmxPlaybackResponse, error)) (*models.BmxPlaybackResponse, error) {
+	if c.Cache == nil {
+		return fetch()
+	}
+
+	cachedResp, fresh, ok := c.Cache.Get(key)
+	if ok && fresh {
+		return cachedResp, nil
+	}
+
+	resp, err := fetch()
+	if err != nil {
+		if ok {
+			log.Printf("Upstream lookup for %s failed, serving stale entry: %v", key, err)
+			return cachedResp, nil
+		}
+		return nil, err
+	}
+
+	if err := c.Cache.Put(key, resp); err != nil {
+		log.Printf("Failed to persist BMX cache: %v", err)
+	}
+	return resp, nil
+}
+
+// TuneInPlayback looks up a station. Its streams are probed on every call, so
+// that a cached response does not keep pointing at a stream that went down.
+func (c *Client) TuneInPlayback(ctx context.Context, stationID string) (*models.BmxPlaybackResponse, error) {
+	resp, err := c.cached("station:"+stationID, func() (*models.BmxPlaybackResponse, error) {
+		return c.tuneInPlayback(ctx, stationID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.probeAudio(ctx, &resp.Audio)
+	return resp, nil
+}
+
+func (c *Client) tuneInPlayback(ctx context.Context, stationID string) (*models.BmxPlaybackResponse, error) {
+	body, err := c.describe(ctx, stationID)
 	if err != nil {
 		return nil, err
 	}
@@ -49,22 +167,10 @@ func TuneInPlayback(stationID string) (*models.BmxPlaybackResponse, error) {
 
 	station := opml.Body.Outline.Station
 
-	streamReq := fmt.Sprintf(TuneInStream, stationID)
-	streamResp, err := http.Get(streamReq)
+	streamURLList, err := c.streamURLs(ctx, stationID)
 	if err != nil {
 		return nil, err
 	}
-	defer streamResp.Body.Close()
-
-	streamBody, err := io.ReadAll(streamResp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	streamURLList := strings.Split(strings.TrimSpace(string(streamBody)), "\n")
-	if len(streamURLList) == 0 || streamURLList[0] == "" {
-		return nil, fmt.Errorf("no streams found")
-	}
 
 	streamID := "e3342"
 	listenID := "3432432423"
@@ -77,10 +183,6 @@ func TuneInPlayback(stationID string) (*models.BmxPlaybackResponse, error) {
 
 	var streams []models.Stream
 	for _, sURL := range streamURLList {
-		sURL = strings.TrimSpace(sURL)
-		if sURL == "" {
-			continue
-		}
 		streams = append(streams, models.Stream{
 			Links: &models.Links{
 				BmxReporting: &models.Link{Href: bmxReporting},
@@ -100,6 +202,8 @@ func TuneInPlayback(stationID string) (*models.BmxPlaybackResponse, error) {
 		StreamUrl:   streamURLList[0],
 		Streams:     streams,
 	}
+	audio.Streams = c.ResolveStreams(ctx, audio.Streams)
+	selectFirstStream(&audio)
 
 	response := &models.BmxPlaybackResponse{
 		Links: &models.Links{
@@ -117,7 +221,10 @@ func TuneInPlayback(stationID string) (*models.BmxPlaybackResponse, error) {
 	return response, nil
 }
 
-func TuneInPodcastInfo(podcastID string, encodedName string) (*models.BmxPodcastInfoResponse, error) {
+// TuneInPodcastInfo lists the episodes of the show an episode belongs to, with
+// the requested episode selected, so the speaker can skip between them. If the
+// show cannot be browsed, the episode is returned on its own.
+func (c *Client) TuneInPodcastInfo(ctx context.Context, podcastID string, encodedName string) (*models.BmxPodcastInfoResponse, error) {
 	// Bose app sometimes sends non-standard base64, so try both standard and URL-safe
 	nameBytes, err := base64.URLEncoding.DecodeString(encodedName)
 	if err != nil {
@@ -128,14 +235,6 @@ func TuneInPodcastInfo(podcastID string, encodedName string) (*models.BmxPodcast
 	}
 	name := string(nameBytes)
 
-	track := models.Track{
-		Links: &models.Links{
-			BmxTrack: &models.Link{Href: fmt.Sprintf("/v1/playback/episode/%s", podcastID)},
-		},
-		IsSelected: false,
-		Name:       name,
-	}
-
 	response := &models.BmxPodcastInfoResponse{
 		Links: &models.Links{
 			Self: &models.Link{Href: fmt.Sprintf("/v1/playback/episodes/%s?encoded_name=%s", podcastID, encodedName)},
@@ -144,21 +243,64 @@ func TuneInPodcastInfo(podcastID string, encodedName string) (*models.BmxPodcast
 		ShuffleDisabled: true,
 		RepeatDisabled:  true,
 		StreamType:      "onDemand",
-		Tracks:          []models.Track{track},
+	}
+
+	showID, showTitle, err := c.showForEpisode(ctx, podcastID)
+	var episodes []episode
+	if err == nil {
+		episodes, err = c.showEpisodes(ctx, showID)
+	}
+	if err != nil || len(episodes) == 0 {
+		if err != nil {
+			log.Printf("Failed to list episodes for %s: %v", podcastID, err)
+		}
+		response.Tracks = []models.Track{episodeTrack(podcastID, name, false)}
+		return response, nil
+	}
+
+	if showTitle != "" {
+		response.Name = showTitle
+	}
+
+	selected := strings.HasPrefix(podcastID, "p")
+	for _, ep := range episodes {
+		isSelected := ep.ID == podcastID
+		selected = selected || isSelected
+		response.Tracks = append(response.Tracks, episodeTrack(ep.ID, ep.Name, isSelected))
+	}
+	if !selected {
+		// The episode is older than the pages we fetched; keep it playable.
+		response.Tracks = append([]models.Track{episodeTrack(podcastID, name, true)}, response.Tracks...)
 	}
 
 	return response, nil
 }
 
-func TuneInPlaybackPodcast(podcastID string) (*models.BmxPlaybackResponse, error) {
-	describeURL := fmt.Sprintf(TuneInDescribe, podcastID)
-	resp, err := http.Get(describeURL)
+func episodeTrack(id, name string, selected bool) models.Track {
+	return models.Track{
+		Links: &models.Links{
+			BmxTrack: &models.Link{Href: fmt.Sprintf("/v1/playback/episode/%s", id)},
+		},
+		IsSelected: selected,
+		Name:       name,
+	}
+}
+
+// TuneInPlaybackPodcast looks up an episode. Like TuneInPlayback, its streams
+// are probed on every call.
+func (c *Client) TuneInPlaybackPodcast(ctx context.Context, podcastID string) (*models.BmxPlaybackResponse, error) {
+	resp, err := c.cached("episode:"+podcastID, func() (*models.BmxPlaybackResponse, error) {
+		return c.tuneInPlaybackPodcast(ctx, podcastID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	c.probeAudio(ctx, &resp.Audio)
+	return resp, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (c *Client) tuneInPlaybackPodcast(ctx context.Context, podcastID string) (*models.BmxPlaybackResponse, error) {
+	body, err := c.describe(ctx, podcastID)
 	if err != nil {
 		return nil, err
 	}
@@ -183,23 +325,11 @@ func TuneInPlaybackPodcast(podcastID string) (*models.BmxPlaybackResponse, error
 
 	topic := opml.Body.Outline.Topic
 
-	streamReq := fmt.Sprintf(TuneInStream, podcastID)
-	streamResp, err := http.Get(streamReq)
-	if err != nil {
-		return nil, err
-	}
-	defer streamResp.Body.Close()
-
-	streamBody, err := io.ReadAll(streamResp.Body)
+	streamURLList, err := c.streamURLs(ctx, podcastID)
 	if err != nil {
 		return nil, err
 	}
 
-	streamURLList := strings.Split(strings.TrimSpace(string(streamBody)), "\n")
-	if len(streamURLList) == 0 || streamURLList[0] == "" {
-		return nil, fmt.Errorf("no streams found")
-	}
-
 	streamID := "e3342"
 	listenID := "3432432423"
 	bmxReportingQS := url.Values{}
@@ -211,10 +341,6 @@ func TuneInPlaybackPodcast(podcastID string) (*models.BmxPlaybackResponse, error
 
 	var streams []models.Stream
 	for _, sURL := range streamURLList {
-		sURL = strings.TrimSpace(sURL)
-		if sURL == "" {
-			continue
-		}
 		streams = append(streams, models.Stream{
 			Links: &models.Links{
 				BmxReporting: &models.Link{Href: bmxReporting},
@@ -234,6 +360,8 @@ func TuneInPlaybackPodcast(podcastID string) (*models.BmxPlaybackResponse, error
 		StreamUrl:   streamURLList[0],
 		Streams:     streams,
 	}
+	audio.Streams = c.ResolveStreams(ctx, audio.Streams)
+	selectFirstStream(&audio)
 
 	duration, _ := strconv.Atoi(topic.Duration)
 
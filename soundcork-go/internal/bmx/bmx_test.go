@@ -1,11 +1,129 @@
 package bmx
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
+// newTuneInStandIn serves the fixtures from testdata in place of opml.radiotime.com.
+func newTuneInStandIn(t *testing.T) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		var file string
+		switch r.URL.Path {
+		case "/describe.ashx":
+			file = "describe_" + id + ".xml"
+		case "/Tune.ashx":
+			file = "tune_" + id + ".txt"
+		case "/Browse.ashx":
+			file = "browse_" + id + ".xml"
+			if offset := r.URL.Query().Get("offset"); offset != "" {
+				file = "browse_" + id + "_" + offset + ".xml"
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestNewClient_Defaults(t *testing.T) {
+	c := NewClient("", nil)
+	if c.BaseURL != DefaultTuneInBaseURL {
+		t.Errorf("Expected default base URL, got %s", c.BaseURL)
+	}
+	if c.HTTPClient == nil || c.HTTPClient.Timeout != DefaultTimeout {
+		t.Errorf("Expected HTTP client with default timeout, got %+v", c.HTTPClient)
+	}
+
+	c = NewClient("http://mirror.local/", nil)
+	if c.BaseURL != "http://mirror.local" {
+		t.Errorf("Expected trailing slash to be trimmed, got %s", c.BaseURL)
+	}
+}
+
+func TestTuneInPlayback(t *testing.T) {
+	ts := newTuneInStandIn(t)
+	c := NewClient(ts.URL, nil)
+
+	resp, err := c.TuneInPlayback(context.Background(), "s12345")
+	if err != nil {
+		t.Fatalf("TuneInPlayback failed: %v", err)
+	}
+	if resp.Name != "Test Radio" {
+		t.Errorf("Expected name Test Radio, got %s", resp.Name)
+	}
+	if resp.StreamType != "liveRadio" {
+		t.Errorf("Expected liveRadio stream type, got %s", resp.StreamType)
+	}
+	if len(resp.Audio.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(resp.Audio.Streams))
+	}
+	if resp.Audio.StreamUrl != "http://stream.example.com/test.mp3" {
+		t.Errorf("Unexpected stream URL %s", resp.Audio.StreamUrl)
+	}
+	if !strings.Contains(resp.Links.BmxReporting.Href, "guide_id=s12345") {
+		t.Errorf("Unexpected reporting link %s", resp.Links.BmxReporting.Href)
+	}
+}
+
+func TestTuneInPlayback_UpstreamErrors(t *testing.T) {
+	ts := newTuneInStandIn(t)
+	c := NewClient(ts.URL, nil)
+
+	if _, err := c.TuneInPlayback(context.Background(), "unknown"); err == nil {
+		t.Error("Expected error for unknown station")
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	c = NewClient(slow.URL, &http.Client{Timeout: 50 * time.Millisecond})
+	if _, err := c.TuneInPlayback(context.Background(), "s12345"); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestTuneInPlaybackPodcast(t *testing.T) {
+	ts := newTuneInStandIn(t)
+	c := NewClient(ts.URL, nil)
+
+	resp, err := c.TuneInPlaybackPodcast(context.Background(), "t98765")
+	if err != nil {
+		t.Fatalf("TuneInPlaybackPodcast failed: %v", err)
+	}
+	if resp.Name != "Episode 42" || resp.Artist.Name != "Test Show" {
+		t.Errorf("Unexpected episode %q by %q", resp.Name, resp.Artist.Name)
+	}
+	if resp.Duration != 1800 {
+		t.Errorf("Expected duration 1800, got %d", resp.Duration)
+	}
+	if resp.Links.BmxFavorite.Href != "/v1/favorite/p555" {
+		t.Errorf("Unexpected favorite link %s", resp.Links.BmxFavorite.Href)
+	}
+	if resp.Audio.IsRealtime {
+		t.Error("Expected on-demand audio to not be realtime")
+	}
+}
+
 func TestPlayCustomStream(t *testing.T) {
 	// Simple test for custom stream XML generation
 	dataObj := struct {
@@ -42,10 +160,12 @@ func TestPlayCustomStream(t *testing.T) {
 
 func TestTuneInPodcastInfo_Base64(t *testing.T) {
 	name := "Podcast Name / with special chars?"
+	// The stand-in knows nothing about "123", so the single-track fallback is used.
+	c := NewClient(newTuneInStandIn(t).URL, nil)
 
 	// Test Standard Base64
 	encodedStd := base64.StdEncoding.EncodeToString([]byte(name))
-	resp, err := TuneInPodcastInfo("123", encodedStd)
+	resp, err := c.TuneInPodcastInfo(context.Background(), "123", encodedStd)
 	if err != nil {
 		t.Fatalf("TuneInPodcastInfo with standard base64 failed: %v", err)
 	}
@@ -55,11 +175,44 @@ func TestTuneInPodcastInfo_Base64(t *testing.T) {
 
 	// Test URL-safe Base64
 	encodedURL := base64.URLEncoding.EncodeToString([]byte(name))
-	resp, err = TuneInPodcastInfo("123", encodedURL)
+	resp, err = c.TuneInPodcastInfo(context.Background(), "123", encodedURL)
 	if err != nil {
 		t.Fatalf("TuneInPodcastInfo with URL-safe base64 failed: %v", err)
 	}
 	if resp.Name != name {
 		t.Errorf("Expected name %s, got %s", name, resp.Name)
 	}
+	if len(resp.Tracks) != 1 || resp.Tracks[0].Links.BmxTrack.Href != "/v1/playback/episode/123" {
+		t.Errorf("Expected single fallback track, got %+v", resp.Tracks)
+	}
+}
+
+func TestTuneInPodcastInfo_Episodes(t *testing.T) {
+	c := NewClient(newTuneInStandIn(t).URL, nil)
+	encoded := base64.StdEncoding.EncodeToString([]byte("Episode 42"))
+
+	resp, err := c.TuneInPodcastInfo(context.Background(), "t98765", encoded)
+	if err != nil {
+		t.Fatalf("TuneInPodcastInfo failed: %v", err)
+	}
+	if resp.Name != "Test Show" {
+		t.Errorf("Expected show title as name, got %s", resp.Name)
+	}
+
+	want := []string{"t98766", "t98765", "t98764"}
+	if len(resp.Tracks) != len(want) {
+		t.Fatalf("Expected %d tracks across both pages, got %+v", len(want), resp.Tracks)
+	}
+	for i, id := range want {
+		track := resp.Tracks[i]
+		if track.Links.BmxTrack.Href != "/v1/playback/episode/"+id {
+			t.Errorf("Track %d: unexpected link %s", i, track.Links.BmxTrack.Href)
+		}
+		if track.IsSelected != (id == "t98765") {
+			t.Errorf("Track %d: unexpected selection %v", i, track.IsSelected)
+		}
+	}
+	if resp.Tracks[2].Name != "Episode 41" {
+		t.Errorf("Unexpected name for last track: %s", resp.Tracks[2].Name)
+	}
 }
@@ -0,0 +1,145 @@
+package bmx
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/atomicfile"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+const (
+	DefaultCacheTTL  = 10 * time.Minute
+	DefaultCacheSize = 256
+)
+
+type cacheEntry struct {
+	Response models.BmxPlaybackResponse `json:"response"`
+	StoredAt time.Time                  `json:"stored_at"`
+}
+
+// Cache keeps resolved playback responses keyed by station or episode ID.
+// Entries older than the TTL are refreshed from upstream, but are still
+// served when the upstream lookup fails. The number of entries is bounded;
+// the oldest entry is evicted first.
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	entries map[string]cacheEntry
+	path    string
+	now     func() time.Time
+}
+
+// NewCache creates an in-memory cache. Non-positive values select the defaults.
+func NewCache(ttl time.Duration, maxSize int) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	return &Cache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Persist makes the cache write its entries to path after every update and
+// loads entries left there by a previous run.
+func (c *Cache) Persist(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.path = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries map[string]cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for key, entry := range entries {
+		c.entries[key] = entry
+	}
+	c.evict()
+	return nil
+}
+
+// Get returns a copy of the cached response and whether it is still within the TTL.
+func (c *Cache) Get(key string) (resp *models.BmxPlaybackResponse, fresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, false
+	}
+	return clonePlayback(&entry.Response), c.now().Sub(entry.StoredAt) < c.ttl, true
+}
+
+// Put stores a copy of the response.
+func (c *Cache) Put(key string, resp *models.BmxPlaybackResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{Response: *clonePlayback(resp), StoredAt: c.now()}
+	c.evict()
+	return c.save()
+}
+
+// Len returns the number of cached entries.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *Cache) evict() {
+	for len(c.entries) > c.maxSize {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.StoredAt.Before(oldest) {
+				oldestKey = key
+				oldest = entry.StoredAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+}
+
+func (c *Cache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(c.path, data, 0644)
+}
+
+// clonePlayback copies a response deep enough that callers can modify the
+// stream list or favorite flag without touching the cached entry.
+func clonePlayback(resp *models.BmxPlaybackResponse) *models.BmxPlaybackResponse {
+	cp := *resp
+	if resp.Audio.Streams != nil {
+		cp.Audio.Streams = make([]models.Stream, len(resp.Audio.Streams))
+		copy(cp.Audio.Streams, resp.Audio.Streams)
+	}
+	if resp.IsFavorite != nil {
+		fav := *resp.IsFavorite
+		cp.IsFavorite = &fav
+	}
+	return &cp
+}
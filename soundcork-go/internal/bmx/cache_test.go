@@ -0,0 +1,165 @@
+package bmx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestCache_TTLAndEviction(t *testing.T) {
+	c := NewCache(time.Minute, 2)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+
+	c.Put("a", &models.BmxPlaybackResponse{Name: "A"})
+	now = now.Add(time.Second)
+	c.Put("b", &models.BmxPlaybackResponse{Name: "B"})
+
+	resp, fresh, ok := c.Get("a")
+	if !ok || !fresh || resp.Name != "A" {
+		t.Fatalf("Expected fresh entry A, got %+v fresh=%v ok=%v", resp, fresh, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, fresh, ok := c.Get("a"); !ok || fresh {
+		t.Errorf("Expected stale entry after TTL, got fresh=%v ok=%v", fresh, ok)
+	}
+
+	c.Put("c", &models.BmxPlaybackResponse{Name: "C"})
+	if c.Len() != 2 {
+		t.Errorf("Expected cache to be bounded to 2 entries, got %d", c.Len())
+	}
+	if _, _, ok := c.Get("a"); ok {
+		t.Error("Expected oldest entry to be evicted")
+	}
+}
+
+func TestCache_ReturnsCopies(t *testing.T) {
+	c := NewCache(time.Minute, 10)
+	c.Put("a", &models.BmxPlaybackResponse{
+		Audio:      models.Audio{Streams: []models.Stream{{StreamUrl: "http://one"}}},
+		IsFavorite: new(bool),
+	})
+
+	resp, _, _ := c.Get("a")
+	resp.Audio.Streams[0].StreamUrl = "http://changed"
+	*resp.IsFavorite = true
+
+	again, _, _ := c.Get("a")
+	if again.Audio.Streams[0].StreamUrl != "http://one" || *again.IsFavorite {
+		t.Errorf("Cached entry was modified through a returned copy: %+v", again)
+	}
+}
+
+func TestCache_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "tunein.json")
+
+	c := NewCache(time.Minute, 10)
+	if err := c.Persist(path); err != nil {
+		t.Fatalf("Persist on missing file failed: %v", err)
+	}
+	c.Put("station:s1", &models.BmxPlaybackResponse{Name: "Persisted"})
+
+	restored := NewCache(time.Minute, 10)
+	if err := restored.Persist(path); err != nil {
+		t.Fatalf("Persist failed to load: %v", err)
+	}
+	resp, _, ok := restored.Get("station:s1")
+	if !ok || resp.Name != "Persisted" {
+		t.Errorf("Expected persisted entry, got %+v ok=%v", resp, ok)
+	}
+}
+
+func TestClient_ServesStaleOnError(t *testing.T) {
+	ts := newTuneInStandIn(t)
+	var failing atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		ts.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(upstream.URL, nil)
+	c.Cache = NewCache(time.Minute, 10)
+	now := time.Now()
+	c.Cache.now = func() time.Time { return now }
+
+	if _, err := c.TuneInPlayback(context.Background(), "s12345"); err != nil {
+		t.Fatalf("Initial lookup failed: %v", err)
+	}
+
+	failing.Store(true)
+	if _, err := c.TuneInPlayback(context.Background(), "s12345"); err != nil {
+		t.Errorf("Expected fresh cache hit without upstream, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	resp, err := c.TuneInPlayback(context.Background(), "s12345")
+	if err != nil {
+		t.Fatalf("Expected stale entry on upstream failure, got %v", err)
+	}
+	if resp.Name != "Test Radio" {
+		t.Errorf("Unexpected stale response %+v", resp)
+	}
+
+	if _, err := c.TuneInPlayback(context.Background(), "s99999"); err == nil {
+		t.Error("Expected error for uncached station while upstream is down")
+	}
+}
+
+func TestClient_ReprobesCachedStreams(t *testing.T) {
+	var down atomic.Bool
+	streams := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/first" && down.Load() {
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+	}))
+	defer streams.Close()
+
+	ts := newTuneInStandIn(t)
+	var tunes atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/Tune.ashx" {
+			tunes.Add(1)
+			w.Write([]byte(streams.URL + "/first\n" + streams.URL + "/second\n"))
+			return
+		}
+		ts.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(upstream.URL, nil)
+	c.Cache = NewCache(time.Minute, 10)
+	c.ProbeTimeout = time.Second
+
+	resp, err := c.TuneInPlayback(context.Background(), "s12345")
+	if err != nil {
+		t.Fatalf("Initial lookup failed: %v", err)
+	}
+	if resp.Audio.StreamUrl != streams.URL+"/first" {
+		t.Errorf("Expected first stream while it is up, got %s", resp.Audio.StreamUrl)
+	}
+
+	down.Store(true)
+	resp, err = c.TuneInPlayback(context.Background(), "s12345")
+	if err != nil {
+		t.Fatalf("Cached lookup failed: %v", err)
+	}
+	if resp.Audio.StreamUrl != streams.URL+"/second" || resp.Audio.Streams[0].StreamUrl != streams.URL+"/second" {
+		t.Errorf("Expected cached streams to be probed again, got %s first", resp.Audio.StreamUrl)
+	}
+	if n := tunes.Load(); n != 1 {
+		t.Errorf("Expected the second lookup to be served from the cache, got %d upstream lookups", n)
+	}
+}
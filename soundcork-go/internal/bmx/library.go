@@ -0,0 +1,93 @@
+package bmx
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// LibraryNavigate lists the local station library for browsing on the speaker,
+// with one section per genre.
+func LibraryNavigate(stations []models.Station) *models.BmxNavigateResponse {
+	byGenre := make(map[string][]models.NavigateItem)
+	for _, st := range stations {
+		genre := st.Genre
+		if genre == "" {
+			genre = "Stations"
+		}
+		byGenre[genre] = append(byGenre[genre], models.NavigateItem{
+			Links: &models.Links{
+				BmxPlayback: &models.Link{Href: constants.LibraryStationPath + st.ID},
+			},
+			Name:         st.Name,
+			Subtitle:     st.Genre,
+			ImageUrl:     st.Logo,
+			StreamType:   "liveRadio",
+			IsPresetable: true,
+		})
+	}
+
+	genres := make([]string, 0, len(byGenre))
+	for genre := range byGenre {
+		genres = append(genres, genre)
+	}
+	sort.Strings(genres)
+
+	sections := []models.NavigateSection{}
+	for _, genre := range genres {
+		sections = append(sections, models.NavigateSection{
+			Name:   genre,
+			Layout: "list",
+			Items:  byGenre[genre],
+		})
+	}
+
+	return &models.BmxNavigateResponse{
+		Links: &models.Links{
+			Self: &models.Link{Href: "/v1/navigate"},
+		},
+		Name:     "My Stations",
+		Layout:   "list",
+		Sections: sections,
+	}
+}
+
+// LibraryPlayback builds the playback response for a station from the local library.
+func LibraryPlayback(station models.Station) (*models.BmxPlaybackResponse, error) {
+	if len(station.StreamURLs) == 0 {
+		return nil, fmt.Errorf("station %s has no stream URLs", station.ID)
+	}
+
+	var streams []models.Stream
+	for _, sURL := range station.StreamURLs {
+		streams = append(streams, models.Stream{
+			HasPlaylist:       true,
+			IsRealtime:        true,
+			BufferingTimeout:  20,
+			ConnectingTimeout: 10,
+			StreamUrl:         sURL,
+		})
+	}
+
+	audio := models.Audio{
+		HasPlaylist: true,
+		IsRealtime:  true,
+		MaxTimeout:  60,
+		StreamUrl:   station.StreamURLs[0],
+		Streams:     streams,
+	}
+
+	response := &models.BmxPlaybackResponse{
+		Links: &models.Links{
+			Self: &models.Link{Href: constants.LibraryStationPath + station.ID},
+		},
+		Audio:      audio,
+		ImageUrl:   station.Logo,
+		Name:       station.Name,
+		StreamType: "liveRadio",
+	}
+
+	return response, nil
+}
@@ -0,0 +1,57 @@
+package bmx
+
+import (
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestLibraryNavigate(t *testing.T) {
+	resp := LibraryNavigate([]models.Station{
+		{ID: "1", Name: "Rock FM", Genre: "Rock"},
+		{ID: "2", Name: "Jazz Lounge", Genre: "Jazz"},
+		{ID: "3", Name: "Untagged"},
+	})
+
+	if len(resp.Sections) != 3 {
+		t.Fatalf("Expected 3 sections, got %d", len(resp.Sections))
+	}
+	if resp.Sections[0].Name != "Jazz" || resp.Sections[1].Name != "Rock" || resp.Sections[2].Name != "Stations" {
+		t.Errorf("Unexpected section order: %+v", resp.Sections)
+	}
+
+	item := resp.Sections[1].Items[0]
+	if item.Links.BmxPlayback.Href != "/v1/playback/library/1" {
+		t.Errorf("Unexpected playback link %s", item.Links.BmxPlayback.Href)
+	}
+	if !item.IsPresetable {
+		t.Error("Expected library stations to be presetable")
+	}
+
+	empty := LibraryNavigate(nil)
+	if empty.Sections == nil || len(empty.Sections) != 0 {
+		t.Errorf("Expected empty sections for empty library, got %+v", empty.Sections)
+	}
+}
+
+func TestLibraryPlayback(t *testing.T) {
+	resp, err := LibraryPlayback(models.Station{
+		ID:         "7",
+		Name:       "Rock FM",
+		StreamURLs: []string{"http://rock.example.com/live", "http://rock.example.com/backup"},
+		Logo:       "http://rock.example.com/logo.png",
+	})
+	if err != nil {
+		t.Fatalf("LibraryPlayback failed: %v", err)
+	}
+	if resp.Name != "Rock FM" || resp.ImageUrl != "http://rock.example.com/logo.png" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if resp.Audio.StreamUrl != "http://rock.example.com/live" || len(resp.Audio.Streams) != 2 {
+		t.Errorf("Unexpected audio %+v", resp.Audio)
+	}
+
+	if _, err := LibraryPlayback(models.Station{ID: "8"}); err == nil {
+		t.Error("Expected error for station without stream URLs")
+	}
+}
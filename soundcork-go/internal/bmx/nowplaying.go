@@ -0,0 +1,139 @@
+package bmx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+const (
+	// NowPlayingTTL is how long stream metadata is reused per station.
+	NowPlayingTTL = 30 * time.Second
+	// nowPlayingTimeout bounds reading metadata from a single stream.
+	nowPlayingTimeout = 5 * time.Second
+	// maxMetaInt guards against servers announcing absurd metadata intervals.
+	maxMetaInt = 256 * 1024
+)
+
+type nowPlayingEntry struct {
+	resp      *models.BmxNowPlayingResponse
+	fetchedAt time.Time
+}
+
+// TuneInNowPlaying reports the song currently playing on a station, read from
+// the ICY metadata of its stream. If no stream provides metadata, the station
+// name is reported instead.
+func (c *Client) TuneInNowPlaying(ctx context.Context, stationID string) (*models.BmxNowPlayingResponse, error) {
+	c.nowPlayingMu.Lock()
+	entry, ok := c.nowPlaying[stationID]
+	c.nowPlayingMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < NowPlayingTTL {
+		return entry.resp, nil
+	}
+
+	playback, err := c.TuneInPlayback(ctx, stationID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.BmxNowPlayingResponse{
+		Links: &models.Links{
+			Self: &models.Link{Href: "/v1/now-playing/station/" + stationID},
+		},
+		ImageUrl:   playback.ImageUrl,
+		Name:       playback.Name,
+		StreamType: playback.StreamType,
+	}
+
+	for _, st := range playback.Audio.Streams {
+		title, err := c.streamTitle(ctx, st.StreamUrl)
+		if err != nil || title == "" {
+			continue
+		}
+		artist, track := splitStreamTitle(title)
+		resp.Artist.Name = artist
+		resp.Name = track
+		break
+	}
+
+	c.nowPlayingMu.Lock()
+	if c.nowPlaying == nil {
+		c.nowPlaying = make(map[string]nowPlayingEntry)
+	}
+	c.nowPlaying[stationID] = nowPlayingEntry{resp: resp, fetchedAt: time.Now()}
+	c.nowPlayingMu.Unlock()
+	return resp, nil
+}
+
+// streamTitle connects to a stream asking for ICY metadata and returns the
+// StreamTitle of the first metadata block.
+func (c *Client) streamTitle(ctx context.Context, streamURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, nowPlayingTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("stream returned %s", resp.Status)
+	}
+
+	metaInt, err := strconv.Atoi(resp.Header.Get("Icy-Metaint"))
+	if err != nil || metaInt <= 0 || metaInt > maxMetaInt {
+		return "", fmt.Errorf("stream does not provide ICY metadata")
+	}
+
+	if _, err := io.CopyN(io.Discard, resp.Body, int64(metaInt)); err != nil {
+		return "", err
+	}
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(resp.Body, length); err != nil {
+		return "", err
+	}
+	meta := make([]byte, int(length[0])*16)
+	if _, err := io.ReadFull(resp.Body, meta); err != nil {
+		return "", err
+	}
+
+	return parseStreamTitle(string(meta)), nil
+}
+
+// parseStreamTitle extracts StreamTitle from an ICY metadata block such as
+// "StreamTitle='Artist - Track';StreamUrl=”;".
+func parseStreamTitle(meta string) string {
+	meta = strings.TrimRight(meta, "\x00")
+	_, rest, ok := strings.Cut(meta, "StreamTitle='")
+	if !ok {
+		return ""
+	}
+	if end := strings.Index(rest, "';"); end >= 0 {
+		rest = rest[:end]
+	} else {
+		rest = strings.TrimSuffix(rest, "'")
+	}
+	return strings.TrimSpace(rest)
+}
+
+// splitStreamTitle splits the common "Artist - Track" form. Titles without
+// separator are returned as track only.
+func splitStreamTitle(title string) (artist, track string) {
+	if a, t, ok := strings.Cut(title, " - "); ok && a != "" && t != "" {
+		return strings.TrimSpace(a), strings.TrimSpace(t)
+	}
+	return "", title
+}
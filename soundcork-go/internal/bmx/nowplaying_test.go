@@ -0,0 +1,92 @@
+package bmx
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// icyStream writes metaInt bytes of audio followed by a metadata block.
+func icyStream(w http.ResponseWriter, metaInt int, meta string) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("icy-metaint", strconv.Itoa(metaInt))
+	block := []byte(meta)
+	if pad := len(block) % 16; pad != 0 {
+		block = append(block, bytes.Repeat([]byte{0}, 16-pad)...)
+	}
+	w.Write(bytes.Repeat([]byte{0xff}, metaInt))
+	w.Write([]byte{byte(len(block) / 16)})
+	w.Write(block)
+}
+
+func TestParseStreamTitle(t *testing.T) {
+	tests := map[string]string{
+		"StreamTitle='Artist - Track';StreamUrl='';\x00\x00": "Artist - Track",
+		"StreamTitle='It's Here';":                           "It's Here",
+		"StreamUrl='http://example.com';":                    "",
+	}
+	for meta, want := range tests {
+		if got := parseStreamTitle(meta); got != want {
+			t.Errorf("parseStreamTitle(%q) = %q, want %q", meta, got, want)
+		}
+	}
+
+	if artist, track := splitStreamTitle("Daft Punk - One More Time"); artist != "Daft Punk" || track != "One More Time" {
+		t.Errorf("Unexpected split %q / %q", artist, track)
+	}
+	if artist, track := splitStreamTitle("Station Jingle"); artist != "" || track != "Station Jingle" {
+		t.Errorf("Unexpected split %q / %q", artist, track)
+	}
+}
+
+func TestTuneInNowPlaying(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/describe.ashx":
+			w.Write([]byte(`<opml><body><outline><station><name>Meta Radio</name><logo>http://logo.example.com/m.png</logo></station></outline></body></opml>`))
+		case "/Tune.ashx":
+			if r.URL.Query().Get("id") == "s2" {
+				w.Write([]byte(ts.URL + "/plain.mp3\n"))
+				return
+			}
+			w.Write([]byte(ts.URL + "/plain.mp3\n" + ts.URL + "/icy.mp3\n"))
+		case "/plain.mp3":
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write([]byte{0xff, 0xfb})
+		case "/icy.mp3":
+			if r.Header.Get("Icy-MetaData") != "1" {
+				t.Errorf("Expected Icy-MetaData request header")
+			}
+			icyStream(w, 16, "StreamTitle='The Band - The Song';")
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil)
+	resp, err := c.TuneInNowPlaying(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("TuneInNowPlaying failed: %v", err)
+	}
+	if resp.Artist.Name != "The Band" || resp.Name != "The Song" {
+		t.Errorf("Expected The Band / The Song, got %q / %q", resp.Artist.Name, resp.Name)
+	}
+	if resp.ImageUrl != "http://logo.example.com/m.png" || resp.Links.Self.Href != "/v1/now-playing/station/s1" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	fallback, err := c.TuneInNowPlaying(context.Background(), "s2")
+	if err != nil {
+		t.Fatalf("TuneInNowPlaying failed: %v", err)
+	}
+	if fallback.Name != "Meta Radio" || fallback.Artist.Name != "" {
+		t.Errorf("Expected station name without metadata, got %+v", fallback)
+	}
+
+	if again, _ := c.TuneInNowPlaying(context.Background(), "s1"); again != resp {
+		t.Error("Expected cached now-playing response within TTL")
+	}
+}
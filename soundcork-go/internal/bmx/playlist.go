@@ -0,0 +1,365 @@
+package bmx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+const (
+	// maxPlaylistSize limits how much of a playlist body is read.
+	maxPlaylistSize = 64 * 1024
+	// maxPlaylistDepth limits how often playlists pointing at playlists are followed.
+	maxPlaylistDepth = 3
+)
+
+var (
+	asxRefPattern       = regexp.MustCompile(`(?i)<ref\s+href\s*=\s*["']([^"']+)["']`)
+	hlsBandwidthPattern = regexp.MustCompile(`(?:^|[:,])BANDWIDTH=(\d+)`)
+)
+
+// playlistEntry is a single stream found in a playlist. Realtime is nil when
+// the playlist does not tell whether the entry is live.
+type playlistEntry struct {
+	URL       string
+	Playlist  bool
+	Realtime  *bool
+	bandwidth int
+}
+
+// errNotPlaylist is returned by fetchPlaylist for URLs that turn out to serve
+// audio data rather than a playlist.
+var errNotPlaylist = errors.New("not a playlist")
+
+// isPlaylistURL reports whether a stream URL points to a playlist wrapper
+// rather than directly to audio data.
+func isPlaylistURL(streamURL string) bool {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".pls", ".m3u", ".m3u8", ".asx":
+		return true
+	}
+	return false
+}
+
+// isAudioURL reports whether a stream URL has the extension of an audio file,
+// so that it needs no request to tell it is no playlist.
+func isAudioURL(streamURL string) bool {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".mp3", ".aac", ".aacp", ".m4a", ".ogg", ".opus", ".flac", ".wma":
+		return true
+	}
+	return false
+}
+
+// isPlaylistMediaType reports whether a Content-Type names a playlist format,
+// for playlist URLs without a telling extension.
+func isPlaylistMediaType(mediaType string) bool {
+	switch mediaType {
+	case "audio/x-scpls", "audio/scpls",
+		"audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "application/vnd.apple.mpegurl",
+		"video/x-ms-asf", "video/x-ms-asx", "audio/x-ms-asx":
+		return true
+	}
+	return false
+}
+
+// ResolveAudio expands playlist URLs in audio into the streams they reference,
+// orders them by health if probing is enabled and points the audio at the
+// first of them.
+func (c *Client) ResolveAudio(ctx context.Context, audio *models.Audio) {
+	audio.Streams = c.ProbeStreams(ctx, c.ResolveStreams(ctx, audio.Streams))
+	selectFirstStream(audio)
+}
+
+// probeAudio orders the streams of audio by health if probing is enabled and
+// points the audio at the first of them. Unlike ResolveAudio it does not
+// fetch playlists, so it can run on every lookup of a cached response.
+func (c *Client) probeAudio(ctx context.Context, audio *models.Audio) {
+	audio.Streams = c.ProbeStreams(ctx, audio.Streams)
+	selectFirstStream(audio)
+}
+
+func selectFirstStream(audio *models.Audio) {
+	if len(audio.Streams) > 0 {
+		audio.StreamUrl = audio.Streams[0].StreamUrl
+		audio.HasPlaylist = audio.Streams[0].HasPlaylist
+		audio.IsRealtime = audio.Streams[0].IsRealtime
+	}
+}
+
+// ResolveStreams replaces PLS, M3U, ASX and HLS master playlist URLs with the
+// streams listed in them, keeping the original order as fallback order.
+// Direct streams are marked as such; playlists that cannot be fetched are
+// passed through for the speaker to try itself.
+func (c *Client) ResolveStreams(ctx context.Context, streams []models.Stream) []models.Stream {
+	var resolved []models.Stream
+	seen := make(map[string]bool)
+	for _, st := range streams {
+		for _, rs := range c.resolveStream(ctx, st, maxPlaylistDepth) {
+			if seen[rs.StreamUrl] {
+				continue
+			}
+			seen[rs.StreamUrl] = true
+			resolved = append(resolved, rs)
+		}
+	}
+	return resolved
+}
+
+// resolveStream expands a playlist URL. URLs without the extension of a
+// playlist or an audio file are requested as well, and treated as playlist if
+// the response has the Content-Type of one.
+func (c *Client) resolveStream(ctx context.Context, st models.Stream, depth int) []models.Stream {
+	known := isPlaylistURL(st.StreamUrl)
+	if (!known && isAudioURL(st.StreamUrl)) || depth == 0 {
+		st.HasPlaylist = known
+		return []models.Stream{st}
+	}
+
+	entries, err := c.fetchPlaylist(ctx, st.StreamUrl, known)
+	if !known && err != nil {
+		if !errors.Is(err, errNotPlaylist) {
+			log.Printf("Failed to check stream %s for a playlist: %v", st.StreamUrl, err)
+		}
+		st.HasPlaylist = false
+		return []models.Stream{st}
+	}
+	st.HasPlaylist = true
+	if err != nil {
+		log.Printf("Failed to resolve playlist %s: %v", st.StreamUrl, err)
+		return []models.Stream{st}
+	}
+
+	var streams []models.Stream
+	for _, e := range entries {
+		es := st
+		es.StreamUrl = e.URL
+		if e.Realtime != nil {
+			es.IsRealtime = *e.Realtime
+		}
+		if e.Playlist {
+			// HLS playlists are played by the speaker itself.
+			es.HasPlaylist = true
+			streams = append(streams, es)
+			continue
+		}
+		streams = append(streams, c.resolveStream(ctx, es, depth-1)...)
+	}
+	return streams
+}
+
+// fetchPlaylist requests and parses a playlist. Unless known is set, it fails
+// with errNotPlaylist if the response has no playlist Content-Type, without
+// reading the body.
+func (c *Client) fetchPlaylist(ctx context.Context, playlistURL string, known bool) ([]playlistEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, playlistURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("playlist returned %s", resp.Status)
+	}
+	if !known {
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if !isPlaylistMediaType(strings.ToLower(mediaType)) {
+			return nil, errNotPlaylist
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parsePlaylist(resp.Request.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("playlist contains no streams")
+	}
+	return entries, nil
+}
+
+// parsePlaylist detects the playlist format from its content and returns the
+// entries with URLs resolved against base.
+func parsePlaylist(base *url.URL, body []byte) ([]playlistEntry, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	var entries []playlistEntry
+	switch {
+	case bytes.HasPrefix(bytes.ToLower(trimmed), []byte("[playlist]")):
+		entries = parsePLS(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		entries = parseASX(trimmed)
+	case bytes.Contains(trimmed, []byte("#EXT-X-")):
+		entries = parseHLS(base, trimmed)
+	default:
+		entries = parseM3U(trimmed)
+	}
+
+	var valid []playlistEntry
+	for _, e := range entries {
+		ref, err := url.Parse(strings.TrimSpace(e.URL))
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+		if ref.Scheme != "http" && ref.Scheme != "https" {
+			continue
+		}
+		e.URL = ref.String()
+		valid = append(valid, e)
+	}
+	return valid, nil
+}
+
+func parsePLS(body []byte) []playlistEntry {
+	files := make(map[int]string)
+	lengths := make(map[int]int)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(key)
+		if n, found := strings.CutPrefix(key, "file"); found {
+			if idx, err := strconv.Atoi(n); err == nil {
+				files[idx] = value
+			}
+		} else if n, found := strings.CutPrefix(key, "length"); found {
+			if idx, err := strconv.Atoi(n); err == nil {
+				lengths[idx], _ = strconv.Atoi(value)
+			}
+		}
+	}
+
+	indices := make([]int, 0, len(files))
+	for idx := range files {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+
+	var entries []playlistEntry
+	for _, idx := range indices {
+		e := playlistEntry{URL: files[idx]}
+		if length, ok := lengths[idx]; ok && length != 0 {
+			e.Realtime = boolPtr(length < 0)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func parseM3U(body []byte) []playlistEntry {
+	var entries []playlistEntry
+	var duration *int
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if info, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			d, _, _ := strings.Cut(info, ",")
+			if n, err := strconv.Atoi(strings.TrimSpace(d)); err == nil {
+				duration = &n
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		e := playlistEntry{URL: line}
+		if duration != nil && *duration != 0 {
+			e.Realtime = boolPtr(*duration < 0)
+		}
+		entries = append(entries, e)
+		duration = nil
+	}
+	return entries
+}
+
+// parseHLS returns the variants of a master playlist ordered by bandwidth,
+// highest first. A media playlist is returned as a single entry for itself.
+func parseHLS(base *url.URL, body []byte) []playlistEntry {
+	if !bytes.Contains(body, []byte("#EXT-X-STREAM-INF")) {
+		if base == nil {
+			return nil
+		}
+		live := !bytes.Contains(body, []byte("#EXT-X-ENDLIST"))
+		return []playlistEntry{{URL: base.String(), Playlist: true, Realtime: &live}}
+	}
+
+	var entries []playlistEntry
+	var pending *playlistEntry
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if attrs, ok := strings.CutPrefix(line, "#EXT-X-STREAM-INF:"); ok {
+			pending = &playlistEntry{Playlist: true}
+			if m := hlsBandwidthPattern.FindStringSubmatch(attrs); m != nil {
+				pending.bandwidth, _ = strconv.Atoi(m[1])
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") || pending == nil {
+			continue
+		}
+		pending.URL = line
+		entries = append(entries, *pending)
+		pending = nil
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].bandwidth > entries[j].bandwidth
+	})
+	return entries
+}
+
+func parseASX(body []byte) []playlistEntry {
+	var entries []playlistEntry
+	for _, m := range asxRefPattern.FindAllSubmatch(body, -1) {
+		entries = append(entries, playlistEntry{URL: html.UnescapeString(string(m[1]))})
+	}
+	return entries
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,176 @@
+package bmx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	base, _ := url.Parse("http://radio.example.com/lists/station.m3u8")
+
+	tests := []struct {
+		name     string
+		body     string
+		urls     []string
+		playlist bool
+		realtime *bool
+	}{
+		{
+			name: "PLS",
+			body: "[playlist]\nNumberOfEntries=2\nFile2=http://b.example.com/live\nFile1=http://a.example.com/live\nLength1=-1\nVersion=2\n",
+			urls: []string{"http://a.example.com/live", "http://b.example.com/live"},
+		},
+		{
+			name: "M3U",
+			body: "http://a.example.com/live.mp3\n\nhttp://b.example.com/live.mp3\n",
+			urls: []string{"http://a.example.com/live.mp3", "http://b.example.com/live.mp3"},
+		},
+		{
+			name:     "Extended M3U",
+			body:     "#EXTM3U\n#EXTINF:-1,Test Radio\nhttp://a.example.com/live.aac\n",
+			urls:     []string{"http://a.example.com/live.aac"},
+			realtime: boolPtr(true),
+		},
+		{
+			name:     "HLS master",
+			body:     "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS=\"mp4a.40.5\"\nlow/index.m3u8\n#EXT-X-STREAM-INF:AVERAGE-BANDWIDTH=120000,BANDWIDTH=128000\nhigh/index.m3u8\n",
+			urls:     []string{"http://radio.example.com/lists/high/index.m3u8", "http://radio.example.com/lists/low/index.m3u8"},
+			playlist: true,
+		},
+		{
+			name:     "HLS media",
+			body:     "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg1.aac\n#EXT-X-ENDLIST\n",
+			urls:     []string{"http://radio.example.com/lists/station.m3u8"},
+			playlist: true,
+			realtime: boolPtr(false),
+		},
+		{
+			name: "ASX",
+			body: `<ASX version="3.0"><Entry><REF HREF="http://a.example.com/live?x=1&amp;y=2" /></Entry><entry><ref href="mms://legacy.example.com/live"/></entry></ASX>`,
+			urls: []string{"http://a.example.com/live?x=1&y=2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parsePlaylist(base, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parsePlaylist failed: %v", err)
+			}
+			if len(entries) != len(tt.urls) {
+				t.Fatalf("Expected %d entries, got %+v", len(tt.urls), entries)
+			}
+			for i, e := range entries {
+				if e.URL != tt.urls[i] {
+					t.Errorf("Entry %d: expected %s, got %s", i, tt.urls[i], e.URL)
+				}
+				if e.Playlist != tt.playlist {
+					t.Errorf("Entry %d: expected playlist=%v", i, tt.playlist)
+				}
+			}
+			if tt.realtime != nil && (entries[0].Realtime == nil || *entries[0].Realtime != *tt.realtime) {
+				t.Errorf("Expected realtime=%v, got %v", *tt.realtime, entries[0].Realtime)
+			}
+		})
+	}
+}
+
+func TestResolveAudio(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/station.pls":
+			w.Write([]byte("[playlist]\nFile1=" + ts.URL + "/nested.m3u\nFile2=http://b.example.com/live.mp3\n"))
+		case "/nested.m3u":
+			w.Write([]byte("http://a.example.com/live.mp3\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil)
+	audio := models.Audio{
+		HasPlaylist: true,
+		IsRealtime:  true,
+		Streams: []models.Stream{
+			{HasPlaylist: true, IsRealtime: true, StreamUrl: ts.URL + "/station.pls"},
+			{HasPlaylist: true, IsRealtime: true, StreamUrl: ts.URL + "/missing.m3u"},
+			{HasPlaylist: true, IsRealtime: true, StreamUrl: "http://b.example.com/live.mp3"},
+		},
+	}
+	c.ResolveAudio(context.Background(), &audio)
+
+	want := []struct {
+		url         string
+		hasPlaylist bool
+	}{
+		{"http://a.example.com/live.mp3", false},
+		{"http://b.example.com/live.mp3", false},
+		{ts.URL + "/missing.m3u", true},
+	}
+	if len(audio.Streams) != len(want) {
+		t.Fatalf("Expected %d streams, got %+v", len(want), audio.Streams)
+	}
+	for i, w := range want {
+		st := audio.Streams[i]
+		if st.StreamUrl != w.url || st.HasPlaylist != w.hasPlaylist {
+			t.Errorf("Stream %d: expected %s (hasPlaylist=%v), got %s (hasPlaylist=%v)", i, w.url, w.hasPlaylist, st.StreamUrl, st.HasPlaylist)
+		}
+		if !st.IsRealtime {
+			t.Errorf("Stream %d: expected realtime flag to be kept", i)
+		}
+	}
+	if audio.StreamUrl != "http://a.example.com/live.mp3" || audio.HasPlaylist {
+		t.Errorf("Expected audio to point at first direct stream, got %s (hasPlaylist=%v)", audio.StreamUrl, audio.HasPlaylist)
+	}
+}
+
+func TestResolveStreams_ContentType(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tune":
+			w.Header().Set("Content-Type", "audio/x-scpls")
+			w.Write([]byte("[playlist]\nFile1=" + ts.URL + "/live\n"))
+		case "/asx":
+			w.Header().Set("Content-Type", "video/x-ms-asf; charset=utf-8")
+			w.Write([]byte(`<asx version="3.0"><entry><ref href="http://a.example.com/live.aac"/></entry></asx>`))
+		case "/hls":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg1.aac\n"))
+		default:
+			w.Header().Set("Content-Type", "audio/mpeg")
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil)
+	got := c.ResolveStreams(context.Background(), []models.Stream{
+		{StreamUrl: ts.URL + "/tune?id=s12345"},
+		{StreamUrl: ts.URL + "/asx"},
+		{StreamUrl: ts.URL + "/hls?token=1"},
+	})
+
+	want := []struct {
+		url         string
+		hasPlaylist bool
+	}{
+		{ts.URL + "/live", false},
+		{"http://a.example.com/live.aac", false},
+		{ts.URL + "/hls?token=1", true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d streams, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].StreamUrl != w.url || got[i].HasPlaylist != w.hasPlaylist {
+			t.Errorf("Stream %d: expected %s (hasPlaylist=%v), got %s (hasPlaylist=%v)", i, w.url, w.hasPlaylist, got[i].StreamUrl, got[i].HasPlaylist)
+		}
+	}
+}
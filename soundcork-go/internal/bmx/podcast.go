@@ -0,0 +1,119 @@
+package bmx
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// maxEpisodePages limits how many OPML pages are fetched for a show.
+const maxEpisodePages = 10
+
+type episode struct {
+	ID   string
+	Name string
+}
+
+type opmlOutline struct {
+	Type     string        `xml:"type,attr"`
+	Text     string        `xml:"text,attr"`
+	URL      string        `xml:"URL,attr"`
+	Key      string        `xml:"key,attr"`
+	Item     string        `xml:"item,attr"`
+	GuideID  string        `xml:"guide_id,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// showForEpisode returns the show an episode belongs to. Show IDs are
+// returned as they are.
+func (c *Client) showForEpisode(ctx context.Context, id string) (showID string, showTitle string, err error) {
+	if strings.HasPrefix(id, "p") {
+		return id, "", nil
+	}
+
+	body, err := c.describe(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	var opml struct {
+		Body struct {
+			Outline struct {
+				Topic struct {
+					ShowTitle string `xml:"show_title"`
+					ShowID    string `xml:"show_id"`
+				} `xml:"topic"`
+			} `xml:"outline"`
+		} `xml:"body"`
+	}
+	if err := xml.Unmarshal(body, &opml); err != nil {
+		return "", "", err
+	}
+
+	topic := opml.Body.Outline.Topic
+	if topic.ShowID == "" {
+		return "", "", fmt.Errorf("no show found for %s", id)
+	}
+	return topic.ShowID, topic.ShowTitle, nil
+}
+
+// showEpisodes lists the episodes of a show, following the OPML "next" links
+// for up to maxEpisodePages pages.
+func (c *Client) showEpisodes(ctx context.Context, showID string) ([]episode, error) {
+	var episodes []episode
+	path := fmt.Sprintf(TuneInBrowsePath, url.QueryEscape(showID))
+
+	for page := 0; page < maxEpisodePages && path != ""; page++ {
+		body, err := c.get(ctx, path)
+		if err != nil {
+			if page == 0 {
+				return nil, err
+			}
+			log.Printf("Failed to fetch page %d of show %s: %v", page+1, showID, err)
+			break
+		}
+
+		var opml struct {
+			Body struct {
+				Outlines []opmlOutline `xml:"outline"`
+			} `xml:"body"`
+		}
+		if err := xml.Unmarshal(body, &opml); err != nil {
+			return nil, err
+		}
+
+		var next string
+		episodes, next = collectEpisodes(opml.Body.Outlines, episodes)
+
+		path = ""
+		if next != "" {
+			// Next links point at the public host; keep using the configured one.
+			if u, err := url.Parse(next); err == nil {
+				path = u.RequestURI()
+			}
+		}
+	}
+
+	return episodes, nil
+}
+
+func collectEpisodes(outlines []opmlOutline, episodes []episode) ([]episode, string) {
+	var next string
+	for _, o := range outlines {
+		switch {
+		case o.Item == "topic" && o.GuideID != "":
+			episodes = append(episodes, episode{ID: o.GuideID, Name: o.Text})
+		case o.Type == "link" && strings.HasPrefix(o.Key, "next"):
+			next = o.URL
+		}
+		var nested string
+		episodes, nested = collectEpisodes(o.Outlines, episodes)
+		if nested != "" {
+			next = nested
+		}
+	}
+	return episodes, next
+}
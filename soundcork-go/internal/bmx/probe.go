@@ -0,0 +1,133 @@
+package bmx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// StreamRecorder keeps stream probe results across lookups and restarts.
+type StreamRecorder interface {
+	RecordStreamProbes(results map[string]bool) error
+	GetStreamStats() (map[string]models.StreamStats, error)
+}
+
+// ProbeStreams checks every candidate stream and reorders them so that
+// reachable streams come first, ranked by their recorded success rate.
+// The original order is kept among equally ranked streams. Without a
+// ProbeTimeout the streams are returned unchanged.
+func (c *Client) ProbeStreams(ctx context.Context, streams []models.Stream) []models.Stream {
+	if c.ProbeTimeout <= 0 || len(streams) == 0 {
+		return streams
+	}
+
+	reachable := make([]bool, len(streams))
+	var wg sync.WaitGroup
+	for i, st := range streams {
+		wg.Add(1)
+		go func(i int, streamURL string) {
+			defer wg.Done()
+			if err := c.probeStream(ctx, streamURL); err != nil {
+				log.Printf("Stream probe for %s failed: %v", streamURL, err)
+				return
+			}
+			reachable[i] = true
+		}(i, st.StreamUrl)
+	}
+	wg.Wait()
+
+	results := make(map[string]bool, len(streams))
+	for i, st := range streams {
+		results[st.StreamUrl] = reachable[i]
+	}
+
+	var stats map[string]models.StreamStats
+	if c.Recorder != nil {
+		if err := c.Recorder.RecordStreamProbes(results); err != nil {
+			log.Printf("Failed to record stream probes: %v", err)
+		}
+		var err error
+		if stats, err = c.Recorder.GetStreamStats(); err != nil {
+			log.Printf("Failed to load stream stats: %v", err)
+		}
+	}
+
+	ordered := make([]models.Stream, len(streams))
+	copy(ordered, streams)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, rj := results[ordered[i].StreamUrl], results[ordered[j].StreamUrl]
+		if ri != rj {
+			return ri
+		}
+		return streamScore(stats[ordered[i].StreamUrl]) > streamScore(stats[ordered[j].StreamUrl])
+	})
+	return ordered
+}
+
+// probeStream requests the first bytes of a stream and checks that the
+// response looks like audio, without downloading more than the headers.
+func (c *Client) probeStream(ctx context.Context, streamURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.ProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", "bytes=0-")
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// SHOUTcast v1 answers with an "ICY 200 OK" status line, which
+		// net/http rejects although the stream itself is fine.
+		if strings.Contains(err.Error(), `"ICY"`) {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("stream returned %s", resp.Status)
+	}
+
+	for name := range resp.Header {
+		if strings.HasPrefix(strings.ToLower(name), "icy-") {
+			return nil
+		}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !isStreamMediaType(mediaType) {
+		return fmt.Errorf("unexpected content type %q", contentType)
+	}
+	return nil
+}
+
+// streamScore is the smoothed success rate of a stream, so that unknown
+// streams rank between reliable and failing ones.
+func streamScore(stats models.StreamStats) float64 {
+	return float64(stats.Successes+1) / float64(stats.Successes+stats.Failures+2)
+}
+
+func isStreamMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return true
+	case mediaType == "application/ogg",
+		mediaType == "application/vnd.apple.mpegurl",
+		mediaType == "application/x-mpegurl",
+		mediaType == "application/octet-stream":
+		return true
+	}
+	return false
+}
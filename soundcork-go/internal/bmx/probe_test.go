@@ -0,0 +1,88 @@
+package bmx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+type memoryRecorder struct {
+	stats map[string]models.StreamStats
+}
+
+func (m *memoryRecorder) RecordStreamProbes(results map[string]bool) error {
+	for streamURL, ok := range results {
+		st := m.stats[streamURL]
+		if ok {
+			st.Successes++
+		} else {
+			st.Failures++
+		}
+		m.stats[streamURL] = st
+	}
+	return nil
+}
+
+func (m *memoryRecorder) GetStreamStats() (map[string]models.StreamStats, error) {
+	return m.stats, nil
+}
+
+func TestProbeStreams(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dead":
+			http.Error(w, "gone", http.StatusNotFound)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		case "/icy":
+			w.Header().Set("icy-name", "Test Radio")
+			w.Write([]byte{0})
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+			w.Header().Set("Content-Type", "audio/mpeg")
+		case "/flaky", "/steady":
+			w.Header().Set("Content-Type", "audio/aac")
+			w.WriteHeader(http.StatusPartialContent)
+		default:
+			w.Header().Set("Content-Type", "audio/mpeg")
+		}
+	}))
+	defer ts.Close()
+
+	streams := []models.Stream{
+		{StreamUrl: ts.URL + "/dead"},
+		{StreamUrl: ts.URL + "/html"},
+		{StreamUrl: ts.URL + "/slow"},
+		{StreamUrl: ts.URL + "/flaky"},
+		{StreamUrl: ts.URL + "/steady"},
+		{StreamUrl: ts.URL + "/icy"},
+	}
+
+	c := NewClient(ts.URL, nil)
+	if got := c.ProbeStreams(context.Background(), streams); got[0].StreamUrl != ts.URL+"/dead" {
+		t.Errorf("Expected order to be kept without ProbeTimeout, got %s first", got[0].StreamUrl)
+	}
+
+	recorder := &memoryRecorder{stats: map[string]models.StreamStats{
+		ts.URL + "/flaky": {Successes: 1, Failures: 5},
+	}}
+	c.ProbeTimeout = 100 * time.Millisecond
+	c.Recorder = recorder
+
+	got := c.ProbeStreams(context.Background(), streams)
+	want := []string{"/steady", "/icy", "/flaky", "/dead", "/html", "/slow"}
+	for i, w := range want {
+		if got[i].StreamUrl != ts.URL+w {
+			t.Errorf("Position %d: expected %s, got %s", i, w, got[i].StreamUrl)
+		}
+	}
+
+	if recorder.stats[ts.URL+"/dead"].Failures != 1 || recorder.stats[ts.URL+"/icy"].Successes != 1 {
+		t.Errorf("Expected probe results to be recorded, got %+v", recorder.stats)
+	}
+}
@@ -0,0 +1,209 @@
+package bmx
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/atomicfile"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// defaultServices is the registry served to speakers unless overridden.
+// It is based on soundcork/bmx_services.json of the Python server, but links
+// LOCAL_INTERNET_RADIO to bmx_navigate for the station library, which only
+// this server serves.
+//
+//go:embed bmx_services.json
+var defaultServices []byte
+
+const (
+	// BmxServerPlaceholder is replaced with the public server URL in registry URLs.
+	BmxServerPlaceholder = "{BMX_SERVER}"
+	// MediaServerPlaceholder is replaced with the URL of the media directory.
+	MediaServerPlaceholder = "{MEDIA_SERVER}"
+)
+
+// RegistryConfig is the editable form of the BMX service registry. URLs keep
+// their placeholders; Disabled lists services (by ID name) hidden from speakers.
+type RegistryConfig struct {
+	Registry models.BmxResponse `json:"registry"`
+	Disabled []string           `json:"disabled"`
+}
+
+// Registry holds the BMX services announced to speakers.
+type Registry struct {
+	mu     sync.RWMutex
+	config RegistryConfig
+	path   string
+}
+
+// NewRegistry creates a registry with the embedded default services. If path
+// is set, overrides are loaded from and saved to that file. An error loading
+// overrides leaves the defaults in place.
+func NewRegistry(path string) (*Registry, error) {
+	var defaults models.BmxResponse
+	if err := json.Unmarshal(defaultServices, &defaults); err != nil {
+		return nil, fmt.Errorf("malformed embedded BMX services: %w", err)
+	}
+
+	r := &Registry{
+		config: RegistryConfig{Registry: defaults, Disabled: []string{}},
+		path:   path,
+	}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+
+	var config RegistryConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return r, fmt.Errorf("malformed BMX services at %s: %w", path, err)
+	}
+	if err := ValidateRegistry(config); err != nil {
+		return r, fmt.Errorf("invalid BMX services at %s: %w", path, err)
+	}
+	r.config = config
+	return r, nil
+}
+
+// ValidateRegistry checks that every service can be addressed by a speaker
+// and that disabled services exist.
+func ValidateRegistry(config RegistryConfig) error {
+	if len(config.Registry.BmxServices) == 0 {
+		return fmt.Errorf("at least one service is required")
+	}
+
+	names := make(map[string]bool)
+	values := make(map[int]bool)
+	for i, svc := range config.Registry.BmxServices {
+		if svc.ID.Name == "" || svc.ID.Value <= 0 {
+			return fmt.Errorf("service %d: id name and positive id value are required", i)
+		}
+		if names[svc.ID.Name] || values[svc.ID.Value] {
+			return fmt.Errorf("service %s: duplicate id", svc.ID.Name)
+		}
+		names[svc.ID.Name] = true
+		values[svc.ID.Value] = true
+
+		if svc.BaseUrl == "" {
+			return fmt.Errorf("service %s: baseUrl is required", svc.ID.Name)
+		}
+		if len(svc.StreamTypes) == 0 {
+			return fmt.Errorf("service %s: at least one stream type is required", svc.ID.Name)
+		}
+	}
+
+	for _, name := range config.Disabled {
+		if !names[name] {
+			return fmt.Errorf("cannot disable unknown service %s", name)
+		}
+	}
+	return nil
+}
+
+// Config returns the editable registry configuration.
+func (r *Registry) Config() RegistryConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	config := r.config
+	config.Registry.BmxServices = append([]models.Service(nil), r.config.Registry.BmxServices...)
+	config.Disabled = append([]string{}, r.config.Disabled...)
+	return config
+}
+
+// Update validates and replaces the registry configuration, saving it if the
+// registry was created with a path.
+func (r *Registry) Update(config RegistryConfig) error {
+	if err := ValidateRegistry(config); err != nil {
+		return err
+	}
+	if config.Disabled == nil {
+		config.Disabled = []string{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path != "" {
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := atomicfile.WriteFile(r.path, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	r.config = config
+	return nil
+}
+
+// Services returns the enabled services as announced to speakers, with the
+// placeholders replaced for the given server URL.
+func (r *Registry) Services(serverURL string) models.BmxResponse {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	replacer := strings.NewReplacer(
+		BmxServerPlaceholder, serverURL,
+		MediaServerPlaceholder, serverURL+"/media",
+	)
+
+	disabled := make(map[string]bool)
+	for _, name := range r.config.Disabled {
+		disabled[name] = true
+	}
+
+	resp := r.config.Registry
+	resp.Links = expandLinks(resp.Links, replacer)
+	resp.BmxServices = []models.Service{}
+	for _, svc := range r.config.Registry.BmxServices {
+		if disabled[svc.ID.Name] {
+			continue
+		}
+		svc.Links = expandLinks(svc.Links, replacer)
+		svc.BaseUrl = replacer.Replace(svc.BaseUrl)
+		svc.SignupUrl = replacer.Replace(svc.SignupUrl)
+		icons := &svc.Assets.Icons
+		icons.DefaultAlbumArt = replacer.Replace(icons.DefaultAlbumArt)
+		icons.LargeSvg = replacer.Replace(icons.LargeSvg)
+		icons.MonochromePng = replacer.Replace(icons.MonochromePng)
+		icons.MonochromeSvg = replacer.Replace(icons.MonochromeSvg)
+		icons.SmallSvg = replacer.Replace(icons.SmallSvg)
+		resp.BmxServices = append(resp.BmxServices, svc)
+	}
+	return resp
+}
+
+// expandLinks returns a copy of links with placeholders replaced in every href.
+func expandLinks(links *models.Links, replacer *strings.Replacer) *models.Links {
+	if links == nil {
+		return nil
+	}
+	expanded := *links
+	for _, link := range []**models.Link{
+		&expanded.BmxLogout, &expanded.BmxNavigate, &expanded.BmxServicesAvailability,
+		&expanded.BmxToken, &expanded.Self, &expanded.BmxAvailability, &expanded.BmxReporting,
+		&expanded.BmxFavorite, &expanded.BmxNowPlaying, &expanded.BmxTrack, &expanded.BmxPlayback,
+	} {
+		if *link != nil {
+			l := **link
+			l.Href = replacer.Replace(l.Href)
+			*link = &l
+		}
+	}
+	return &expanded
+}
@@ -0,0 +1,95 @@
+package bmx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryDefaults(t *testing.T) {
+	r, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	resp := r.Services("http://soundcork.local:8000/")
+	if len(resp.BmxServices) != 4 {
+		t.Fatalf("Expected 4 default services, got %d", len(resp.BmxServices))
+	}
+
+	tunein := resp.BmxServices[0]
+	if tunein.ID.Name != "TUNEIN" || tunein.BaseUrl != "http://soundcork.local:8000/bmx/tunein" {
+		t.Errorf("Unexpected TuneIn service %s at %s", tunein.ID.Name, tunein.BaseUrl)
+	}
+	if tunein.Assets.Icons.SmallSvg != "http://soundcork.local:8000/media/tunein-smallSvg.svg" {
+		t.Errorf("Unexpected icon URL %s", tunein.Assets.Icons.SmallSvg)
+	}
+	for _, svc := range resp.BmxServices {
+		if svc.Links != nil && svc.Links.BmxToken != nil && strings.Contains(svc.Links.BmxToken.Href, "{") {
+			t.Errorf("Service %s still has placeholder in token link %s", svc.ID.Name, svc.Links.BmxToken.Href)
+		}
+	}
+
+	// The stored configuration keeps its placeholders.
+	if cfg := r.Config(); cfg.Registry.BmxServices[0].BaseUrl != BmxServerPlaceholder+"/bmx/tunein" {
+		t.Errorf("Expected placeholder in config, got %s", cfg.Registry.BmxServices[0].BaseUrl)
+	}
+}
+
+func TestRegistryUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bmx_services.json")
+	r, err := NewRegistry(path)
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	cfg := r.Config()
+	cfg.Disabled = []string{"SIRIUSXM_EVEREST", "RADIOPLAYER"}
+	if err := r.Update(cfg); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if n := len(r.Services("http://localhost:8000").BmxServices); n != 2 {
+		t.Errorf("Expected 2 enabled services, got %d", n)
+	}
+
+	reloaded, err := NewRegistry(path)
+	if err != nil {
+		t.Fatalf("Reloading registry failed: %v", err)
+	}
+	if n := len(reloaded.Services("http://localhost:8000").BmxServices); n != 2 {
+		t.Errorf("Expected disabled services to persist, got %d enabled", n)
+	}
+
+	invalid := r.Config()
+	invalid.Disabled = []string{"UNKNOWN"}
+	if err := r.Update(invalid); err == nil {
+		t.Error("Expected error disabling unknown service")
+	}
+	invalid = r.Config()
+	invalid.Registry.BmxServices[1].ID.Value = invalid.Registry.BmxServices[0].ID.Value
+	if err := r.Update(invalid); err == nil {
+		t.Error("Expected error for duplicate service id")
+	}
+	invalid = r.Config()
+	invalid.Registry.BmxServices[0].BaseUrl = ""
+	if err := r.Update(invalid); err == nil {
+		t.Error("Expected error for missing baseUrl")
+	}
+	if n := len(r.Services("http://localhost:8000").BmxServices); n != 2 {
+		t.Errorf("Expected rejected updates to leave registry unchanged, got %d enabled", n)
+	}
+}
+
+func TestRegistryMalformedOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bmx_services.json")
+	os.WriteFile(path, []byte("{not json"), 0644)
+
+	r, err := NewRegistry(path)
+	if err == nil {
+		t.Error("Expected error for malformed overrides")
+	}
+	if r == nil || len(r.Services("http://localhost:8000").BmxServices) != 4 {
+		t.Error("Expected defaults to be used when overrides are malformed")
+	}
+}
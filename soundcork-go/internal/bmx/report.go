@@ -0,0 +1,76 @@
+package bmx
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// ReportInterval is the number of seconds the speaker should wait before reporting again.
+const ReportInterval = 1800
+
+// OnDemandReportInterval is used instead of ReportInterval for on-demand streams,
+// so that resume positions stay reasonably current.
+const OnDemandReportInterval = 60
+
+// TuneInReport converts a playback report from the speaker into a device event and
+// builds the response the speaker expects. The query carries the values from the
+// bmx_reporting link (stream_id, guide_id, listen_id, stream_type).
+func TuneInReport(query url.Values, report models.BmxReportRequest) (*models.DeviceEvent, *models.BmxReportResponse) {
+	now := time.Now()
+
+	eventTime := now.Format(time.RFC3339)
+	if report.TimeStamp != "" {
+		eventTime = report.TimeStamp
+	}
+
+	eventType := "tunein-report"
+	if report.EventType != "" {
+		eventType = "tunein-" + strings.ToLower(report.EventType)
+	}
+
+	event := &models.DeviceEvent{
+		Type:     eventType,
+		Time:     eventTime,
+		MonoTime: now.UnixNano() / int64(time.Millisecond),
+		Data: map[string]interface{}{
+			"source":        "TUNEIN",
+			"eventType":     report.EventType,
+			"reason":        report.Reason,
+			"timeIntoTrack": report.TimeIntoTrack,
+			"playbackDelay": report.PlaybackDelay,
+			"guideId":       query.Get("guide_id"),
+			"streamId":      query.Get("stream_id"),
+			"listenId":      query.Get("listen_id"),
+			"streamType":    query.Get("stream_type"),
+		},
+	}
+
+	// The speaker does not schedule a follow-up report after playback stopped.
+	if strings.EqualFold(report.EventType, "STOP") {
+		return event, &models.BmxReportResponse{}
+	}
+
+	selfQS := url.Values{}
+	selfQS.Set("stream_id", query.Get("stream_id"))
+	selfQS.Set("guide_id", query.Get("guide_id"))
+	selfQS.Set("listen_id", query.Get("listen_id"))
+	selfQS.Set("last_titt", strconv.Itoa(report.TimeIntoTrack))
+	selfQS.Set("duration_balance", "0")
+	selfQS.Set("stream_type", query.Get("stream_type"))
+
+	response := &models.BmxReportResponse{
+		Links: &models.Links{
+			Self: &models.Link{Href: "/v1/report?" + selfQS.Encode()},
+		},
+		NextReportIn: ReportInterval,
+	}
+	if query.Get("stream_type") == "onDemand" {
+		response.NextReportIn = OnDemandReportInterval
+	}
+
+	return event, response
+}
@@ -0,0 +1,68 @@
+package bmx
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestTuneInReport(t *testing.T) {
+	query := url.Values{}
+	query.Set("stream_id", "e3342")
+	query.Set("guide_id", "s12345")
+	query.Set("listen_id", "3432432423")
+	query.Set("stream_type", "liveRadio")
+
+	t.Run("START", func(t *testing.T) {
+		event, resp := TuneInReport(query, models.BmxReportRequest{
+			TimeStamp:     "2025-10-31T05:38:55+0000",
+			EventType:     "START",
+			Reason:        "USER_SELECT_PLAYABLE",
+			TimeIntoTrack: 42,
+			PlaybackDelay: 6664,
+		})
+
+		if event.Type != "tunein-start" {
+			t.Errorf("Expected event type tunein-start, got %s", event.Type)
+		}
+		if event.Time != "2025-10-31T05:38:55+0000" {
+			t.Errorf("Expected payload timestamp, got %s", event.Time)
+		}
+		if event.Data["guideId"] != "s12345" {
+			t.Errorf("Expected guideId s12345, got %v", event.Data["guideId"])
+		}
+
+		if resp.NextReportIn != ReportInterval {
+			t.Errorf("Expected nextReportIn %d, got %d", ReportInterval, resp.NextReportIn)
+		}
+		if resp.Links == nil || !strings.Contains(resp.Links.Self.Href, "last_titt=42") {
+			t.Errorf("Unexpected self link: %+v", resp.Links)
+		}
+	})
+
+	t.Run("onDemand", func(t *testing.T) {
+		onDemand := url.Values{}
+		onDemand.Set("guide_id", "t98765")
+		onDemand.Set("stream_type", "onDemand")
+		_, resp := TuneInReport(onDemand, models.BmxReportRequest{EventType: "START"})
+		if resp.NextReportIn != OnDemandReportInterval {
+			t.Errorf("Expected nextReportIn %d for on-demand streams, got %d", OnDemandReportInterval, resp.NextReportIn)
+		}
+	})
+
+	t.Run("STOP", func(t *testing.T) {
+		event, resp := TuneInReport(query, models.BmxReportRequest{EventType: "STOP", Reason: "USER_STOP"})
+
+		if event.Type != "tunein-stop" {
+			t.Errorf("Expected event type tunein-stop, got %s", event.Type)
+		}
+		if event.Time == "" {
+			t.Error("Expected event time to default to now")
+		}
+		if resp.Links != nil || resp.NextReportIn != 0 {
+			t.Errorf("Expected empty response for STOP, got %+v", resp)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package bmx
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// ResumeCompletionMargin is how close to the end, in seconds, an episode
+// counts as played completely.
+const ResumeCompletionMargin = 30
+
+// ResumePosition applies a playback report to the stored position of an
+// episode. STOP reports usually carry no timeIntoTrack, so the position is
+// then advanced by the time played since the previous report. A report without
+// timeIntoTrack never moves the position back, as the START report of another
+// speaker picking up the episode has none either. It returns false once the
+// episode has been played to the end.
+func ResumePosition(pos models.PlaybackPosition, report models.BmxReportRequest, now time.Time) (models.PlaybackPosition, bool) {
+	stop := strings.EqualFold(report.EventType, "STOP")
+
+	switch {
+	case report.TimeIntoTrack > 0:
+		pos.Position = report.TimeIntoTrack
+	case stop && pos.Playing:
+		if last, err := time.Parse(time.RFC3339, pos.UpdatedOn); err == nil && now.After(last) {
+			pos.Position += int(now.Sub(last).Seconds())
+		}
+	}
+
+	pos.Playing = !stop
+	pos.UpdatedOn = now.UTC().Format(time.RFC3339)
+
+	if pos.Duration > 0 && pos.Position >= pos.Duration-ResumeCompletionMargin {
+		return pos, false
+	}
+	return pos, true
+}
@@ -0,0 +1,53 @@
+package bmx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestResumePosition(t *testing.T) {
+	start := time.Date(2025, 10, 31, 5, 0, 0, 0, time.UTC)
+	pos := models.PlaybackPosition{EpisodeID: "t98765", Duration: 1800}
+
+	pos, inProgress := ResumePosition(pos, models.BmxReportRequest{EventType: "START", TimeIntoTrack: 300}, start)
+	if !inProgress || pos.Position != 300 || !pos.Playing {
+		t.Fatalf("Unexpected position after START: %+v", pos)
+	}
+
+	// STOP without timeIntoTrack advances by the time played since START.
+	pos, inProgress = ResumePosition(pos, models.BmxReportRequest{EventType: "STOP", Reason: "USER_STOP"}, start.Add(2*time.Minute))
+	if !inProgress || pos.Position != 420 || pos.Playing {
+		t.Fatalf("Unexpected position after STOP: %+v", pos)
+	}
+
+	// A second STOP does not advance a paused episode.
+	pos, _ = ResumePosition(pos, models.BmxReportRequest{EventType: "STOP"}, start.Add(time.Hour))
+	if pos.Position != 420 {
+		t.Errorf("Expected paused position to stay at 420, got %d", pos.Position)
+	}
+
+	if _, inProgress = ResumePosition(pos, models.BmxReportRequest{EventType: "START", TimeIntoTrack: 1790}, start.Add(2*time.Hour)); inProgress {
+		t.Error("Expected episode near its end to count as completed")
+	}
+}
+
+func TestResumePosition_OtherSpeaker(t *testing.T) {
+	start := time.Date(2025, 10, 31, 5, 0, 0, 0, time.UTC)
+	pos := models.PlaybackPosition{EpisodeID: "t98765", Duration: 1800, DeviceID: "KITCHEN"}
+
+	pos, _ = ResumePosition(pos, models.BmxReportRequest{EventType: "STOP", TimeIntoTrack: 600}, start)
+
+	// The START report of the next speaker carries no timeIntoTrack.
+	pos.DeviceID = "BEDROOM"
+	pos, inProgress := ResumePosition(pos, models.BmxReportRequest{EventType: "START"}, start.Add(time.Hour))
+	if !inProgress || pos.Position != 600 || !pos.Playing {
+		t.Fatalf("Expected START without timeIntoTrack to keep position 600, got %+v", pos)
+	}
+
+	pos, _ = ResumePosition(pos, models.BmxReportRequest{EventType: "STOP"}, start.Add(time.Hour+time.Minute))
+	if pos.Position != 660 {
+		t.Errorf("Expected position to advance from 600 to 660, got %d", pos.Position)
+	}
+}
@@ -0,0 +1,45 @@
+package bmx
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/jwt"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// AccessTokenTTL is how long an access token issued by TuneInToken stays valid.
+const AccessTokenTTL = time.Hour
+
+// ErrInvalidTokenRequest is wrapped by the errors of TuneInToken for requests
+// the speaker has to correct.
+var ErrInvalidTokenRequest = errors.New("invalid token request")
+
+// TuneInToken answers a token refresh from the speaker with a locally signed access token.
+// The refresh token sent by the speaker was issued by Bose and cannot be verified, so it is
+// only required to be present; the new token is bound to the requesting device instead.
+func TuneInToken(secret []byte, deviceID string, req models.BmxTokenRequest) (*models.BmxTokenResponse, error) {
+	if req.GrantType != "" && req.GrantType != "refresh_token" {
+		return nil, fmt.Errorf("%w: unsupported grant_type %q", ErrInvalidTokenRequest, req.GrantType)
+	}
+	if req.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: missing refresh_token", ErrInvalidTokenRequest)
+	}
+
+	token, err := SignAccessToken(secret, deviceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BmxTokenResponse{AccessToken: token}, nil
+}
+
+// SignAccessToken creates an HS256 JWT for the given subject, valid for AccessTokenTTL from now.
+func SignAccessToken(secret []byte, subject string, now time.Time) (string, error) {
+	return jwt.Sign(secret, jwt.Claims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+	})
+}
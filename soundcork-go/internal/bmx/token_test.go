@@ -0,0 +1,73 @@
+package bmx
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestSignAccessToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+
+	token, err := SignAccessToken(secret, "DEVICE1", now)
+	if err != nil {
+		t.Fatalf("SignAccessToken failed: %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 JWT segments, got %d", len(parts))
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if parts[2] != base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Error("Signature does not match")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+	}
+	json.Unmarshal(payload, &claims)
+	if claims.Sub != "DEVICE1" {
+		t.Errorf("Expected sub DEVICE1, got %s", claims.Sub)
+	}
+	if claims.Exp != now.Add(AccessTokenTTL).Unix() {
+		t.Errorf("Unexpected exp %d", claims.Exp)
+	}
+}
+
+func TestTuneInToken(t *testing.T) {
+	if _, err := TuneInToken(nil, "DEVICE1", models.BmxTokenRequest{RefreshToken: "abc"}); err == nil || errors.Is(err, ErrInvalidTokenRequest) {
+		t.Errorf("Expected signing error without secret, got %v", err)
+	}
+
+	if _, err := TuneInToken([]byte("secret"), "DEVICE1", models.BmxTokenRequest{GrantType: "password", RefreshToken: "abc"}); !errors.Is(err, ErrInvalidTokenRequest) {
+		t.Errorf("Expected ErrInvalidTokenRequest for unsupported grant type, got %v", err)
+	}
+
+	if _, err := TuneInToken([]byte("secret"), "DEVICE1", models.BmxTokenRequest{GrantType: "refresh_token"}); !errors.Is(err, ErrInvalidTokenRequest) {
+		t.Errorf("Expected ErrInvalidTokenRequest without refresh_token, got %v", err)
+	}
+
+	resp, err := TuneInToken([]byte("secret"), "DEVICE1", models.BmxTokenRequest{GrantType: "refresh_token", RefreshToken: "abc"})
+	if err != nil {
+		t.Fatalf("TuneInToken failed: %v", err)
+	}
+	if resp.AccessToken == "" {
+		t.Error("Expected access token")
+	}
+}
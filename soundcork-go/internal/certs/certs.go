@@ -0,0 +1,210 @@
+// Package certs keeps a local certificate authority and issues the server
+// certificate soundcork serves HTTPS with, so speakers can keep their https
+// service URLs.
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	CAFile         = "ca.pem"
+	CAKeyFile      = "ca-key.pem"
+	ServerCertFile = "server.pem"
+	ServerKeyFile  = "server-key.pem"
+
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 825 * 24 * time.Hour
+	// renewBefore is how long before it expires the server certificate is
+	// issued again.
+	renewBefore = 30 * 24 * time.Hour
+	// keyBits is the size of the RSA keys. RSA is used rather than ECDSA as
+	// the TLS stacks of older speaker firmware are not known to support it.
+	keyBits = 2048
+)
+
+// CA is the local certificate authority.
+type CA struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	key     *rsa.PrivateKey
+}
+
+// LoadOrCreateCA loads the CA from dir or creates it there.
+func LoadOrCreateCA(dir string) (*CA, error) {
+	certPath, keyPath := filepath.Join(dir, CAFile), filepath.Join(dir, CAKeyFile)
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported CA key in %s", keyPath)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+		certPEM, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, err
+		}
+		return &CA{Cert: cert, CertPEM: certPEM, key: key}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load CA from %s: %w", dir, err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "soundcork local CA", Organization: []string{"soundcork"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ca := &CA{Cert: cert, CertPEM: encodeCert(der), key: key}
+	if err := writePair(dir, CAFile, ca.CertPEM, CAKeyFile, key); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the CA certificate.
+func (ca *CA) Fingerprint() string {
+	sum := sha256.Sum256(ca.Cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ServerCert returns the server certificate and key files in dir for hosts
+// (names or IP addresses). An existing certificate is reused while it is
+// issued by ca, covers all hosts and does not expire soon.
+func (ca *CA) ServerCert(dir string, hosts []string, now time.Time) (certFile, keyFile string, err error) {
+	if len(hosts) == 0 {
+		return "", "", errors.New("no hosts for the server certificate")
+	}
+	certFile, keyFile = filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile)
+	if ca.validServerCert(certFile, keyFile, hosts, now) {
+		return certFile, keyFile, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"soundcork"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := writePair(dir, ServerCertFile, encodeCert(der), ServerKeyFile, key); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+func (ca *CA) validServerCert(certFile, keyFile string, hosts []string, now time.Time) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || cert.CheckSignatureFrom(ca.Cert) != nil || now.Add(renewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, h := range hosts {
+		if cert.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// writePair writes a certificate and its key, keeping the key private.
+func writePair(dir, certName string, certPEM []byte, keyName string, key *rsa.PrivateKey) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(filepath.Join(dir, keyName), keyPEM, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, certName), certPEM, 0644)
+}
+
+// Hosts returns the names a server certificate is needed for: serverHost
+// without its port and extra, trimmed and without empty entries or duplicates.
+func Hosts(serverHost string, extra []string) []string {
+	hosts := []string{}
+	if h, _, err := net.SplitHostPort(serverHost); err == nil {
+		serverHost = h
+	}
+	for _, h := range append([]string{serverHost}, extra...) {
+		h = strings.TrimSpace(h)
+		if h != "" && !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,94 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA failed: %v", err)
+	}
+	if !ca.Cert.IsCA || len(ca.Fingerprint()) != 64 {
+		t.Errorf("Unexpected CA %+v", ca.Cert.Subject)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, CAKeyFile)); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the CA key to be private, got %v", info.Mode())
+	}
+
+	loaded, err := LoadOrCreateCA(dir)
+	if err != nil || !bytes.Equal(loaded.CertPEM, ca.CertPEM) {
+		t.Errorf("Expected the existing CA to be loaded (%v)", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, CAKeyFile), []byte("garbage"), 0600)
+	if _, err := LoadOrCreateCA(dir); err == nil {
+		t.Error("Expected error for a broken CA key")
+	}
+}
+
+func TestServerCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, _ := LoadOrCreateCA(dir)
+	now := time.Now()
+
+	if _, _, err := ca.ServerCert(dir, nil, now); err == nil {
+		t.Error("Expected error without hosts")
+	}
+
+	certFile, keyFile, err := ca.ServerCert(dir, []string{"soundcork.local", "192.168.1.10"}, now)
+	if err != nil {
+		t.Fatalf("ServerCert failed: %v", err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(pair.Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM)
+	for _, host := range []string{"soundcork.local", "192.168.1.10"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Expected the certificate to be valid for %s: %v", host, err)
+		}
+	}
+
+	// Reused while it covers the hosts
+	ca.ServerCert(dir, []string{"soundcork.local"}, now)
+	if again, _ := tls.LoadX509KeyPair(certFile, keyFile); !reflect.DeepEqual(again.Certificate[0], pair.Certificate[0]) {
+		t.Error("Expected the certificate to be reused")
+	}
+
+	for name, hosts := range map[string][]string{
+		"NewHost": {"soundcork.local", "streaming.bose.com"},
+		"Expiry":  {"soundcork.local"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			issuedAt := now
+			if name == "Expiry" {
+				issuedAt = now.Add(serverValidity)
+			}
+			ca.ServerCert(dir, hosts, issuedAt)
+			renewed, _ := tls.LoadX509KeyPair(certFile, keyFile)
+			if reflect.DeepEqual(renewed.Certificate[0], pair.Certificate[0]) {
+				t.Error("Expected a new certificate")
+			}
+			pair = renewed
+		})
+	}
+}
+
+func TestHosts(t *testing.T) {
+	got := Hosts("soundcork.local:8000", []string{"", "10.0.0.2", " soundcork.local", " speaker.lan ", "  "})
+	if want := []string{"soundcork.local", "10.0.0.2", "speaker.lan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -43,10 +43,18 @@ var Providers = []string{
 
 const (
 	DevicesDir     = "devices"
+	ArchiveDir     = ".archive"
+	StatsDir       = "stats"
+	CacheDir       = "cache"
+	TLSDir         = "tls"
 	DeviceInfoFile = "DeviceInfo.xml"
 	PresetsFile    = "Presets.xml"
 	RecentsFile    = "Recents.xml"
 	SourcesFile    = "Sources.xml"
+	StationsFile   = "Stations.xml"
+	FavoritesFile  = "Favorites.xml"
+	PositionsFile  = "PlaybackPositions.xml"
+	HistoryFile    = "PresetHistory.xml"
 
 	SpeakerHTTPPort            = 8090
 	SpeakerDeviceInfoPath      = "/info"
@@ -54,6 +62,10 @@ const (
 	SpeakerPresetsPath         = "/presets"
 	SpeakerSourcesFileLocation = "/mnt/nv/BoseApp-Persistence/1/Sources.xml"
 
+	// LibraryStationPath is the BMX playback location of a station from the local library,
+	// relative to the LOCAL_INTERNET_RADIO service base URL.
+	LibraryStationPath = "/v1/playback/library/"
+
 	// DateStr is the hardcoded date used in many Bose XML responses
 	DateStr = "2012-09-19T12:43:00.000+00:00"
 )
@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// accountNamePattern keeps account names usable as directory names. Names
+// starting with a dot are reserved, e.g. for the archive, as are the
+// reservedDirs.
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// reservedDirs are directories in the data directory that are no accounts.
+var reservedDirs = []string{constants.StatsDir, constants.CacheDir, constants.TLSDir}
+
+// ValidateAccountName checks that name can be used for a new account.
+func ValidateAccountName(name string) error {
+	if !accountNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid account name %q: use up to 64 letters, digits, '-' and '_'", name)
+	}
+	if slices.Contains(reservedDirs, name) {
+		return fmt.Errorf("invalid account name %q: the name is reserved", name)
+	}
+	return nil
+}
+
+// NewAccount creates an account with empty presets, recents and sources, so
+// that speakers added to it get valid lists right away. It fails with an
+// error wrapping os.ErrExist if the account exists already.
+func NewAccount(s Store, account string) error {
+	if err := ValidateAccountName(account); err != nil {
+		return err
+	}
+	defer s.LockAccount(account)()
+
+	if s.AccountExists(account) {
+		return fmt.Errorf("account %s: %w", account, os.ErrExist)
+	}
+	if err := s.CreateAccount(account); err != nil {
+		return err
+	}
+	if err := s.SavePresets(account, []models.Preset{}); err != nil {
+		return err
+	}
+	if err := s.SaveRecents(account, []models.Recent{}); err != nil {
+		return err
+	}
+	return s.SaveConfiguredSources(account, []models.ConfiguredSource{})
+}
+
+// archivePath returns the directory a deleted account is moved to, below the
+// archive directory in root: <root>/.archive/<timestamp>/<account>. It
+// keeps the layout of the data directory, so an archived account can be
+// restored by moving it back.
+func archivePath(root, account string) string {
+	return filepath.Join(root, constants.ArchiveDir, time.Now().UTC().Format("20060102-150405"), account)
+}
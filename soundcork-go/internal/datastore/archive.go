@@ -0,0 +1,403 @@
+package datastore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// ArchiveVersion is the version of the archive format written by
+// ExportArchive. ImportArchive accepts archives up to this version.
+const ArchiveVersion = 1
+
+const (
+	manifestFile = "manifest.json"
+
+	// maxArchiveSize limits the unpacked size of an imported archive.
+	maxArchiveSize = 1 << 30
+)
+
+// ErrInvalidArchive is wrapped by the errors of ImportArchive for archives
+// that cannot be imported. Existing data is left untouched in that case.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ArchiveManifest describes the content of an export archive. It is stored as
+// manifest.json next to the data files, which use the layout of the XML data
+// directory.
+type ArchiveManifest struct {
+	Version   int              `json:"version"`
+	CreatedAt string           `json:"created_at"`
+	Accounts  []ArchiveAccount `json:"accounts"`
+	Stations  int              `json:"stations"`
+	Streams   int              `json:"streams"`
+}
+
+// ArchiveAccount is an account listed in an ArchiveManifest.
+type ArchiveAccount struct {
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+// ImportMode selects how ImportArchive treats existing data.
+type ImportMode string
+
+const (
+	// ImportMerge replaces the accounts contained in the archive and keeps
+	// all others. Stations and stream stats are merged by ID and URL.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace deletes all accounts before importing, and replaces the
+	// stations and stream stats.
+	ImportReplace ImportMode = "replace"
+)
+
+// ExportArchive writes a tar.gz archive of all data in src that Copy copies,
+// plus the stream stats, to w. Usage and error reports and device events are
+// not exported.
+func ExportArchive(w io.Writer, src Store) (*ArchiveManifest, error) {
+	dir, err := os.MkdirTemp("", "soundcork-export-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	staged := NewDataStore(dir)
+	if err := Copy(staged, src); err != nil {
+		return nil, err
+	}
+	streams, err := src.GetStreamStats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream stats: %w", err)
+	}
+	if len(streams) > 0 {
+		if err := staged.SaveStreamStats(streams); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := newManifest(staged, len(streams))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeArchive(w, dir, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func newManifest(s Store, streams int) (*ArchiveManifest, error) {
+	manifest := &ArchiveManifest{
+		Version:   ArchiveVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Accounts:  []ArchiveAccount{},
+		Streams:   streams,
+	}
+
+	accounts, err := s.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		devices, err := s.ListAccountDevices(account)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if devices == nil {
+			devices = []string{}
+		}
+		manifest.Accounts = append(manifest.Accounts, ArchiveAccount{Name: account, Devices: devices})
+	}
+
+	stations, err := s.GetStations()
+	if err != nil {
+		return nil, err
+	}
+	manifest.Stations = len(stations)
+	return manifest, nil
+}
+
+// writeArchive packs the manifest, followed by the files in dir without their
+// backup copies.
+func writeArchive(w io.Writer, dir string, manifest *ArchiveManifest) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    manifestFile,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir || strings.HasSuffix(p, BackupSuffix) {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportArchive reads an archive written by ExportArchive from r into dst.
+// The whole archive is read and validated before dst is changed. Accounts
+// replaced or deleted by the import are archived by DeleteAccount, so they
+// can be restored.
+func ImportArchive(dst Store, r io.Reader, mode ImportMode) (*ArchiveManifest, error) {
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, fmt.Errorf("unknown import mode %q", mode)
+	}
+
+	dir, err := os.MkdirTemp("", "soundcork-import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := extractArchive(r, dir); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	manifest, staged, err := loadArchive(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	if err := applyArchive(dst, staged, manifest, mode); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func extractArchive(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("path %q outside of the archive", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxArchiveSize {
+				return fmt.Errorf("archive exceeds %d bytes", maxArchiveSize)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := extractFile(target, tr, hdr.Size); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %q", hdr.Name)
+		}
+	}
+}
+
+func extractFile(target string, r io.Reader, size int64) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadArchive checks the manifest of an extracted archive and reads all of
+// its data into memory, so that malformed files are found before importing.
+func loadArchive(dir string) (*ArchiveManifest, *MemoryStore, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("missing %s", manifestFile)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("malformed %s: %v", manifestFile, err)
+	}
+	if manifest.Version < 1 || manifest.Version > ArchiveVersion {
+		return nil, nil, fmt.Errorf("unsupported version %d, expected up to %d", manifest.Version, ArchiveVersion)
+	}
+
+	src := NewDataStore(dir)
+	accounts, err := src.ListAccounts()
+	if err != nil {
+		return nil, nil, err
+	}
+	listed := make(map[string]bool)
+	for _, account := range manifest.Accounts {
+		listed[account.Name] = true
+	}
+	for _, account := range accounts {
+		if err := ValidateAccountName(account); err != nil {
+			return nil, nil, err
+		}
+		if !listed[account] {
+			return nil, nil, fmt.Errorf("account %s is not listed in the manifest", account)
+		}
+		delete(listed, account)
+	}
+	for account := range listed {
+		return nil, nil, fmt.Errorf("account %s of the manifest is missing", account)
+	}
+
+	staged := NewMemoryStore()
+	if err := Copy(staged, src); err != nil {
+		return nil, nil, err
+	}
+	streams, err := src.GetStreamStats()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := staged.SaveStreamStats(streams); err != nil {
+		return nil, nil, err
+	}
+	return &manifest, staged, nil
+}
+
+func applyArchive(dst Store, staged *MemoryStore, manifest *ArchiveManifest, mode ImportMode) error {
+	existing, err := dst.ListAccounts()
+	if err != nil {
+		return err
+	}
+	imported := make(map[string]bool)
+	for _, account := range manifest.Accounts {
+		imported[account.Name] = true
+	}
+	for _, account := range existing {
+		if mode == ImportReplace || imported[account] {
+			if err := dst.DeleteAccount(account); err != nil {
+				return fmt.Errorf("account %s: %w", account, err)
+			}
+		}
+	}
+	for _, account := range manifest.Accounts {
+		if err := copyAccount(dst, staged, account.Name); err != nil {
+			return fmt.Errorf("account %s: %w", account.Name, err)
+		}
+	}
+
+	stations, _ := staged.GetStations()
+	if mode == ImportMerge {
+		current, err := dst.GetStations()
+		if err != nil {
+			return err
+		}
+		stations = mergeStations(current, stations)
+	}
+	if err := dst.SaveStations(stations); err != nil {
+		return fmt.Errorf("failed to save stations: %w", err)
+	}
+
+	streams, _ := staged.GetStreamStats()
+	if mode == ImportMerge {
+		current, err := dst.GetStreamStats()
+		if err != nil {
+			return err
+		}
+		for streamURL, st := range streams {
+			current[streamURL] = st
+		}
+		streams = current
+	}
+	if err := dst.SaveStreamStats(streams); err != nil {
+		return fmt.Errorf("failed to save stream stats: %w", err)
+	}
+	return nil
+}
+
+// mergeStations replaces the stations in current with those of the same ID
+// in imported and appends the others.
+func mergeStations(current, imported []models.Station) []models.Station {
+	index := make(map[string]int)
+	for i, st := range current {
+		index[st.ID] = i
+	}
+	for _, st := range imported {
+		if i, ok := index[st.ID]; ok {
+			current[i] = st
+		} else {
+			index[st.ID] = len(current)
+			current = append(current, st)
+		}
+	}
+	return current
+}
@@ -0,0 +1,169 @@
+package datastore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func newArchiveSource(t *testing.T) Store {
+	src := NewDataStore(t.TempDir())
+	if err := src.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	src.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1", Name: "Kitchen"})
+	src.SavePresets("acc1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}})
+	src.SaveRecents("acc1", []models.Recent{})
+	src.SaveConfiguredSources("acc1", []models.ConfiguredSource{{ID: "100001", SourceKeyType: "TUNEIN"}})
+	src.SaveDevicePresets("acc1", "dev1", []models.Preset{{ContentItem: models.ContentItem{ID: "2", Name: "Jazz"}}})
+	src.AddPresetVersion("acc1", models.PresetVersion{DeviceID: "dev1", PresetNumber: 2})
+	src.SaveStations([]models.Station{{ID: "1", Name: "Radio One"}})
+	src.RecordStreamProbes(map[string]bool{"http://one.example.com": true})
+	// A backup copy, which is not exported
+	src.SaveRecents("acc1", []models.Recent{{ContentItem: models.ContentItem{ID: "3"}}})
+	return src
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	manifest, err := ExportArchive(&buf, newArchiveSource(t))
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+	if manifest.Version != ArchiveVersion || len(manifest.Accounts) != 2 || manifest.Stations != 1 || manifest.Streams != 1 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+
+	gz, _ := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestFile {
+		t.Fatalf("Expected the manifest first, got %+v (%v)", hdr, err)
+	}
+	for hdr, err = tr.Next(); err == nil; hdr, err = tr.Next() {
+		if filepath.Ext(hdr.Name) == BackupSuffix {
+			t.Errorf("Expected no backup copies, got %s", hdr.Name)
+		}
+	}
+
+	dst, err := NewSQLiteStore(filepath.Join(t.TempDir(), "soundcork.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer dst.Close()
+	if _, err := ImportArchive(dst, bytes.NewReader(buf.Bytes()), ImportReplace); err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+
+	if info, err := dst.GetDeviceInfo("acc1", "dev1"); err != nil || info.Name != "Kitchen" {
+		t.Errorf("Unexpected device info %+v (%v)", info, err)
+	}
+	if presets, _ := dst.GetDevicePresets("acc1", "dev1"); len(presets) != 1 || presets[0].Name != "Jazz" {
+		t.Errorf("Unexpected device presets %+v", presets)
+	}
+	if recents, _ := dst.GetRecents("acc1"); len(recents) != 1 || recents[0].ID != "3" {
+		t.Errorf("Unexpected recents %+v", recents)
+	}
+	if sources, _ := dst.GetConfiguredSources("acc1"); len(sources) != 1 {
+		t.Errorf("Unexpected sources %+v", sources)
+	}
+	if history, _ := dst.GetPresetHistory("acc1", ""); len(history) != 1 {
+		t.Errorf("Unexpected preset history %+v", history)
+	}
+	if stations, _ := dst.GetStations(); len(stations) != 1 || stations[0].Name != "Radio One" {
+		t.Errorf("Unexpected stations %+v", stations)
+	}
+	if streams, _ := dst.GetStreamStats(); streams["http://one.example.com"].Successes != 1 {
+		t.Errorf("Unexpected stream stats %+v", streams)
+	}
+}
+
+func TestImportArchive_Modes(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := ExportArchive(&buf, newArchiveSource(t)); err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	newTarget := func() Store {
+		dst := NewDataStore(t.TempDir())
+		dst.SaveDeviceInfo("acc1", "old", &models.DeviceInfo{DeviceID: "old"})
+		dst.SaveDeviceInfo("acc2", "dev2", &models.DeviceInfo{DeviceID: "dev2"})
+		dst.SaveStations([]models.Station{{ID: "1", Name: "Old One"}, {ID: "2", Name: "Radio Two"}})
+		return dst
+	}
+
+	dst := newTarget()
+	if _, err := ImportArchive(dst, bytes.NewReader(buf.Bytes()), ImportMerge); err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+	if devices, _ := dst.ListAccountDevices("acc1"); len(devices) != 1 || devices[0] != "dev1" {
+		t.Errorf("Expected acc1 to be replaced, got devices %v", devices)
+	}
+	if !dst.AccountExists("acc2") {
+		t.Error("Expected acc2 to be kept when merging")
+	}
+	if stations, _ := dst.GetStations(); len(stations) != 2 || stations[0].Name != "Radio One" {
+		t.Errorf("Expected merged stations, got %+v", stations)
+	}
+
+	dst = newTarget()
+	if _, err := ImportArchive(dst, bytes.NewReader(buf.Bytes()), ImportReplace); err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+	if dst.AccountExists("acc2") {
+		t.Error("Expected acc2 to be removed when replacing")
+	}
+	if stations, _ := dst.GetStations(); len(stations) != 1 {
+		t.Errorf("Expected replaced stations, got %+v", stations)
+	}
+}
+
+func TestImportArchive_Invalid(t *testing.T) {
+	archive := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, content := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(content))
+		}
+		tw.Close()
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	tests := map[string][]byte{
+		"not gzip":         []byte("hello"),
+		"missing manifest": archive(map[string]string{"acc1/Presets.xml": "<presets/>"}),
+		"future version":   archive(map[string]string{manifestFile: `{"version": 99}`}),
+		"path traversal":   archive(map[string]string{manifestFile: `{"version": 1}`, "../evil": "x"}),
+		"unlisted account": archive(map[string]string{manifestFile: `{"version": 1}`, "acc1/Presets.xml": "<presets/>"}),
+		"malformed data": archive(map[string]string{
+			manifestFile:       `{"version": 1, "accounts": [{"name": "acc1"}]}`,
+			"acc1/Presets.xml": "<presets",
+		}),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst := NewMemoryStore()
+			dst.SaveDeviceInfo("keep", "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+			_, err := ImportArchive(dst, bytes.NewReader(data), ImportReplace)
+			if !errors.Is(err, ErrInvalidArchive) {
+				t.Fatalf("Expected ErrInvalidArchive, got %v", err)
+			}
+			if !dst.AccountExists("keep") {
+				t.Error("Expected existing data to be untouched")
+			}
+		})
+	}
+
+	if _, err := ImportArchive(NewMemoryStore(), bytes.NewReader(nil), "append"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,94 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/atomicfile"
+)
+
+// BackupSuffix is appended to the name of an XML file to get its last good copy.
+const BackupSuffix = ".bak"
+
+// writeFileAtomic replaces path with data so that readers, and a crash at any
+// point, see either the old or the new content but never a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	return atomicfile.WriteFile(path, data, 0644)
+}
+
+// writeXMLFile marshals v into path. Before replacing a well-formed file, it is
+// kept as the backup that readXMLFile falls back to.
+func writeXMLFile(path string, v interface{}) error {
+	data, err := xml.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if old, err := os.ReadFile(path); err == nil && wellFormedXML(old) {
+		if err := writeFileAtomic(path+BackupSuffix, old); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	if err := writeFileAtomic(path, append([]byte(xml.Header), data...)); err != nil {
+		return err
+	}
+	return advanceFileETag(path)
+}
+
+// readXMLFile unmarshals path into v. If path is malformed, for example after
+// a crash of an older version, the backup is used and restored instead. what
+// names the content in errors, e.g. "presets".
+func readXMLFile(path string, v interface{}, what string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = xml.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+	malformed := fmt.Errorf("malformed %s XML at %s: %w", what, path, err)
+
+	backup, berr := os.ReadFile(path + BackupSuffix)
+	if berr != nil {
+		return malformed
+	}
+	// Drop whatever the failed attempt decoded before retrying
+	reflect.ValueOf(v).Elem().SetZero()
+	if err := xml.Unmarshal(backup, v); err != nil {
+		return malformed
+	}
+
+	log.Printf("Warning: %v; recovered from %s%s", malformed, filepath.Base(path), BackupSuffix)
+	if err := writeFileAtomic(path, backup); err != nil {
+		log.Printf("Warning: failed to restore %s from backup: %v", path, err)
+	}
+	return nil
+}
+
+// wellFormedXML reports whether data is a complete XML document.
+func wellFormedXML(data []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	seenElement := false
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return seenElement
+		}
+		if err != nil {
+			return false
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			seenElement = true
+		}
+	}
+}
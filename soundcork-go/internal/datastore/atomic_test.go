@@ -0,0 +1,127 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestAtomicWrites(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+	account := "acc1"
+	path := filepath.Join(ds.AccountDir(account), constants.PresetsFile)
+
+	first := []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "First"}}}
+	second := []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Second"}}}
+	if err := ds.SavePresets(account, first); err != nil {
+		t.Fatalf("SavePresets failed: %v", err)
+	}
+	if _, err := os.Stat(path + BackupSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup after the first write, got %v", err)
+	}
+	if err := ds.SavePresets(account, second); err != nil {
+		t.Fatalf("SavePresets failed: %v", err)
+	}
+
+	backup, err := os.ReadFile(path + BackupSuffix)
+	if err != nil || !strings.Contains(string(backup), "First") {
+		t.Errorf("Expected the previous presets as backup, got %q (%v)", backup, err)
+	}
+
+	entries, _ := os.ReadDir(ds.AccountDir(account))
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("Temporary file %s left behind", e.Name())
+		}
+	}
+
+	t.Run("Recover truncated file from backup", func(t *testing.T) {
+		data, _ := os.ReadFile(path)
+		os.WriteFile(path, data[:len(data)/2], 0644)
+
+		presets, err := ds.GetPresets(account)
+		if err != nil {
+			t.Fatalf("Expected recovery from backup, got %v", err)
+		}
+		if len(presets) != 1 || presets[0].Name != "First" {
+			t.Errorf("Expected presets from backup, got %+v", presets)
+		}
+
+		// The restored file is read without falling back again
+		os.Remove(path + BackupSuffix)
+		if _, err := ds.GetPresets(account); err != nil {
+			t.Errorf("Expected restored file to be readable, got %v", err)
+		}
+	})
+
+	t.Run("Malformed backup is not kept", func(t *testing.T) {
+		os.WriteFile(path, []byte("<presets><preset"), 0644)
+		if err := ds.SavePresets(account, second); err != nil {
+			t.Fatalf("SavePresets failed: %v", err)
+		}
+		if _, err := os.Stat(path + BackupSuffix); !os.IsNotExist(err) {
+			t.Errorf("Expected truncated file not to become the backup, got %v", err)
+		}
+	})
+
+	t.Run("Malformed without backup", func(t *testing.T) {
+		os.Remove(path + BackupSuffix)
+		os.WriteFile(path, []byte("<presets><preset"), 0644)
+		_, err := ds.GetPresets(account)
+		if err == nil || !strings.Contains(err.Error(), "malformed presets XML") {
+			t.Errorf("Expected malformed error, got %v", err)
+		}
+	})
+}
+
+func TestLockAccount(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+
+	unlock := ds.LockAccount("acc1")
+	locked := make(chan struct{})
+	go func() {
+		defer ds.LockAccount("acc1")()
+		close(locked)
+	}()
+
+	// Other accounts are not blocked
+	ds.LockAccount("acc2")()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected second lock of acc1 to wait")
+	default:
+	}
+	unlock()
+	<-locked
+}
+
+func TestLockAccount_AcrossStores(t *testing.T) {
+	// Two stores on the same directory stand in for two processes
+	dir := t.TempDir()
+	ds, other := NewDataStore(dir), NewDataStore(dir)
+
+	unlock := ds.LockAccount("acc1")
+	locked := make(chan struct{})
+	go func() {
+		defer other.LockAccount("acc1")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected the lock of the other store to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	if accounts, _ := ds.ListAccounts(); len(accounts) != 0 {
+		t.Errorf("Expected the lock files not to show up as accounts, got %v", accounts)
+	}
+}
@@ -0,0 +1,149 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Copy copies all accounts with their devices, presets, recents, sources,
+// preset history, favorites and playback positions, and the station library,
+// from src to dst. It is used to import the XML tree into another backend and
+// to export it back. Existing data in dst is overwritten. Stats and device
+// events are not copied.
+func Copy(dst, src Store) error {
+	accounts, err := src.ListAccounts()
+	if err != nil {
+		return fmt.Errorf("failed to list accounts: %w", err)
+	}
+
+	for _, account := range accounts {
+		if err := copyAccount(dst, src, account); err != nil {
+			return fmt.Errorf("account %s: %w", account, err)
+		}
+	}
+
+	stations, err := src.GetStations()
+	if err != nil {
+		return fmt.Errorf("failed to read stations: %w", err)
+	}
+	if len(stations) > 0 {
+		if err := dst.SaveStations(stations); err != nil {
+			return fmt.Errorf("failed to save stations: %w", err)
+		}
+	}
+	return nil
+}
+
+func copyAccount(dst, src Store, account string) error {
+	if err := dst.CreateAccount(account); err != nil {
+		return err
+	}
+
+	devices, err := src.ListAccountDevices(account)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, device := range devices {
+		info, err := src.GetDeviceInfo(account, device)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("device %s: %w", device, err)
+		}
+		if err := dst.SaveDeviceInfo(account, device, info); err != nil {
+			return fmt.Errorf("device %s: %w", device, err)
+		}
+	}
+
+	// Presets, recents and sources are only copied when they exist, so that
+	// a missing file stays missing.
+	if presets, err := src.GetPresets(account); err == nil {
+		if err := dst.SavePresets(account, presets); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if recents, err := src.GetRecents(account); err == nil {
+		if err := dst.SaveRecents(account, recents); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if sources, err := src.GetConfiguredSources(account); err == nil {
+		if err := dst.SaveConfiguredSources(account, sources); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, device := range devices {
+		if err := copyDeviceLists(dst, src, account, device); err != nil {
+			return fmt.Errorf("device %s: %w", device, err)
+		}
+	}
+
+	history, err := src.GetPresetHistory(account, "")
+	if err != nil {
+		return err
+	}
+	for _, v := range slices.Backward(history) {
+		if _, err := dst.AddPresetVersion(account, v); err != nil {
+			return err
+		}
+	}
+
+	favorites, err := src.GetFavorites(account)
+	if err != nil {
+		return err
+	}
+	if len(favorites) > 0 {
+		if err := dst.SaveFavorites(account, favorites); err != nil {
+			return err
+		}
+	}
+
+	positions, err := src.GetPlaybackPositions(account)
+	if err != nil {
+		return err
+	}
+	for _, p := range positions {
+		if err := dst.SavePlaybackPosition(account, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDeviceLists copies the presets and recents a device has of its own. A
+// device using those of its account keeps following the account in dst.
+func copyDeviceLists(dst, src Store, account, device string) error {
+	ownPresets, ownRecents := src.HasOwnDeviceLists(account, device)
+	if ownPresets {
+		presets, err := src.GetDevicePresets(account, device)
+		if err != nil {
+			return err
+		}
+		if err := dst.SaveDevicePresets(account, device, presets); err != nil {
+			return err
+		}
+	}
+
+	if ownRecents {
+		recents, err := src.GetDeviceRecents(account, device)
+		if err != nil {
+			return err
+		}
+		if err := dst.SaveDeviceRecents(account, device, recents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,15 +16,14 @@ import (
 	"github.com/gesellix/bose-soundtouch-api/internal/models"
 )
 
-func exists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
-
+// DataStore is the Store keeping accounts as XML files on disk, in the same
+// layout as the speaker and the original Bose servers.
 type DataStore struct {
-	DataDir      string
-	eventMutex   sync.RWMutex
-	deviceEvents map[string][]models.DeviceEvent
+	DataDir string
+	eventLog
+	keyLocks
+	sourceSecrets
+	statsMutex sync.Mutex
 }
 
 func NewDataStore(dataDir string) *DataStore {
@@ -30,8 +31,7 @@ func NewDataStore(dataDir string) *DataStore {
 		dataDir = "data"
 	}
 	return &DataStore{
-		DataDir:      dataDir,
-		deviceEvents: make(map[string][]models.DeviceEvent),
+		DataDir: dataDir,
 	}
 }
 
@@ -49,117 +49,124 @@ func (ds *DataStore) AccountDeviceDir(account, device string) string {
 
 func (ds *DataStore) GetDeviceInfo(account, device string) (*models.DeviceInfo, error) {
 	path := filepath.Join(ds.AccountDeviceDir(account, device), constants.DeviceInfoFile)
-	data, err := os.ReadFile(path)
+	return ds.parseDeviceInfoFile(path)
+}
+
+// CreateAccount creates the directories of an account if they are missing.
+func (ds *DataStore) CreateAccount(account string) error {
+	return os.MkdirAll(ds.AccountDevicesDir(account), 0755)
+}
+
+// ListAccounts returns the names of all accounts.
+func (ds *DataStore) ListAccounts() ([]string, error) {
+	entries, err := os.ReadDir(ds.DataDir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var info struct {
-		XMLName    xml.Name `xml:"info"`
-		DeviceID   string   `xml:"deviceID,attr"`
-		Name       string   `xml:"name"`
-		Type       string   `xml:"type"`
-		ModuleType string   `xml:"moduleType"`
-		Components []struct {
-			Category        string `xml:"componentCategory"`
-			SoftwareVersion string `xml:"softwareVersion"`
-			SerialNumber    string `xml:"serialNumber"`
-		} `xml:"components>component"`
-		NetworkInfo []struct {
-			Type      string `xml:"type,attr"`
-			IPAddress string `xml:"ipAddress"`
-		} `xml:"networkInfo"`
-	}
-
-	if err := xml.Unmarshal(data, &info); err != nil {
-		return nil, err
+	accounts := []string{}
+	for _, entry := range entries {
+		// Hidden directories like the archive and the reserved ones are no accounts
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !slices.Contains(reservedDirs, entry.Name()) {
+			accounts = append(accounts, entry.Name())
+		}
 	}
+	return accounts, nil
+}
+
+// AccountExists reports whether the directory of an account exists.
+func (ds *DataStore) AccountExists(account string) bool {
+	info, err := os.Stat(ds.AccountDir(account))
+	return err == nil && info.IsDir()
+}
 
-	deviceInfo := &models.DeviceInfo{
-		DeviceID:    info.DeviceID,
-		ProductCode: fmt.Sprintf("%s %s", info.Type, info.ModuleType),
-		Name:        info.Name,
+// RenameAccount moves the directory of an account to a new name.
+func (ds *DataStore) RenameAccount(account, newName string) error {
+	defer ds.lockAccounts(account, newName)()
+
+	if !ds.AccountExists(account) {
+		return fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	if ds.AccountExists(newName) {
+		return fmt.Errorf("account %s: %w", newName, os.ErrExist)
 	}
+	return os.Rename(ds.AccountDir(account), ds.AccountDir(newName))
+}
 
-	for _, comp := range info.Components {
-		if comp.Category == "SCM" {
-			deviceInfo.FirmwareVersion = comp.SoftwareVersion
-			deviceInfo.DeviceSerialNumber = comp.SerialNumber
-		} else if comp.Category == "PackagedProduct" {
-			deviceInfo.ProductSerialNumber = comp.SerialNumber
-		}
+// DeleteAccount moves the directory of an account into the archive.
+func (ds *DataStore) DeleteAccount(account string) error {
+	defer ds.LockAccount(account)()
+
+	if !ds.AccountExists(account) {
+		return fmt.Errorf("account %s: %w", account, os.ErrNotExist)
 	}
+	target := archivePath(ds.DataDir, account)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(ds.AccountDir(account), target)
+}
 
-	for _, net := range info.NetworkInfo {
-		if net.Type == "SCM" {
-			deviceInfo.IPAddress = net.IPAddress
-		}
+// ListAccountDevices returns the IDs of the devices registered with an account.
+func (ds *DataStore) ListAccountDevices(account string) ([]string, error) {
+	entries, err := os.ReadDir(ds.AccountDevicesDir(account))
+	if err != nil {
+		return nil, err
 	}
 
-	return deviceInfo, nil
+	devices := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			devices = append(devices, entry.Name())
+		}
+	}
+	return devices, nil
 }
 
 // ListAllDevices returns a list of all devices in all accounts.
 func (ds *DataStore) ListAllDevices() ([]models.DeviceInfo, error) {
-	dirs := []string{}
-	if exists(ds.DataDir) {
-		dirs = append(dirs, ds.DataDir)
-	}
-	// Also check soundcork-go/data if it's different and exists
-	altDir := "soundcork-go/data"
-	if ds.DataDir != altDir && exists(altDir) {
-		dirs = append(dirs, altDir)
-	}
-
-	if len(dirs) == 0 {
-		return []models.DeviceInfo{}, nil
+	accounts, err := ds.ListAccounts()
+	if err != nil {
+		return nil, err
 	}
 
 	devices := []models.DeviceInfo{}
 	seenIDs := make(map[string]bool)
 
-	for _, dir := range dirs {
-		accounts, err := os.ReadDir(dir)
+	for _, acc := range accounts {
+		devicesDir := ds.AccountDevicesDir(acc)
+		deviceEntries, err := os.ReadDir(devicesDir)
 		if err != nil {
 			continue
 		}
 
-		for _, acc := range accounts {
-			if !acc.IsDir() {
-				continue
-			}
-
-			devicesDir := filepath.Join(dir, acc.Name(), constants.DevicesDir)
-			deviceEntries, err := os.ReadDir(devicesDir)
-			if err != nil {
-				continue
-			}
+		for _, dev := range deviceEntries {
+			var info *models.DeviceInfo
+			var err error
 
-			for _, dev := range deviceEntries {
-				var info *models.DeviceInfo
-				var err error
-
-				if !dev.IsDir() {
-					if dev.Name() == constants.DeviceInfoFile {
-						// Special case for DeviceInfo.xml directly in devicesDir
-						path := filepath.Join(devicesDir, constants.DeviceInfoFile)
-						info, err = ds.parseDeviceInfoFile(path)
-					}
-				} else {
-					path := filepath.Join(devicesDir, dev.Name(), constants.DeviceInfoFile)
+			if !dev.IsDir() {
+				if dev.Name() == constants.DeviceInfoFile {
+					// Special case for DeviceInfo.xml directly in devicesDir
+					path := filepath.Join(devicesDir, constants.DeviceInfoFile)
 					info, err = ds.parseDeviceInfoFile(path)
 				}
+			} else {
+				path := filepath.Join(devicesDir, dev.Name(), constants.DeviceInfoFile)
+				info, err = ds.parseDeviceInfoFile(path)
+			}
 
-				if err == nil && info != nil {
-					// Use a unique key for deduplication
-					key := info.DeviceID
-					if key == "" {
-						key = info.IPAddress
-					}
-					if !seenIDs[key] {
-						devices = append(devices, *info)
-						seenIDs[key] = true
-					}
+			if err == nil && info != nil {
+				// Use a unique key for deduplication
+				key := info.DeviceID
+				if key == "" {
+					key = info.IPAddress
+				}
+				if !seenIDs[key] {
+					devices = append(devices, *info)
+					seenIDs[key] = true
 				}
 			}
 		}
@@ -168,109 +175,94 @@ func (ds *DataStore) ListAllDevices() ([]models.DeviceInfo, error) {
 	return devices, nil
 }
 
-func (ds *DataStore) parseDeviceInfoFile(path string) (*models.DeviceInfo, error) {
-	data, err := os.ReadFile(path)
+// FindDeviceByIP looks up a known device by its IP address and returns the account it belongs to.
+func (ds *DataStore) FindDeviceByIP(ip string) (string, *models.DeviceInfo, error) {
+	accounts, err := os.ReadDir(ds.DataDir)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	var info struct {
-		XMLName    xml.Name `xml:"info"`
-		DeviceID   string   `xml:"deviceID,attr"`
-		Name       string   `xml:"name"`
-		Type       string   `xml:"type"`
-		ModuleType string   `xml:"moduleType"`
-		Components []struct {
-			Category        string `xml:"componentCategory"`
-			SoftwareVersion string `xml:"softwareVersion"`
-			SerialNumber    string `xml:"serialNumber"`
-		} `xml:"components>component"`
-		NetworkInfo []struct {
-			Type      string `xml:"type,attr"`
-			IPAddress string `xml:"ipAddress"`
-		} `xml:"networkInfo"`
-	}
-
-	if err := xml.Unmarshal(data, &info); err != nil {
-		return nil, err
-	}
-
-	deviceInfo := &models.DeviceInfo{
-		DeviceID:    info.DeviceID,
-		ProductCode: fmt.Sprintf("%s %s", info.Type, info.ModuleType),
-		Name:        info.Name,
-	}
+	for _, acc := range accounts {
+		if !acc.IsDir() {
+			continue
+		}
 
-	for _, comp := range info.Components {
-		if comp.Category == "SCM" {
-			deviceInfo.FirmwareVersion = comp.SoftwareVersion
-			deviceInfo.DeviceSerialNumber = comp.SerialNumber
-		} else if comp.Category == "PackagedProduct" {
-			deviceInfo.ProductSerialNumber = comp.SerialNumber
+		deviceEntries, err := os.ReadDir(ds.AccountDevicesDir(acc.Name()))
+		if err != nil {
+			continue
 		}
-	}
 
-	for _, net := range info.NetworkInfo {
-		if net.Type == "SCM" {
-			deviceInfo.IPAddress = net.IPAddress
+		for _, dev := range deviceEntries {
+			if !dev.IsDir() {
+				continue
+			}
+			path := filepath.Join(ds.AccountDeviceDir(acc.Name(), dev.Name()), constants.DeviceInfoFile)
+			info, err := ds.parseDeviceInfoFile(path)
+			if err != nil {
+				continue
+			}
+			if info.IPAddress == ip {
+				if info.DeviceID == "" {
+					info.DeviceID = dev.Name()
+				}
+				return acc.Name(), info, nil
+			}
 		}
 	}
 
-	return deviceInfo, nil
+	return "", nil, fmt.Errorf("no device known with IP %s", ip)
 }
 
-func (ds *DataStore) GetPresets(account string) ([]models.Preset, error) {
-	path := filepath.Join(ds.AccountDir(account), constants.PresetsFile)
-	data, err := os.ReadFile(path)
-	if err != nil {
+func (ds *DataStore) parseDeviceInfoFile(path string) (*models.DeviceInfo, error) {
+	var info deviceInfoXML
+	if err := readXMLFile(path, &info, "device info"); err != nil {
 		return nil, err
 	}
+	return info.deviceInfo(), nil
+}
 
-	var presetsWrap struct {
-		Presets []struct {
-			ID          string `xml:"id,attr"`
-			CreatedOn   string `xml:"createdOn,attr"`
-			UpdatedOn   string `xml:"updatedOn,attr"`
-			ContentItem struct {
-				Source        string `xml:"source,attr"`
-				Type          string `xml:"type,attr"`
-				Location      string `xml:"location,attr"`
-				SourceAccount string `xml:"sourceAccount,attr"`
-				IsPresetable  string `xml:"isPresetable,attr"`
-				ItemName      string `xml:"itemName"`
-				ContainerArt  string `xml:"containerArt"`
-			} `xml:"ContentItem"`
-		} `xml:"preset"`
-	}
-
-	if err := xml.Unmarshal(data, &presetsWrap); err != nil {
-		return nil, fmt.Errorf("malformed presets XML at %s: %w", path, err)
-	}
-
-	presets := []models.Preset{}
-	for _, p := range presetsWrap.Presets {
-		presets = append(presets, models.Preset{
-			ContentItem: models.ContentItem{
-				ID:            p.ID,
-				Name:          p.ContentItem.ItemName,
-				Source:        p.ContentItem.Source,
-				Type:          p.ContentItem.Type,
-				Location:      p.ContentItem.Location,
-				SourceAccount: p.ContentItem.SourceAccount,
-				IsPresetable:  p.ContentItem.IsPresetable,
-			},
-			ContainerArt: p.ContentItem.ContainerArt,
-			CreatedOn:    p.CreatedOn,
-			UpdatedOn:    p.UpdatedOn,
-		})
+func (ds *DataStore) GetPresets(account string) ([]models.Preset, error) {
+	return readPresetsFile(filepath.Join(ds.AccountDir(account), constants.PresetsFile))
+}
+
+func (ds *DataStore) SavePresets(account string, presets []models.Preset) error {
+	return writePresetsFile(filepath.Join(ds.AccountDir(account), constants.PresetsFile), presets)
+}
+
+// GetDevicePresets returns the presets of a device, or those of its account
+// if the device has none of its own yet.
+func (ds *DataStore) GetDevicePresets(account, device string) ([]models.Preset, error) {
+	presets, err := readPresetsFile(filepath.Join(ds.AccountDeviceDir(account, device), constants.PresetsFile))
+	if os.IsNotExist(err) {
+		return ds.GetPresets(account)
 	}
+	return presets, err
+}
 
-	return presets, nil
+func (ds *DataStore) SaveDevicePresets(account, device string, presets []models.Preset) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	return writePresetsFile(filepath.Join(ds.AccountDeviceDir(account, device), constants.PresetsFile), presets)
 }
 
-func (ds *DataStore) SavePresets(account string, presets []models.Preset) error {
-	path := filepath.Join(ds.AccountDir(account), constants.PresetsFile)
+func (ds *DataStore) HasOwnDeviceLists(account, device string) (presets, recents bool) {
+	dir := ds.AccountDeviceDir(account, device)
+	_, err := os.Stat(filepath.Join(dir, constants.PresetsFile))
+	presets = err == nil
+	_, err = os.Stat(filepath.Join(dir, constants.RecentsFile))
+	return presets, err == nil
+}
+
+func readPresetsFile(path string) ([]models.Preset, error) {
+	var wrap presetsXML
+	if err := readXMLFile(path, &wrap, "presets"); err != nil {
+		return nil, err
+	}
+	return wrap.presets(), nil
+}
 
+func writePresetsFile(path string, presets []models.Preset) error {
 	type PresetXML struct {
 		ID          string `xml:"id,attr"`
 		CreatedOn   string `xml:"createdOn,attr"`
@@ -307,67 +299,43 @@ func (ds *DataStore) SavePresets(account string, presets []models.Preset) error
 		px.Presets = append(px.Presets, pxml)
 	}
 
-	data, err := xml.MarshalIndent(px, "", "    ")
-	if err != nil {
-		return err
-	}
-
-	header := []byte(xml.Header)
-	return os.WriteFile(path, append(header, data...), 0644)
+	return writeXMLFile(path, px)
 }
 
 func (ds *DataStore) GetRecents(account string) ([]models.Recent, error) {
-	path := filepath.Join(ds.AccountDir(account), constants.RecentsFile)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+	return readRecentsFile(filepath.Join(ds.AccountDir(account), constants.RecentsFile))
+}
 
-	var recentsWrap struct {
-		Recents []struct {
-			ID          string `xml:"id,attr"`
-			DeviceID    string `xml:"deviceID,attr"`
-			UtcTime     string `xml:"utcTime,attr"`
-			ContentItem struct {
-				Source        string `xml:"source,attr"`
-				Type          string `xml:"type,attr"`
-				Location      string `xml:"location,attr"`
-				SourceAccount string `xml:"sourceAccount,attr"`
-				IsPresetable  string `xml:"isPresetable,attr"`
-				ItemName      string `xml:"itemName"`
-				ContainerArt  string `xml:"containerArt"`
-			} `xml:"contentItem"`
-		} `xml:"recent"`
-	}
-
-	if err := xml.Unmarshal(data, &recentsWrap); err != nil {
-		return nil, fmt.Errorf("malformed recents XML at %s: %w", path, err)
-	}
-
-	recents := []models.Recent{}
-	for _, r := range recentsWrap.Recents {
-		recents = append(recents, models.Recent{
-			ContentItem: models.ContentItem{
-				ID:            r.ID,
-				Name:          r.ContentItem.ItemName,
-				Source:        r.ContentItem.Source,
-				Type:          r.ContentItem.Type,
-				Location:      r.ContentItem.Location,
-				SourceAccount: r.ContentItem.SourceAccount,
-				IsPresetable:  r.ContentItem.IsPresetable,
-			},
-			DeviceID:     r.DeviceID,
-			UtcTime:      r.UtcTime,
-			ContainerArt: r.ContentItem.ContainerArt,
-		})
+func (ds *DataStore) SaveRecents(account string, recents []models.Recent) error {
+	return writeRecentsFile(filepath.Join(ds.AccountDir(account), constants.RecentsFile), recents)
+}
+
+// GetDeviceRecents returns the recents of a device, or those of its account
+// if the device has none of its own yet.
+func (ds *DataStore) GetDeviceRecents(account, device string) ([]models.Recent, error) {
+	recents, err := readRecentsFile(filepath.Join(ds.AccountDeviceDir(account, device), constants.RecentsFile))
+	if os.IsNotExist(err) {
+		return ds.GetRecents(account)
 	}
+	return recents, err
+}
 
-	return recents, nil
+func (ds *DataStore) SaveDeviceRecents(account, device string, recents []models.Recent) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	return writeRecentsFile(filepath.Join(ds.AccountDeviceDir(account, device), constants.RecentsFile), recents)
 }
 
-func (ds *DataStore) SaveRecents(account string, recents []models.Recent) error {
-	path := filepath.Join(ds.AccountDir(account), constants.RecentsFile)
+func readRecentsFile(path string) ([]models.Recent, error) {
+	var wrap recentsXML
+	if err := readXMLFile(path, &wrap, "recents"); err != nil {
+		return nil, err
+	}
+	return wrap.recents(), nil
+}
 
+func writeRecentsFile(path string, recents []models.Recent) error {
 	type RecentXML struct {
 		ID          string `xml:"id,attr"`
 		DeviceID    string `xml:"deviceID,attr"`
@@ -407,13 +375,7 @@ func (ds *DataStore) SaveRecents(account string, recents []models.Recent) error
 		rx.Recents = append(rx.Recents, rxml)
 	}
 
-	data, err := xml.MarshalIndent(rx, "", "    ")
-	if err != nil {
-		return err
-	}
-
-	header := []byte(xml.Header)
-	return os.WriteFile(path, append(header, data...), 0644)
+	return writeXMLFile(path, rx)
 }
 
 func (ds *DataStore) SaveDeviceInfo(account string, device string, info *models.DeviceInfo) error {
@@ -483,13 +445,7 @@ func (ds *DataStore) SaveDeviceInfo(account string, device string, info *models.
 		},
 	}
 
-	data, err := xml.MarshalIndent(ix, "", "    ")
-	if err != nil {
-		return err
-	}
-
-	header := []byte(xml.Header)
-	return os.WriteFile(path, append(header, data...), 0644)
+	return writeXMLFile(path, ix)
 }
 
 func (ds *DataStore) RemoveDevice(account string, device string) error {
@@ -499,50 +455,18 @@ func (ds *DataStore) RemoveDevice(account string, device string) error {
 
 func (ds *DataStore) GetConfiguredSources(account string) ([]models.ConfiguredSource, error) {
 	path := filepath.Join(ds.AccountDir(account), constants.SourcesFile)
-	data, err := os.ReadFile(path)
-	if err != nil {
+	var wrap sourcesXML
+	if err := readXMLFile(path, &wrap, "sources"); err != nil {
 		return nil, err
 	}
-
-	var sourcesWrap struct {
-		Sources []struct {
-			DisplayName string `xml:"displayName,attr"`
-			ID          string `xml:"id,attr"`
-			Secret      string `xml:"secret,attr"`
-			SecretType  string `xml:"secretType,attr"`
-			SourceKey   struct {
-				Account string `xml:"account,attr"`
-				Type    string `xml:"type,attr"`
-			} `xml:"sourceKey"`
-		} `xml:"source"`
-	}
-
-	if err := xml.Unmarshal(data, &sourcesWrap); err != nil {
-		return nil, fmt.Errorf("malformed sources XML at %s: %w", path, err)
-	}
-
-	var sources []models.ConfiguredSource
-	lastID := 100001
-	for _, s := range sourcesWrap.Sources {
-		id := s.ID
-		if id == "" {
-			id = strconv.Itoa(lastID)
-			lastID++
-		}
-		sources = append(sources, models.ConfiguredSource{
-			DisplayName:      s.DisplayName,
-			ID:               id,
-			Secret:           s.Secret,
-			SecretType:       s.SecretType,
-			SourceKeyType:    s.SourceKey.Type,
-			SourceKeyAccount: s.SourceKey.Account,
-		})
-	}
-
-	return sources, nil
+	return wrap.sources(), nil
 }
 
 func (ds *DataStore) SaveConfiguredSources(account string, sources []models.ConfiguredSource) error {
+	sources, err := ds.sealSources(sources)
+	if err != nil {
+		return err
+	}
 	path := filepath.Join(ds.AccountDir(account), constants.SourcesFile)
 	os.MkdirAll(filepath.Dir(path), 0755)
 
@@ -575,13 +499,7 @@ func (ds *DataStore) SaveConfiguredSources(account string, sources []models.Conf
 		wrap.Sources = append(wrap.Sources, sx)
 	}
 
-	data, err := xml.MarshalIndent(wrap, "", "    ")
-	if err != nil {
-		return err
-	}
-
-	header := []byte(xml.Header)
-	return os.WriteFile(path, append(header, data...), 0644)
+	return writeXMLFile(path, wrap)
 }
 
 func (ds *DataStore) Initialize() error {
@@ -601,20 +519,76 @@ func (ds *DataStore) Initialize() error {
 		return fmt.Errorf("failed to create default devices directory: %w", err)
 	}
 
-	return nil
+	return ds.migrateDeviceLists()
 }
 
-func (ds *DataStore) GetETagForPresets(account string) int64 {
-	path := filepath.Join(ds.AccountDir(account), constants.PresetsFile)
-	info, err := os.Stat(path)
+// migrateDeviceLists gives every registered device its own copy of the
+// presets and recents of its account, which all speakers of an account used
+// to share. The account files stay as the default for devices added later.
+func (ds *DataStore) migrateDeviceLists() error {
+	accounts, err := ds.ListAccounts()
 	if err != nil {
-		return 0
+		return err
 	}
-	return info.ModTime().UnixNano() / int64(time.Millisecond)
+
+	for _, account := range accounts {
+		devices, err := ds.ListAccountDevices(account)
+		if err != nil {
+			continue
+		}
+		for _, device := range devices {
+			deviceDir := ds.AccountDeviceDir(account, device)
+			if _, err := os.Stat(filepath.Join(deviceDir, constants.DeviceInfoFile)); err != nil {
+				continue
+			}
+			for _, file := range []string{constants.PresetsFile, constants.RecentsFile} {
+				target := filepath.Join(deviceDir, file)
+				if _, err := os.Stat(target); err == nil {
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join(ds.AccountDir(account), file))
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if err := writeFileAtomic(target, data); err != nil {
+					return fmt.Errorf("failed to migrate %s to device %s: %w", file, device, err)
+				}
+				log.Printf("Migrated %s of account %s to device %s", file, account, device)
+			}
+		}
+	}
+	return nil
 }
 
-func (ds *DataStore) GetETagForSources(account string) int64 {
-	path := filepath.Join(ds.AccountDir(account), constants.SourcesFile)
+// fileETag returns the modification time of path in milliseconds, or 0 if
+// it does not exist.
+// XML ETags are the modification times of the files in milliseconds. Files
+// written within the same millisecond get their time advanced past the last
+// ETag, so that each write yields a new, increasing ETag like the counters of
+// the other stores.
+var (
+	fileETagMu   sync.Mutex
+	lastFileETag int64
+)
+
+// advanceFileETag gives path, just written, an ETag above all earlier ones.
+func advanceFileETag(path string) error {
+	fileETagMu.Lock()
+	defer fileETagMu.Unlock()
+
+	if etag := fileETag(path); etag > lastFileETag {
+		lastFileETag = etag
+		return nil
+	}
+	lastFileETag++
+	t := time.UnixMilli(lastFileETag)
+	return os.Chtimes(path, t, t)
+}
+
+func fileETag(path string) int64 {
 	info, err := os.Stat(path)
 	if err != nil {
 		return 0
@@ -622,31 +596,49 @@ func (ds *DataStore) GetETagForSources(account string) int64 {
 	return info.ModTime().UnixNano() / int64(time.Millisecond)
 }
 
+func (ds *DataStore) GetETagForPresets(account string) int64 {
+	return fileETag(filepath.Join(ds.AccountDir(account), constants.PresetsFile))
+}
+
+func (ds *DataStore) GetETagForSources(account string) int64 {
+	return fileETag(filepath.Join(ds.AccountDir(account), constants.SourcesFile))
+}
+
 func (ds *DataStore) GetETagForRecents(account string) int64 {
-	path := filepath.Join(ds.AccountDir(account), constants.RecentsFile)
-	info, err := os.Stat(path)
-	if err != nil {
-		return 0
+	return fileETag(filepath.Join(ds.AccountDir(account), constants.RecentsFile))
+}
+
+// GetETagForDevicePresets follows GetDevicePresets in falling back to the account.
+func (ds *DataStore) GetETagForDevicePresets(account, device string) int64 {
+	if etag := fileETag(filepath.Join(ds.AccountDeviceDir(account, device), constants.PresetsFile)); etag != 0 {
+		return etag
 	}
-	return info.ModTime().UnixNano() / int64(time.Millisecond)
+	return ds.GetETagForPresets(account)
 }
 
-func (ds *DataStore) GetETagForAccount(account string) int64 {
-	e1 := ds.GetETagForPresets(account)
-	e2 := ds.GetETagForSources(account)
-	e3 := ds.GetETagForRecents(account)
-	max := e1
-	if e2 > max {
-		max = e2
+// GetETagForDeviceRecents follows GetDeviceRecents in falling back to the account.
+func (ds *DataStore) GetETagForDeviceRecents(account, device string) int64 {
+	if etag := fileETag(filepath.Join(ds.AccountDeviceDir(account, device), constants.RecentsFile)); etag != 0 {
+		return etag
 	}
-	if e3 > max {
-		max = e3
+	return ds.GetETagForRecents(account)
+}
+
+// GetETagForAccount covers everything in the account, including the presets
+// and recents of each device.
+func (ds *DataStore) GetETagForAccount(account string) int64 {
+	etag := max(ds.GetETagForPresets(account), ds.GetETagForSources(account), ds.GetETagForRecents(account))
+
+	devices, _ := ds.ListAccountDevices(account)
+	for _, device := range devices {
+		dir := ds.AccountDeviceDir(account, device)
+		etag = max(etag, fileETag(filepath.Join(dir, constants.PresetsFile)), fileETag(filepath.Join(dir, constants.RecentsFile)))
 	}
-	return max
+	return etag
 }
 
 func (ds *DataStore) SaveUsageStats(stats models.UsageStats) error {
-	dir := filepath.Join(ds.DataDir, "stats", "usage")
+	dir := filepath.Join(ds.DataDir, constants.StatsDir, "usage")
 	os.MkdirAll(dir, 0755)
 	filename := fmt.Sprintf("%d_%s.json", time.Now().UnixNano(), stats.DeviceID)
 	path := filepath.Join(dir, filename)
@@ -658,7 +650,7 @@ func (ds *DataStore) SaveUsageStats(stats models.UsageStats) error {
 }
 
 func (ds *DataStore) SaveErrorStats(stats models.ErrorStats) error {
-	dir := filepath.Join(ds.DataDir, "stats", "error")
+	dir := filepath.Join(ds.DataDir, constants.StatsDir, "error")
 	os.MkdirAll(dir, 0755)
 	filename := fmt.Sprintf("%d_%s.json", time.Now().UnixNano(), stats.DeviceID)
 	path := filepath.Join(dir, filename)
@@ -668,32 +660,3 @@ func (ds *DataStore) SaveErrorStats(stats models.ErrorStats) error {
 	}
 	return os.WriteFile(path, data, 0644)
 }
-
-func (ds *DataStore) AddDeviceEvent(deviceID string, event models.DeviceEvent) {
-	ds.eventMutex.Lock()
-	defer ds.eventMutex.Unlock()
-
-	events := ds.deviceEvents[deviceID]
-	events = append(events, event)
-
-	// Keep only last 100 events
-	if len(events) > 100 {
-		events = events[len(events)-100:]
-	}
-	ds.deviceEvents[deviceID] = events
-}
-
-func (ds *DataStore) GetDeviceEvents(deviceID string) []models.DeviceEvent {
-	ds.eventMutex.RLock()
-	defer ds.eventMutex.RUnlock()
-
-	events, ok := ds.deviceEvents[deviceID]
-	if !ok {
-		return []models.DeviceEvent{}
-	}
-
-	// Return a copy to avoid race conditions if the caller modifies it
-	copiedEvents := make([]models.DeviceEvent, len(events))
-	copy(copiedEvents, events)
-	return copiedEvents
-}
@@ -3,6 +3,7 @@ package datastore
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gesellix/bose-soundtouch-api/internal/models"
@@ -158,6 +159,31 @@ func TestListAllDevices(t *testing.T) {
 	}
 }
 
+func TestFindDeviceByIP(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+
+	info := &models.DeviceInfo{
+		DeviceID:  "DEV1",
+		Name:      "Kitchen",
+		IPAddress: "192.168.1.20",
+	}
+	if err := ds.SaveDeviceInfo("acc1", "DEV1", info); err != nil {
+		t.Fatalf("SaveDeviceInfo failed: %v", err)
+	}
+
+	account, found, err := ds.FindDeviceByIP("192.168.1.20")
+	if err != nil {
+		t.Fatalf("FindDeviceByIP failed: %v", err)
+	}
+	if account != "acc1" || found.DeviceID != "DEV1" {
+		t.Errorf("Expected acc1/DEV1, got %s/%s", account, found.DeviceID)
+	}
+
+	if _, _, err := ds.FindDeviceByIP("10.0.0.1"); err == nil {
+		t.Error("Expected error for unknown IP")
+	}
+}
+
 func TestListAllDevices_EmptyDeviceID(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "soundcork-empty-id-test-*")
 	if err != nil {
@@ -333,3 +359,132 @@ func TestConfiguredSources(t *testing.T) {
 		t.Error("Expected auto-assigned ID for source with empty ID")
 	}
 }
+
+func TestMigrateDeviceLists(t *testing.T) {
+	tempDir := t.TempDir()
+	ds := NewDataStore(tempDir)
+	account := "acc1"
+
+	ds.SaveDeviceInfo(account, "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	ds.SavePresets(account, []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Shared"}}})
+	ds.SaveRecents(account, []models.Recent{{ContentItem: models.ContentItem{ID: "7", Name: "Jazz"}}})
+	// A device that already has its own presets keeps them
+	ds.SaveDeviceInfo(account, "dev2", &models.DeviceInfo{DeviceID: "dev2"})
+	ds.SaveDevicePresets(account, "dev2", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Own"}}})
+
+	if err := ds.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	for _, file := range []string{"Presets.xml", "Recents.xml"} {
+		if _, err := os.Stat(filepath.Join(ds.AccountDeviceDir(account, "dev1"), file)); err != nil {
+			t.Errorf("Expected %s to be migrated to dev1: %v", file, err)
+		}
+		if _, err := os.Stat(filepath.Join(ds.AccountDir(account), file)); err != nil {
+			t.Errorf("Expected account %s to stay in place: %v", file, err)
+		}
+	}
+	presets, _ := ds.GetDevicePresets(account, "dev2")
+	if len(presets) != 1 || presets[0].Name != "Own" {
+		t.Errorf("Expected dev2 to keep its own presets, got %+v", presets)
+	}
+
+	// Migrated lists are independent of the account from now on
+	ds.SavePresets(account, []models.Preset{})
+	presets, _ = ds.GetDevicePresets(account, "dev1")
+	if len(presets) != 1 || presets[0].Name != "Shared" {
+		t.Errorf("Expected migrated presets of dev1, got %+v", presets)
+	}
+}
+
+func TestDeleteAccount_Archives(t *testing.T) {
+	tempDir := t.TempDir()
+	ds := NewDataStore(tempDir)
+	ds.Initialize()
+	ds.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	ds.SavePresets("acc1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}})
+
+	if err := ds.DeleteAccount("acc1"); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+	if _, err := os.Stat(ds.AccountDir("acc1")); !os.IsNotExist(err) {
+		t.Errorf("Expected account directory to be moved, got %v", err)
+	}
+
+	archived, _ := filepath.Glob(filepath.Join(tempDir, ".archive", "*", "acc1", "Presets.xml"))
+	if len(archived) != 1 {
+		t.Fatalf("Expected archived Presets.xml, found %v", archived)
+	}
+	// The archive is not taken for an account
+	accounts, _ := ds.ListAccounts()
+	if len(accounts) != 1 || accounts[0] != "default" {
+		t.Errorf("Expected only the default account, got %v", accounts)
+	}
+}
+
+func TestSourceSecrets_OnDisk(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+	ds.SaveConfiguredSources("acc1", []models.ConfiguredSource{{ID: "1", Secret: "plain-token"}})
+
+	ds.SetSecretBox(newTestSecretBox(t))
+	if _, err := RotateSecrets(ds, nil); err != nil {
+		t.Fatalf("RotateSecrets failed: %v", err)
+	}
+
+	path := filepath.Join(ds.AccountDir("acc1"), "Sources.xml")
+	for _, p := range []string{path, path + BackupSuffix} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", p, err)
+		}
+		if strings.Contains(string(data), "plain-token") {
+			t.Errorf("Expected no plaintext secret in %s:\n%s", filepath.Base(p), data)
+		}
+	}
+
+	t.Run("NewKey", func(t *testing.T) {
+		old := ds.box
+		ds.SetSecretBox(newTestSecretBox(t))
+		if _, err := RotateSecrets(ds, old); err != nil {
+			t.Fatalf("RotateSecrets failed: %v", err)
+		}
+		for _, p := range []string{path, path + BackupSuffix} {
+			data, _ := os.ReadFile(p)
+			if strings.Contains(string(data), ":"+old.KeyID()+":") {
+				t.Errorf("Expected no secret under the old key in %s:\n%s", filepath.Base(p), data)
+			}
+		}
+	})
+}
+
+func TestFileETags_Increase(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+	ds.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+
+	// Writes within the same millisecond must still get distinct ETags
+	var last int64
+	for i := 0; i < 20; i++ {
+		ds.SavePresets("acc1", []models.Preset{})
+		ds.SaveDevicePresets("acc1", "dev1", []models.Preset{})
+		account, device := ds.GetETagForPresets("acc1"), ds.GetETagForDevicePresets("acc1", "dev1")
+		if account <= last || device <= account {
+			t.Fatalf("Expected increasing ETags, got %d after %d, then %d", account, last, device)
+		}
+		last = device
+	}
+}
+
+func TestListAccounts_SkipsReservedDirs(t *testing.T) {
+	dir := t.TempDir()
+	ds := NewDataStore(dir)
+	ds.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	// The TuneIn cache and the stats live next to the accounts
+	os.MkdirAll(filepath.Join(dir, "cache"), 0755)
+	os.WriteFile(filepath.Join(dir, "cache", "tunein.json"), []byte("{}"), 0644)
+	os.MkdirAll(filepath.Join(dir, "stats", "usage"), 0755)
+
+	accounts, err := ds.ListAccounts()
+	if err != nil || len(accounts) != 1 || accounts[0] != "acc1" {
+		t.Errorf("Expected only acc1, got %v (%v)", accounts, err)
+	}
+}
@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"sync"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// maxDeviceEvents is the number of events kept per device.
+const maxDeviceEvents = 100
+
+// eventLog keeps the most recent events per device in memory. Its zero value
+// is ready to use.
+type eventLog struct {
+	eventMutex   sync.RWMutex
+	deviceEvents map[string][]models.DeviceEvent
+}
+
+func (l *eventLog) AddDeviceEvent(deviceID string, event models.DeviceEvent) {
+	l.eventMutex.Lock()
+	defer l.eventMutex.Unlock()
+
+	if l.deviceEvents == nil {
+		l.deviceEvents = make(map[string][]models.DeviceEvent)
+	}
+
+	events := l.deviceEvents[deviceID]
+	events = append(events, event)
+
+	// Keep only the last maxDeviceEvents events
+	if len(events) > maxDeviceEvents {
+		events = events[len(events)-maxDeviceEvents:]
+	}
+	l.deviceEvents[deviceID] = events
+}
+
+func (l *eventLog) GetDeviceEvents(deviceID string) []models.DeviceEvent {
+	l.eventMutex.RLock()
+	defer l.eventMutex.RUnlock()
+
+	events, ok := l.deviceEvents[deviceID]
+	if !ok {
+		return []models.DeviceEvent{}
+	}
+
+	// Return a copy to avoid race conditions if the caller modifies it
+	copiedEvents := make([]models.DeviceEvent, len(events))
+	copy(copiedEvents, events)
+	return copiedEvents
+}
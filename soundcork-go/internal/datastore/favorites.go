@@ -0,0 +1,116 @@
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+type favoritesXML struct {
+	XMLName   xml.Name          `xml:"favorites"`
+	Favorites []models.Favorite `xml:"favorite"`
+}
+
+// GetFavorites returns the BMX favorites of an account. No favorites file means none.
+func (ds *DataStore) GetFavorites(account string) ([]models.Favorite, error) {
+	path := filepath.Join(ds.AccountDir(account), constants.FavoritesFile)
+	var wrap favoritesXML
+	err := readXMLFile(path, &wrap, "favorites")
+	if os.IsNotExist(err) {
+		return []models.Favorite{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wrap.Favorites == nil {
+		return []models.Favorite{}, nil
+	}
+	return wrap.Favorites, nil
+}
+
+func (ds *DataStore) SaveFavorites(account string, favorites []models.Favorite) error {
+	dir := ds.AccountDir(account)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return writeXMLFile(filepath.Join(dir, constants.FavoritesFile), favoritesXML{Favorites: favorites})
+}
+
+// IsFavorite reports whether id is among the favorites of an account.
+func (ds *DataStore) IsFavorite(account, id string) bool {
+	return isFavorite(ds, account, id)
+}
+
+// AddFavorite adds a favorite to an account. Adding an existing favorite updates
+// its name and image but keeps its creation time.
+func (ds *DataStore) AddFavorite(account string, favorite models.Favorite) error {
+	return addFavorite(ds, account, favorite)
+}
+
+func (ds *DataStore) RemoveFavorite(account, id string) error {
+	return removeFavorite(ds, account, id)
+}
+
+// favoriteStore is the storage needed by the favorite helpers shared between
+// Store implementations.
+type favoriteStore interface {
+	lock(key string) func()
+	GetFavorites(account string) ([]models.Favorite, error)
+	SaveFavorites(account string, favorites []models.Favorite) error
+}
+
+func isFavorite(fs favoriteStore, account, id string) bool {
+	favorites, err := fs.GetFavorites(account)
+	if err != nil {
+		return false
+	}
+	for _, f := range favorites {
+		if f.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func addFavorite(fs favoriteStore, account string, favorite models.Favorite) error {
+	defer fs.lock("favorites/" + account)()
+
+	favorites, err := fs.GetFavorites(account)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range favorites {
+		if f.ID == favorite.ID {
+			favorite.CreatedOn = f.CreatedOn
+			favorites[i] = favorite
+			return fs.SaveFavorites(account, favorites)
+		}
+	}
+
+	if favorite.CreatedOn == "" {
+		favorite.CreatedOn = time.Now().UTC().Format(time.RFC3339)
+	}
+	return fs.SaveFavorites(account, append(favorites, favorite))
+}
+
+func removeFavorite(fs favoriteStore, account, id string) error {
+	defer fs.lock("favorites/" + account)()
+
+	favorites, err := fs.GetFavorites(account)
+	if err != nil {
+		return err
+	}
+	for i, f := range favorites {
+		if f.ID == id {
+			return fs.SaveFavorites(account, append(favorites[:i], favorites[i+1:]...))
+		}
+	}
+	return fmt.Errorf("favorite %s not found", id)
+}
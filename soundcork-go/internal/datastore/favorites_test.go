@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestFavorites(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+	account := "default"
+
+	favorites, err := ds.GetFavorites(account)
+	if err != nil || len(favorites) != 0 {
+		t.Fatalf("Expected no favorites, got %+v (err %v)", favorites, err)
+	}
+
+	if err := ds.AddFavorite(account, models.Favorite{ID: "s12345", Name: "Test Radio"}); err != nil {
+		t.Fatalf("AddFavorite failed: %v", err)
+	}
+	ds.AddFavorite(account, models.Favorite{ID: "p555"})
+	if !ds.IsFavorite(account, "s12345") || !ds.IsFavorite(account, "p555") {
+		t.Error("Expected both favorites to be stored")
+	}
+	if ds.IsFavorite("other", "s12345") {
+		t.Error("Expected favorites to be per account")
+	}
+
+	favorites, _ = ds.GetFavorites(account)
+	createdOn := favorites[0].CreatedOn
+	if createdOn == "" {
+		t.Error("Expected creation time to be set")
+	}
+
+	ds.AddFavorite(account, models.Favorite{ID: "s12345", Name: "Renamed Radio"})
+	favorites, _ = ds.GetFavorites(account)
+	if len(favorites) != 2 || favorites[0].Name != "Renamed Radio" || favorites[0].CreatedOn != createdOn {
+		t.Errorf("Expected re-adding to update in place, got %+v", favorites)
+	}
+
+	if err := ds.RemoveFavorite(account, "s12345"); err != nil {
+		t.Fatalf("RemoveFavorite failed: %v", err)
+	}
+	if ds.IsFavorite(account, "s12345") {
+		t.Error("Expected favorite to be removed")
+	}
+	if err := ds.RemoveFavorite(account, "s12345"); err == nil {
+		t.Error("Expected error removing unknown favorite")
+	}
+}
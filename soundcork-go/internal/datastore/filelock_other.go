@@ -0,0 +1,9 @@
+//go:build !unix
+
+package datastore
+
+// lockFile is a no-op where flock is not available; only the in-process lock
+// applies.
+func lockFile(path string) func() {
+	return func() {}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package datastore
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on path, creating it if needed, and
+// returns the function releasing it. If the file cannot be locked, a warning
+// is logged and only the in-process lock applies.
+func lockFile(path string) func() {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Warning: failed to lock %s: %v", path, err)
+		return func() {}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("Warning: failed to lock %s: %v", path, err)
+		return func() {}
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		log.Printf("Warning: failed to lock %s: %v", path, err)
+		f.Close()
+		return func() {}
+	}
+	return func() { f.Close() }
+}
@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// locksDir holds the lock files of the accounts. Like all hidden directories
+// in the data directory, it is no account.
+const locksDir = ".locks"
+
+// keyLocks hands out one mutex per key. Its zero value is ready to use.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock locks the mutex for key and returns the function unlocking it.
+func (l *keyLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := l.locks[key]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[key] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// LockAccount serializes read-modify-write sequences on the presets, recents,
+// sources and devices of an account, e.g. two speakers of the same account
+// storing a preset at the same time. Call the returned function to unlock.
+func (l *keyLocks) LockAccount(account string) func() {
+	return l.lock("account/" + account)
+}
+
+// lockAccounts locks several accounts in a fixed order, so that two callers
+// locking the same accounts cannot deadlock.
+func (l *keyLocks) lockAccounts(accounts ...string) func() {
+	return lockAll(l.LockAccount, accounts)
+}
+
+// lockAll locks accounts in a fixed order with lock.
+func lockAll(lock func(account string) func(), accounts []string) func() {
+	sorted := slices.Compact(slices.Sorted(slices.Values(accounts)))
+	unlocks := make([]func(), 0, len(sorted))
+	for _, account := range sorted {
+		unlocks = append(unlocks, lock(account))
+	}
+	return func() {
+		for _, unlock := range slices.Backward(unlocks) {
+			unlock()
+		}
+	}
+}
+
+// LockAccount locks an account against this and other processes using the
+// data directory, like soundcork-keys: besides the in-process mutex, it takes
+// an flock on the lock file of the account in DATA_DIR/.locks. Processes that
+// do not take these locks, like the Python backend, are not kept out.
+func (ds *DataStore) LockAccount(account string) func() {
+	unlock := ds.keyLocks.LockAccount(account)
+	unlockFile := lockFile(filepath.Join(ds.DataDir, locksDir, account+".lock"))
+	return func() {
+		unlockFile()
+		unlock()
+	}
+}
+
+func (ds *DataStore) lockAccounts(accounts ...string) func() {
+	return lockAll(ds.LockAccount, accounts)
+}
@@ -0,0 +1,608 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// MemoryStore is a Store keeping all data in memory. It is meant for tests
+// and loses everything on restart.
+type MemoryStore struct {
+	mu         sync.Mutex
+	accounts   map[string]*memoryAccount
+	stations   []models.Station
+	streams    map[string]models.StreamStats
+	usageStats []models.UsageStats
+	errorStats []models.ErrorStats
+	lastETag   int64
+	eventLog
+	keyLocks
+	sourceSecrets
+}
+
+type memoryAccount struct {
+	devices     map[string]models.DeviceInfo
+	deviceLists map[string]*memoryDeviceLists
+	presets     []models.Preset
+	recents     []models.Recent
+	sources     []models.ConfiguredSource
+	favorites   []models.Favorite
+	positions   []models.PlaybackPosition
+	history     []models.PresetVersion
+
+	presetsETag int64
+	recentsETag int64
+	sourcesETag int64
+}
+
+// memoryDeviceLists are the presets and recents of a single device. A nil
+// list means the device uses the one of its account.
+type memoryDeviceLists struct {
+	presets     []models.Preset
+	recents     []models.Recent
+	presetsETag int64
+	recentsETag int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string]*memoryAccount),
+		streams:  make(map[string]models.StreamStats),
+	}
+}
+
+func (m *MemoryStore) Initialize() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account("default")
+	return nil
+}
+
+// account returns the account with the given name, creating it if needed.
+// The caller must hold m.mu.
+func (m *MemoryStore) account(name string) *memoryAccount {
+	acc, ok := m.accounts[name]
+	if !ok {
+		acc = &memoryAccount{
+			devices:     make(map[string]models.DeviceInfo),
+			deviceLists: make(map[string]*memoryDeviceLists),
+		}
+		m.accounts[name] = acc
+	}
+	return acc
+}
+
+// nextETag returns the current time in milliseconds, but always more than the
+// previous ETag so that saves within the same millisecond are told apart.
+func (m *MemoryStore) nextETag() int64 {
+	etag := time.Now().UnixNano() / int64(time.Millisecond)
+	if etag <= m.lastETag {
+		etag = m.lastETag + 1
+	}
+	m.lastETag = etag
+	return etag
+}
+
+func (m *MemoryStore) CreateAccount(account string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account(account)
+	return nil
+}
+
+func (m *MemoryStore) ListAccounts() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accounts := []string{}
+	for name := range m.accounts {
+		accounts = append(accounts, name)
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+func (m *MemoryStore) AccountExists(account string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.accounts[account]
+	return ok
+}
+
+func (m *MemoryStore) RenameAccount(account, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[account]
+	if !ok {
+		return fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	if _, ok := m.accounts[newName]; ok {
+		return fmt.Errorf("account %s: %w", newName, os.ErrExist)
+	}
+	delete(m.accounts, account)
+	m.accounts[newName] = acc
+	return nil
+}
+
+// DeleteAccount drops an account. There is no archive in memory.
+func (m *MemoryStore) DeleteAccount(account string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[account]; !ok {
+		return fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	delete(m.accounts, account)
+	return nil
+}
+
+func (m *MemoryStore) ListAccountDevices(account string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[account]
+	if !ok {
+		return nil, fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	devices := []string{}
+	for id := range acc.devices {
+		devices = append(devices, id)
+	}
+	sort.Strings(devices)
+	return devices, nil
+}
+
+func (m *MemoryStore) ListAllDevices() ([]models.DeviceInfo, error) {
+	accounts, _ := m.ListAccounts()
+
+	devices := []models.DeviceInfo{}
+	seenIDs := make(map[string]bool)
+	for _, acc := range accounts {
+		ids, err := m.ListAccountDevices(acc)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			info, err := m.GetDeviceInfo(acc, id)
+			if err != nil {
+				continue
+			}
+			key := info.DeviceID
+			if key == "" {
+				key = info.IPAddress
+			}
+			if !seenIDs[key] {
+				devices = append(devices, *info)
+				seenIDs[key] = true
+			}
+		}
+	}
+	return devices, nil
+}
+
+func (m *MemoryStore) FindDeviceByIP(ip string) (string, *models.DeviceInfo, error) {
+	accounts, _ := m.ListAccounts()
+	for _, acc := range accounts {
+		ids, err := m.ListAccountDevices(acc)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			info, err := m.GetDeviceInfo(acc, id)
+			if err != nil || info.IPAddress != ip {
+				continue
+			}
+			if info.DeviceID == "" {
+				info.DeviceID = id
+			}
+			return acc, info, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no device known with IP %s", ip)
+}
+
+func (m *MemoryStore) GetDeviceInfo(account, device string) (*models.DeviceInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if acc, ok := m.accounts[account]; ok {
+		if info, ok := acc.devices[device]; ok {
+			return &info, nil
+		}
+	}
+	return nil, fmt.Errorf("device %s in account %s: %w", device, account, os.ErrNotExist)
+}
+
+func (m *MemoryStore) SaveDeviceInfo(account string, device string, info *models.DeviceInfo) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account(account).devices[device] = *info
+	return nil
+}
+
+func (m *MemoryStore) RemoveDevice(account string, device string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if acc, ok := m.accounts[account]; ok {
+		delete(acc.devices, device)
+		delete(acc.deviceLists, device)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetPresets(account string) ([]models.Preset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[account]
+	if !ok || acc.presets == nil {
+		return nil, fmt.Errorf("presets of account %s: %w", account, os.ErrNotExist)
+	}
+	return append([]models.Preset{}, acc.presets...), nil
+}
+
+func (m *MemoryStore) SavePresets(account string, presets []models.Preset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc := m.account(account)
+	acc.presets = append([]models.Preset{}, presets...)
+	acc.presetsETag = m.nextETag()
+	return nil
+}
+
+func (m *MemoryStore) GetRecents(account string) ([]models.Recent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[account]
+	if !ok || acc.recents == nil {
+		return nil, fmt.Errorf("recents of account %s: %w", account, os.ErrNotExist)
+	}
+	return append([]models.Recent{}, acc.recents...), nil
+}
+
+func (m *MemoryStore) SaveRecents(account string, recents []models.Recent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc := m.account(account)
+	acc.recents = append([]models.Recent{}, recents...)
+	acc.recentsETag = m.nextETag()
+	return nil
+}
+
+// ownDeviceLists returns a copy of the lists of a device, without falling
+// back to its account.
+func (m *MemoryStore) ownDeviceLists(account, device string) memoryDeviceLists {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if acc, ok := m.accounts[account]; ok {
+		if lists, ok := acc.deviceLists[device]; ok {
+			return memoryDeviceLists{
+				presets:     slices.Clone(lists.presets),
+				recents:     slices.Clone(lists.recents),
+				presetsETag: lists.presetsETag,
+				recentsETag: lists.recentsETag,
+			}
+		}
+	}
+	return memoryDeviceLists{}
+}
+
+// deviceLists returns the lists of a device, creating them if needed.
+// The caller must hold m.mu.
+func (m *MemoryStore) deviceLists(account, device string) *memoryDeviceLists {
+	acc := m.account(account)
+	lists, ok := acc.deviceLists[device]
+	if !ok {
+		lists = &memoryDeviceLists{}
+		acc.deviceLists[device] = lists
+	}
+	return lists
+}
+
+func (m *MemoryStore) GetDevicePresets(account, device string) ([]models.Preset, error) {
+	if own := m.ownDeviceLists(account, device); own.presets != nil {
+		return own.presets, nil
+	}
+	return m.GetPresets(account)
+}
+
+func (m *MemoryStore) SaveDevicePresets(account, device string, presets []models.Preset) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lists := m.deviceLists(account, device)
+	lists.presets = append([]models.Preset{}, presets...)
+	lists.presetsETag = m.nextETag()
+	return nil
+}
+
+func (m *MemoryStore) GetDeviceRecents(account, device string) ([]models.Recent, error) {
+	if own := m.ownDeviceLists(account, device); own.recents != nil {
+		return own.recents, nil
+	}
+	return m.GetRecents(account)
+}
+
+func (m *MemoryStore) SaveDeviceRecents(account, device string, recents []models.Recent) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lists := m.deviceLists(account, device)
+	lists.recents = append([]models.Recent{}, recents...)
+	lists.recentsETag = m.nextETag()
+	return nil
+}
+
+func (m *MemoryStore) HasOwnDeviceLists(account, device string) (presets, recents bool) {
+	own := m.ownDeviceLists(account, device)
+	return own.presetsETag != 0, own.recentsETag != 0
+}
+
+func (m *MemoryStore) GetConfiguredSources(account string) ([]models.ConfiguredSource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[account]
+	if !ok || acc.sources == nil {
+		return nil, fmt.Errorf("sources of account %s: %w", account, os.ErrNotExist)
+	}
+	return append([]models.ConfiguredSource{}, acc.sources...), nil
+}
+
+func (m *MemoryStore) SaveConfiguredSources(account string, sources []models.ConfiguredSource) error {
+	sources, err := m.sealSources(sources)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc := m.account(account)
+	acc.sources = append([]models.ConfiguredSource{}, sources...)
+	acc.sourcesETag = m.nextETag()
+	return nil
+}
+
+func (m *MemoryStore) GetETagForPresets(account string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if acc, ok := m.accounts[account]; ok {
+		return acc.presetsETag
+	}
+	return 0
+}
+
+func (m *MemoryStore) GetETagForSources(account string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if acc, ok := m.accounts[account]; ok {
+		return acc.sourcesETag
+	}
+	return 0
+}
+
+func (m *MemoryStore) GetETagForRecents(account string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if acc, ok := m.accounts[account]; ok {
+		return acc.recentsETag
+	}
+	return 0
+}
+
+func (m *MemoryStore) GetETagForDevicePresets(account, device string) int64 {
+	if own := m.ownDeviceLists(account, device); own.presetsETag != 0 {
+		return own.presetsETag
+	}
+	return m.GetETagForPresets(account)
+}
+
+func (m *MemoryStore) GetETagForDeviceRecents(account, device string) int64 {
+	if own := m.ownDeviceLists(account, device); own.recentsETag != 0 {
+		return own.recentsETag
+	}
+	return m.GetETagForRecents(account)
+}
+
+func (m *MemoryStore) GetETagForAccount(account string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	acc, ok := m.accounts[account]
+	if !ok {
+		return 0
+	}
+	etag := max(acc.presetsETag, acc.sourcesETag, acc.recentsETag)
+	for _, lists := range acc.deviceLists {
+		etag = max(etag, lists.presetsETag, lists.recentsETag)
+	}
+	return etag
+}
+
+func (m *MemoryStore) SaveUsageStats(stats models.UsageStats) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usageStats = append(m.usageStats, stats)
+	return nil
+}
+
+func (m *MemoryStore) SaveErrorStats(stats models.ErrorStats) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errorStats = append(m.errorStats, stats)
+	return nil
+}
+
+func (m *MemoryStore) GetStreamStats() (map[string]models.StreamStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[string]models.StreamStats, len(m.streams))
+	for k, v := range m.streams {
+		stats[k] = v
+	}
+	return stats, nil
+}
+
+func (m *MemoryStore) RecordStreamProbes(results map[string]bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	addStreamProbes(m.streams, results)
+	return nil
+}
+
+func (m *MemoryStore) SaveStreamStats(stats map[string]models.StreamStats) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.streams = make(map[string]models.StreamStats, len(stats))
+	for k, v := range stats {
+		m.streams[k] = v
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetStations() ([]models.Station, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.Station{}, m.stations...), nil
+}
+
+func (m *MemoryStore) SaveStations(stations []models.Station) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stations = append([]models.Station{}, stations...)
+	return nil
+}
+
+func (m *MemoryStore) GetStation(id string) (*models.Station, error) {
+	return getStation(m, id)
+}
+
+func (m *MemoryStore) AddStation(station models.Station) (*models.Station, error) {
+	return addStation(m, station)
+}
+
+func (m *MemoryStore) UpdateStation(station models.Station) error {
+	return updateStation(m, station)
+}
+
+func (m *MemoryStore) DeleteStation(id string) error {
+	return deleteStation(m, id)
+}
+
+func (m *MemoryStore) GetFavorites(account string) ([]models.Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	favorites := []models.Favorite{}
+	if acc, ok := m.accounts[account]; ok {
+		favorites = append(favorites, acc.favorites...)
+	}
+	return favorites, nil
+}
+
+func (m *MemoryStore) SaveFavorites(account string, favorites []models.Favorite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account(account).favorites = append([]models.Favorite{}, favorites...)
+	return nil
+}
+
+func (m *MemoryStore) IsFavorite(account, id string) bool {
+	return isFavorite(m, account, id)
+}
+
+func (m *MemoryStore) AddFavorite(account string, favorite models.Favorite) error {
+	return addFavorite(m, account, favorite)
+}
+
+func (m *MemoryStore) RemoveFavorite(account, id string) error {
+	return removeFavorite(m, account, id)
+}
+
+func (m *MemoryStore) GetPlaybackPositions(account string) ([]models.PlaybackPosition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	positions := []models.PlaybackPosition{}
+	if acc, ok := m.accounts[account]; ok {
+		positions = append(positions, acc.positions...)
+	}
+	sortPlaybackPositions(positions)
+	return positions, nil
+}
+
+func (m *MemoryStore) GetPlaybackPosition(account, episodeID string) (*models.PlaybackPosition, error) {
+	return getPlaybackPosition(m, account, episodeID)
+}
+
+func (m *MemoryStore) GetAllPlaybackPositions() ([]models.PlaybackPosition, error) {
+	return allPlaybackPositions(m)
+}
+
+func (m *MemoryStore) SavePlaybackPosition(account string, position models.PlaybackPosition) error {
+	return savePlaybackPosition(m, account, position)
+}
+
+func (m *MemoryStore) RemovePlaybackPosition(account, episodeID string) error {
+	return removePlaybackPosition(m, account, episodeID)
+}
+
+func (m *MemoryStore) savePlaybackPositions(account string, positions []models.PlaybackPosition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account(account).positions = append([]models.PlaybackPosition{}, positions...)
+	return nil
+}
+
+func (m *MemoryStore) AddPresetVersion(account string, version models.PresetVersion) (*models.PresetVersion, error) {
+	return addPresetVersion(m, account, version)
+}
+
+func (m *MemoryStore) GetPresetHistory(account, device string) ([]models.PresetVersion, error) {
+	return getPresetHistory(m, account, device)
+}
+
+func (m *MemoryStore) GetPresetVersion(account, id string) (*models.PresetVersion, error) {
+	return getPresetVersion(m, account, id)
+}
+
+func (m *MemoryStore) loadPresetHistory(account string) ([]models.PresetVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := []models.PresetVersion{}
+	if acc, ok := m.accounts[account]; ok {
+		versions = append(versions, acc.history...)
+	}
+	return versions, nil
+}
+
+func (m *MemoryStore) savePresetHistory(account string, versions []models.PresetVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.account(account).history = append([]models.PresetVersion{}, versions...)
+	return nil
+}
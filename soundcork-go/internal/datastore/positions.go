@@ -0,0 +1,151 @@
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+type positionsXML struct {
+	XMLName   xml.Name                  `xml:"playbackPositions"`
+	Positions []models.PlaybackPosition `xml:"position"`
+}
+
+// GetPlaybackPositions returns the in-progress episodes of an account, most
+// recently played first.
+func (ds *DataStore) GetPlaybackPositions(account string) ([]models.PlaybackPosition, error) {
+	path := filepath.Join(ds.AccountDir(account), constants.PositionsFile)
+	var wrap positionsXML
+	err := readXMLFile(path, &wrap, "playback positions")
+	if os.IsNotExist(err) {
+		return []models.PlaybackPosition{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	positions := wrap.Positions
+	if positions == nil {
+		positions = []models.PlaybackPosition{}
+	}
+	sortPlaybackPositions(positions)
+	return positions, nil
+}
+
+func (ds *DataStore) GetPlaybackPosition(account, episodeID string) (*models.PlaybackPosition, error) {
+	return getPlaybackPosition(ds, account, episodeID)
+}
+
+// GetAllPlaybackPositions returns the in-progress episodes of all accounts.
+func (ds *DataStore) GetAllPlaybackPositions() ([]models.PlaybackPosition, error) {
+	return allPlaybackPositions(ds)
+}
+
+// SavePlaybackPosition stores the position of an episode, replacing an earlier one.
+func (ds *DataStore) SavePlaybackPosition(account string, position models.PlaybackPosition) error {
+	return savePlaybackPosition(ds, account, position)
+}
+
+func (ds *DataStore) RemovePlaybackPosition(account, episodeID string) error {
+	return removePlaybackPosition(ds, account, episodeID)
+}
+
+func (ds *DataStore) savePlaybackPositions(account string, positions []models.PlaybackPosition) error {
+	dir := ds.AccountDir(account)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return writeXMLFile(filepath.Join(dir, constants.PositionsFile), positionsXML{Positions: positions})
+}
+
+// positionStore is the storage needed by the playback position helpers shared
+// between Store implementations.
+type positionStore interface {
+	lock(key string) func()
+	ListAccounts() ([]string, error)
+	GetPlaybackPositions(account string) ([]models.PlaybackPosition, error)
+	savePlaybackPositions(account string, positions []models.PlaybackPosition) error
+}
+
+func getPlaybackPosition(ps positionStore, account, episodeID string) (*models.PlaybackPosition, error) {
+	positions, err := ps.GetPlaybackPositions(account)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range positions {
+		if p.EpisodeID == episodeID {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("no playback position for %s", episodeID)
+}
+
+func allPlaybackPositions(ps positionStore) ([]models.PlaybackPosition, error) {
+	accounts, err := ps.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	all := []models.PlaybackPosition{}
+	for _, acc := range accounts {
+		positions, err := ps.GetPlaybackPositions(acc)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range positions {
+			p.Account = acc
+			all = append(all, p)
+		}
+	}
+	return all, nil
+}
+
+func savePlaybackPosition(ps positionStore, account string, position models.PlaybackPosition) error {
+	defer ps.lock("positions/" + account)()
+
+	positions, err := ps.GetPlaybackPositions(account)
+	if err != nil {
+		return err
+	}
+
+	position.Account = ""
+	replaced := false
+	for i, p := range positions {
+		if p.EpisodeID == position.EpisodeID {
+			positions[i] = position
+			replaced = true
+		}
+	}
+	if !replaced {
+		positions = append(positions, position)
+	}
+	return ps.savePlaybackPositions(account, positions)
+}
+
+func removePlaybackPosition(ps positionStore, account, episodeID string) error {
+	defer ps.lock("positions/" + account)()
+
+	positions, err := ps.GetPlaybackPositions(account)
+	if err != nil {
+		return err
+	}
+	for i, p := range positions {
+		if p.EpisodeID == episodeID {
+			return ps.savePlaybackPositions(account, append(positions[:i], positions[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no playback position for %s", episodeID)
+}
+
+// sortPlaybackPositions orders positions with the most recently played first.
+func sortPlaybackPositions(positions []models.PlaybackPosition) {
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].UpdatedOn > positions[j].UpdatedOn
+	})
+}
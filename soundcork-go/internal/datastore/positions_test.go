@@ -0,0 +1,48 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestPlaybackPositions(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+
+	if _, err := ds.GetPlaybackPosition("default", "t1"); err == nil {
+		t.Error("Expected error for unknown position")
+	}
+
+	ds.SavePlaybackPosition("default", models.PlaybackPosition{EpisodeID: "t1", Position: 10, UpdatedOn: "2025-10-31T05:00:00Z"})
+	ds.SavePlaybackPosition("default", models.PlaybackPosition{EpisodeID: "t2", Position: 20, UpdatedOn: "2025-10-31T06:00:00Z"})
+	ds.SavePlaybackPosition("other", models.PlaybackPosition{EpisodeID: "t1", Position: 99, UpdatedOn: "2025-10-31T04:00:00Z"})
+	ds.SavePlaybackPosition("default", models.PlaybackPosition{EpisodeID: "t1", Position: 30, UpdatedOn: "2025-10-31T07:00:00Z"})
+
+	positions, err := ds.GetPlaybackPositions("default")
+	if err != nil {
+		t.Fatalf("GetPlaybackPositions failed: %v", err)
+	}
+	if len(positions) != 2 || positions[0].EpisodeID != "t1" || positions[0].Position != 30 {
+		t.Errorf("Expected updated t1 first, got %+v", positions)
+	}
+
+	all, err := ds.GetAllPlaybackPositions()
+	if err != nil {
+		t.Fatalf("GetAllPlaybackPositions failed: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 positions across accounts, got %+v", all)
+	}
+	for _, p := range all {
+		if p.Account == "" {
+			t.Errorf("Expected account to be set on %+v", p)
+		}
+	}
+
+	if err := ds.RemovePlaybackPosition("default", "t1"); err != nil {
+		t.Fatalf("RemovePlaybackPosition failed: %v", err)
+	}
+	if pos, _ := ds.GetPlaybackPosition("other", "t1"); pos == nil || pos.Position != 99 {
+		t.Errorf("Expected other account to keep its position, got %+v", pos)
+	}
+}
@@ -0,0 +1,144 @@
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// maxPresetVersions is the number of preset versions kept per device.
+const maxPresetVersions = 100
+
+type presetHistoryXML struct {
+	XMLName  xml.Name               `xml:"presetHistory"`
+	Versions []models.PresetVersion `xml:"version"`
+}
+
+// AddPresetVersion appends a version to the preset history of an account and
+// returns it with its ID. A version that already has an ID keeps it.
+func (ds *DataStore) AddPresetVersion(account string, version models.PresetVersion) (*models.PresetVersion, error) {
+	return addPresetVersion(ds, account, version)
+}
+
+// GetPresetHistory returns the preset versions of a device, or of all devices
+// of the account if device is empty, most recent first.
+func (ds *DataStore) GetPresetHistory(account, device string) ([]models.PresetVersion, error) {
+	return getPresetHistory(ds, account, device)
+}
+
+func (ds *DataStore) GetPresetVersion(account, id string) (*models.PresetVersion, error) {
+	return getPresetVersion(ds, account, id)
+}
+
+func (ds *DataStore) loadPresetHistory(account string) ([]models.PresetVersion, error) {
+	var wrap presetHistoryXML
+	err := readXMLFile(filepath.Join(ds.AccountDir(account), constants.HistoryFile), &wrap, "preset history")
+	if os.IsNotExist(err) {
+		return []models.PresetVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wrap.Versions, nil
+}
+
+func (ds *DataStore) savePresetHistory(account string, versions []models.PresetVersion) error {
+	dir := ds.AccountDir(account)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return writeXMLFile(filepath.Join(dir, constants.HistoryFile), presetHistoryXML{Versions: versions})
+}
+
+// historyStore is the storage needed by the preset history helpers shared
+// between Store implementations. Versions are loaded and saved oldest first.
+type historyStore interface {
+	lock(key string) func()
+	loadPresetHistory(account string) ([]models.PresetVersion, error)
+	savePresetHistory(account string, versions []models.PresetVersion) error
+}
+
+func addPresetVersion(hs historyStore, account string, version models.PresetVersion) (*models.PresetVersion, error) {
+	defer hs.lock("history/" + account)()
+
+	versions, err := hs.loadPresetHistory(account)
+	if err != nil {
+		return nil, err
+	}
+	if version.ID == "" {
+		version.ID = strconv.Itoa(nextPresetVersionID(versions))
+	}
+	versions = trimPresetHistory(append(versions, version))
+	if err := hs.savePresetHistory(account, versions); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func getPresetHistory(hs historyStore, account, device string) ([]models.PresetVersion, error) {
+	versions, err := hs.loadPresetHistory(account)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []models.PresetVersion{}
+	for _, v := range slices.Backward(versions) {
+		if device == "" || v.DeviceID == device {
+			history = append(history, v)
+		}
+	}
+	return history, nil
+}
+
+func getPresetVersion(hs historyStore, account, id string) (*models.PresetVersion, error) {
+	versions, err := hs.loadPresetHistory(account)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if v.ID == id {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("no preset version %s: %w", id, os.ErrNotExist)
+}
+
+// nextPresetVersionID returns the ID following the highest one in versions.
+func nextPresetVersionID(versions []models.PresetVersion) int {
+	next := 1
+	for _, v := range versions {
+		if id, err := strconv.Atoi(v.ID); err == nil && id >= next {
+			next = id + 1
+		}
+	}
+	return next
+}
+
+// trimPresetHistory drops the oldest versions of each device beyond
+// maxPresetVersions.
+func trimPresetHistory(versions []models.PresetVersion) []models.PresetVersion {
+	kept := make(map[string]int)
+	keep := make([]bool, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		device := versions[i].DeviceID
+		if kept[device] < maxPresetVersions {
+			kept[device]++
+			keep[i] = true
+		}
+	}
+
+	trimmed := make([]models.PresetVersion, 0, len(versions))
+	for i, v := range versions {
+		if keep[i] {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,127 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/secrets"
+)
+
+// sourceSecrets encrypts the secrets of configured sources before they are
+// stored. Its zero value stores them unencrypted.
+type sourceSecrets struct {
+	box *secrets.Box
+}
+
+// SetSecretBox sets the key that source secrets are encrypted with from now
+// on. It must be called before the store is used.
+func (s *sourceSecrets) SetSecretBox(box *secrets.Box) {
+	s.box = box
+}
+
+// sealSources returns a copy of sources with encrypted secrets.
+func (s *sourceSecrets) sealSources(sources []models.ConfiguredSource) ([]models.ConfiguredSource, error) {
+	if s.box == nil {
+		return sources, nil
+	}
+	sealed := make([]models.ConfiguredSource, len(sources))
+	for i, src := range sources {
+		secret, err := s.box.Encrypt(src.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", src.ID, err)
+		}
+		src.Secret = secret
+		sealed[i] = src
+	}
+	return sealed, nil
+}
+
+// RevealSources returns a copy of sources with decrypted secrets, as they are
+// sent to the speakers.
+func (s *sourceSecrets) RevealSources(sources []models.ConfiguredSource) ([]models.ConfiguredSource, error) {
+	return revealSources(s.box, sources)
+}
+
+func revealSources(box *secrets.Box, sources []models.ConfiguredSource) ([]models.ConfiguredSource, error) {
+	revealed := make([]models.ConfiguredSource, len(sources))
+	for i, src := range sources {
+		secret, err := box.Decrypt(src.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", src.ID, err)
+		}
+		src.Secret = secret
+		revealed[i] = src
+	}
+	return revealed, nil
+}
+
+// RotateSecrets decrypts the source secrets of all accounts in s with old,
+// which is nil for unencrypted secrets, and stores them again, encrypted with
+// the key set on s. It returns the number of accounts updated.
+func RotateSecrets(s Store, old *secrets.Box) (int, error) {
+	accounts, err := s.ListAccounts()
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, account := range accounts {
+		n, err := rotateAccountSecrets(s, old, account)
+		if err != nil {
+			return updated, fmt.Errorf("account %s: %w", account, err)
+		}
+		updated += n
+	}
+	return updated, nil
+}
+
+func rotateAccountSecrets(s Store, old *secrets.Box, account string) (int, error) {
+	defer s.LockAccount(account)()
+
+	sources, err := s.GetConfiguredSources(account)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	plain, err := revealSources(old, sources)
+	if errors.Is(err, secrets.ErrWrongKey) {
+		// Sources already rotated by an earlier, interrupted run
+		plain, err = s.RevealSources(sources)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := s.SaveConfiguredSources(account, plain); err != nil {
+		return 0, err
+	}
+	// The backup would otherwise keep the secrets under the old key
+	if b, ok := s.(sourcesBackup); ok {
+		if err := b.replaceSourcesBackup(account); err != nil {
+			return 0, fmt.Errorf("failed to replace the backup of the sources: %w", err)
+		}
+	}
+	return 1, nil
+}
+
+// sourcesBackup is implemented by stores keeping a backup of the sources of
+// an account, like the XML backend.
+type sourcesBackup interface {
+	replaceSourcesBackup(account string) error
+}
+
+// replaceSourcesBackup overwrites the backup of the sources of an account
+// with the current file.
+func (ds *DataStore) replaceSourcesBackup(account string) error {
+	path := filepath.Join(ds.AccountDir(account), constants.SourcesFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path+BackupSuffix, data)
+}
@@ -0,0 +1,202 @@
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// The XML files of the data directory use the formats the speaker serves on
+// :8090/info, /presets and /recents, and keeps in its Sources.xml. The Parse
+// functions convert such content, e.g. when importing from a speaker.
+
+type deviceInfoXML struct {
+	XMLName    xml.Name `xml:"info"`
+	DeviceID   string   `xml:"deviceID,attr"`
+	Name       string   `xml:"name"`
+	Type       string   `xml:"type"`
+	ModuleType string   `xml:"moduleType"`
+	Components []struct {
+		Category        string `xml:"componentCategory"`
+		SoftwareVersion string `xml:"softwareVersion"`
+		SerialNumber    string `xml:"serialNumber"`
+	} `xml:"components>component"`
+	NetworkInfo []struct {
+		Type      string `xml:"type,attr"`
+		IPAddress string `xml:"ipAddress"`
+	} `xml:"networkInfo"`
+}
+
+func (info deviceInfoXML) deviceInfo() *models.DeviceInfo {
+	deviceInfo := &models.DeviceInfo{
+		DeviceID:    info.DeviceID,
+		ProductCode: fmt.Sprintf("%s %s", info.Type, info.ModuleType),
+		Name:        info.Name,
+	}
+
+	for _, comp := range info.Components {
+		if comp.Category == "SCM" {
+			deviceInfo.FirmwareVersion = comp.SoftwareVersion
+			deviceInfo.DeviceSerialNumber = comp.SerialNumber
+		} else if comp.Category == "PackagedProduct" {
+			deviceInfo.ProductSerialNumber = comp.SerialNumber
+		}
+	}
+
+	for _, net := range info.NetworkInfo {
+		if net.Type == "SCM" {
+			deviceInfo.IPAddress = net.IPAddress
+		}
+	}
+
+	return deviceInfo
+}
+
+type presetsXML struct {
+	Presets []struct {
+		ID          string `xml:"id,attr"`
+		CreatedOn   string `xml:"createdOn,attr"`
+		UpdatedOn   string `xml:"updatedOn,attr"`
+		ContentItem struct {
+			Source        string `xml:"source,attr"`
+			Type          string `xml:"type,attr"`
+			Location      string `xml:"location,attr"`
+			SourceAccount string `xml:"sourceAccount,attr"`
+			IsPresetable  string `xml:"isPresetable,attr"`
+			ItemName      string `xml:"itemName"`
+			ContainerArt  string `xml:"containerArt"`
+		} `xml:"ContentItem"`
+	} `xml:"preset"`
+}
+
+func (wrap presetsXML) presets() []models.Preset {
+	presets := []models.Preset{}
+	for _, p := range wrap.Presets {
+		presets = append(presets, models.Preset{
+			ContentItem: models.ContentItem{
+				ID:            p.ID,
+				Name:          p.ContentItem.ItemName,
+				Source:        p.ContentItem.Source,
+				Type:          p.ContentItem.Type,
+				Location:      p.ContentItem.Location,
+				SourceAccount: p.ContentItem.SourceAccount,
+				IsPresetable:  p.ContentItem.IsPresetable,
+			},
+			ContainerArt: p.ContentItem.ContainerArt,
+			CreatedOn:    p.CreatedOn,
+			UpdatedOn:    p.UpdatedOn,
+		})
+	}
+	return presets
+}
+
+type recentsXML struct {
+	Recents []struct {
+		ID          string `xml:"id,attr"`
+		DeviceID    string `xml:"deviceID,attr"`
+		UtcTime     string `xml:"utcTime,attr"`
+		ContentItem struct {
+			Source        string `xml:"source,attr"`
+			Type          string `xml:"type,attr"`
+			Location      string `xml:"location,attr"`
+			SourceAccount string `xml:"sourceAccount,attr"`
+			IsPresetable  string `xml:"isPresetable,attr"`
+			ItemName      string `xml:"itemName"`
+			ContainerArt  string `xml:"containerArt"`
+		} `xml:"contentItem"`
+	} `xml:"recent"`
+}
+
+func (wrap recentsXML) recents() []models.Recent {
+	recents := []models.Recent{}
+	for _, r := range wrap.Recents {
+		recents = append(recents, models.Recent{
+			ContentItem: models.ContentItem{
+				ID:            r.ID,
+				Name:          r.ContentItem.ItemName,
+				Source:        r.ContentItem.Source,
+				Type:          r.ContentItem.Type,
+				Location:      r.ContentItem.Location,
+				SourceAccount: r.ContentItem.SourceAccount,
+				IsPresetable:  r.ContentItem.IsPresetable,
+			},
+			DeviceID:     r.DeviceID,
+			UtcTime:      r.UtcTime,
+			ContainerArt: r.ContentItem.ContainerArt,
+		})
+	}
+	return recents
+}
+
+type sourcesXML struct {
+	Sources []struct {
+		DisplayName string `xml:"displayName,attr"`
+		ID          string `xml:"id,attr"`
+		Secret      string `xml:"secret,attr"`
+		SecretType  string `xml:"secretType,attr"`
+		SourceKey   struct {
+			Account string `xml:"account,attr"`
+			Type    string `xml:"type,attr"`
+		} `xml:"sourceKey"`
+	} `xml:"source"`
+}
+
+// sources converts the sources, assigning IDs to those without one.
+func (wrap sourcesXML) sources() []models.ConfiguredSource {
+	var sources []models.ConfiguredSource
+	lastID := 100001
+	for _, s := range wrap.Sources {
+		id := s.ID
+		if id == "" {
+			id = strconv.Itoa(lastID)
+			lastID++
+		}
+		sources = append(sources, models.ConfiguredSource{
+			DisplayName:      s.DisplayName,
+			ID:               id,
+			Secret:           s.Secret,
+			SecretType:       s.SecretType,
+			SourceKeyType:    s.SourceKey.Type,
+			SourceKeyAccount: s.SourceKey.Account,
+		})
+	}
+	return sources
+}
+
+// ParseDeviceInfoXML converts the content of :8090/info.
+func ParseDeviceInfoXML(data []byte) (*models.DeviceInfo, error) {
+	var info deviceInfoXML
+	if err := xml.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("malformed device info XML: %w", err)
+	}
+	return info.deviceInfo(), nil
+}
+
+// ParsePresetsXML converts the content of :8090/presets.
+func ParsePresetsXML(data []byte) ([]models.Preset, error) {
+	var wrap presetsXML
+	if err := xml.Unmarshal(data, &wrap); err != nil {
+		return nil, fmt.Errorf("malformed presets XML: %w", err)
+	}
+	return wrap.presets(), nil
+}
+
+// ParseRecentsXML converts the content of :8090/recents.
+func ParseRecentsXML(data []byte) ([]models.Recent, error) {
+	var wrap recentsXML
+	if err := xml.Unmarshal(data, &wrap); err != nil {
+		return nil, fmt.Errorf("malformed recents XML: %w", err)
+	}
+	return wrap.recents(), nil
+}
+
+// ParseSourcesXML converts the Sources.xml of a speaker.
+func ParseSourcesXML(data []byte) ([]models.ConfiguredSource, error) {
+	var wrap sourcesXML
+	if err := xml.Unmarshal(data, &wrap); err != nil {
+		return nil, fmt.Errorf("malformed sources XML: %w", err)
+	}
+	return wrap.sources(), nil
+}
@@ -0,0 +1,984 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order, each in its own transaction. The number of
+// applied migrations is kept in PRAGMA user_version, so existing entries must
+// never be changed; add a new one instead.
+var migrations = []string{
+	// 1: accounts and their devices, presets, recents and sources
+	`CREATE TABLE accounts (
+		name         TEXT PRIMARY KEY,
+		presets_etag INTEGER NOT NULL DEFAULT 0,
+		recents_etag INTEGER NOT NULL DEFAULT 0,
+		sources_etag INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE devices (
+		account    TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		device_id  TEXT NOT NULL,
+		ip_address TEXT NOT NULL DEFAULT '',
+		info       TEXT NOT NULL,
+		PRIMARY KEY (account, device_id)
+	);
+	CREATE INDEX devices_ip_address ON devices(ip_address);
+	CREATE TABLE presets (
+		account TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		slot    INTEGER NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (account, slot)
+	);
+	CREATE TABLE recents (
+		account TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		slot    INTEGER NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (account, slot)
+	);
+	CREATE TABLE sources (
+		account TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		slot    INTEGER NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (account, slot)
+	);`,
+	// 2: station library, favorites and playback positions
+	`CREATE TABLE stations (
+		slot INTEGER PRIMARY KEY,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE favorites (
+		account TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		slot    INTEGER NOT NULL,
+		data    TEXT NOT NULL,
+		PRIMARY KEY (account, slot)
+	);
+	CREATE TABLE playback_positions (
+		account    TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		episode_id TEXT NOT NULL,
+		updated_on TEXT NOT NULL DEFAULT '',
+		data       TEXT NOT NULL,
+		PRIMARY KEY (account, episode_id)
+	);`,
+	// 3: stats reported by devices and stream probe results
+	`CREATE TABLE usage_stats (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id  TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		data       TEXT NOT NULL
+	);
+	CREATE TABLE error_stats (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id  TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		data       TEXT NOT NULL
+	);
+	CREATE TABLE stream_stats (
+		url          TEXT PRIMARY KEY,
+		successes    INTEGER NOT NULL DEFAULT 0,
+		failures     INTEGER NOT NULL DEFAULT 0,
+		last_success TEXT NOT NULL DEFAULT '',
+		last_failure TEXT NOT NULL DEFAULT ''
+	);`,
+	// 4: presets and recents per device, starting from those of the account
+	`CREATE TABLE device_lists (
+		account      TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		device_id    TEXT NOT NULL,
+		presets_etag INTEGER NOT NULL DEFAULT 0,
+		recents_etag INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (account, device_id)
+	);
+	CREATE TABLE device_presets (
+		account   TEXT NOT NULL,
+		device_id TEXT NOT NULL,
+		slot      INTEGER NOT NULL,
+		data      TEXT NOT NULL,
+		PRIMARY KEY (account, device_id, slot),
+		FOREIGN KEY (account, device_id) REFERENCES device_lists(account, device_id) ON DELETE CASCADE
+	);
+	CREATE TABLE device_recents (
+		account   TEXT NOT NULL,
+		device_id TEXT NOT NULL,
+		slot      INTEGER NOT NULL,
+		data      TEXT NOT NULL,
+		PRIMARY KEY (account, device_id, slot),
+		FOREIGN KEY (account, device_id) REFERENCES device_lists(account, device_id) ON DELETE CASCADE
+	);
+	INSERT INTO device_lists (account, device_id, presets_etag, recents_etag)
+		SELECT d.account, d.device_id, a.presets_etag, a.recents_etag
+		FROM devices d JOIN accounts a ON a.name = d.account;
+	INSERT INTO device_presets (account, device_id, slot, data)
+		SELECT d.account, d.device_id, p.slot, p.data
+		FROM devices d JOIN presets p ON p.account = d.account;
+	INSERT INTO device_recents (account, device_id, slot, data)
+		SELECT d.account, d.device_id, r.slot, r.data
+		FROM devices d JOIN recents r ON r.account = d.account;`,
+	// 5: preset history
+	`CREATE TABLE preset_history (
+		account   TEXT NOT NULL REFERENCES accounts(name) ON DELETE CASCADE,
+		id        INTEGER NOT NULL,
+		device_id TEXT NOT NULL,
+		data      TEXT NOT NULL,
+		PRIMARY KEY (account, id)
+	);
+	CREATE INDEX preset_history_device ON preset_history(account, device_id);`,
+	// 6: snake_case JSON keys of favorites, like the other stored models
+	`UPDATE favorites SET data = json_remove(json_set(data, '$.image_url', json_extract(data, '$.imageUrl')), '$.imageUrl')
+		WHERE json_extract(data, '$.imageUrl') IS NOT NULL;
+	UPDATE favorites SET data = json_remove(json_set(data, '$.created_on', json_extract(data, '$.createdOn')), '$.createdOn')
+		WHERE json_extract(data, '$.createdOn') IS NOT NULL;`,
+}
+
+// SQLiteStore is a Store keeping all data in a single SQLite database.
+// Unlike DataStore, each save is a single transaction.
+type SQLiteStore struct {
+	db *sql.DB
+	// archiveRoot is where deleted accounts are exported to, next to the database
+	archiveRoot string
+	eventLog
+	keyLocks
+	sourceSecrets
+
+	etagMutex sync.Mutex
+	lastETag  int64
+}
+
+// NewSQLiteStore opens (or creates) the database at path and migrates it to
+// the current schema.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes writers and avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db, archiveRoot: filepath.Dir(path)}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// SchemaVersion returns the number of applied migrations.
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+func (s *SQLiteStore) migrate() error {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := s.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[i]); err != nil {
+				return err
+			}
+			// PRAGMA does not take parameters
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// nextETag returns the current time in milliseconds, but always more than the
+// previous ETag so that saves within the same millisecond are told apart.
+func (s *SQLiteStore) nextETag() int64 {
+	s.etagMutex.Lock()
+	defer s.etagMutex.Unlock()
+
+	etag := time.Now().UnixNano() / int64(time.Millisecond)
+	if etag <= s.lastETag {
+		etag = s.lastETag + 1
+	}
+	s.lastETag = etag
+	return etag
+}
+
+func ensureAccount(tx *sql.Tx, account string) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO accounts (name) VALUES (?)`, account)
+	return err
+}
+
+func (s *SQLiteStore) Initialize() error {
+	return s.CreateAccount("default")
+}
+
+func (s *SQLiteStore) CreateAccount(account string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		return ensureAccount(tx, account)
+	})
+}
+
+func (s *SQLiteStore) ListAccounts() ([]string, error) {
+	return queryStrings(s.db, `SELECT name FROM accounts ORDER BY name`)
+}
+
+func (s *SQLiteStore) AccountExists(account string) bool {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM accounts WHERE name = ?)`, account).Scan(&exists)
+	return err == nil && exists
+}
+
+// accountTables are the tables with an account column, which a rename updates.
+var accountTables = []string{
+	"devices", "presets", "recents", "sources", "favorites", "playback_positions",
+	"device_lists", "device_presets", "device_recents", "preset_history",
+}
+
+func (s *SQLiteStore) RenameAccount(account, newName string) error {
+	defer s.lockAccounts(account, newName)()
+
+	if !s.AccountExists(account) {
+		return fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	if s.AccountExists(newName) {
+		return fmt.Errorf("account %s: %w", newName, os.ErrExist)
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		// References are only consistent again once all tables are updated
+		if _, err := tx.Exec(`PRAGMA defer_foreign_keys = ON`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE accounts SET name = ? WHERE name = ?`, newName, account); err != nil {
+			return err
+		}
+		for _, table := range accountTables {
+			if _, err := tx.Exec(`UPDATE `+table+` SET account = ? WHERE account = ?`, newName, account); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteAccount exports an account to the XML layout below the archive
+// directory next to the database, and removes it from the database.
+func (s *SQLiteStore) DeleteAccount(account string) error {
+	defer s.LockAccount(account)()
+
+	if !s.AccountExists(account) {
+		return fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	archive := NewDataStore(filepath.Dir(archivePath(s.archiveRoot, account)))
+	if err := copyAccount(archive, s, account); err != nil {
+		return fmt.Errorf("failed to archive account %s: %w", account, err)
+	}
+	_, err := s.db.Exec(`DELETE FROM accounts WHERE name = ?`, account)
+	return err
+}
+
+func (s *SQLiteStore) ListAccountDevices(account string) ([]string, error) {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM accounts WHERE name = ?)`, account).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("account %s: %w", account, os.ErrNotExist)
+	}
+	return queryStrings(s.db, `SELECT device_id FROM devices WHERE account = ? ORDER BY device_id`, account)
+}
+
+func (s *SQLiteStore) ListAllDevices() ([]models.DeviceInfo, error) {
+	rows, err := s.db.Query(`SELECT info FROM devices ORDER BY account, device_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.DeviceInfo{}
+	seenIDs := make(map[string]bool)
+	for rows.Next() {
+		var info models.DeviceInfo
+		if err := scanJSON(rows, &info); err != nil {
+			return nil, err
+		}
+		key := info.DeviceID
+		if key == "" {
+			key = info.IPAddress
+		}
+		if !seenIDs[key] {
+			devices = append(devices, info)
+			seenIDs[key] = true
+		}
+	}
+	return devices, rows.Err()
+}
+
+func (s *SQLiteStore) FindDeviceByIP(ip string) (string, *models.DeviceInfo, error) {
+	var account, deviceID, data string
+	err := s.db.QueryRow(`SELECT account, device_id, info FROM devices WHERE ip_address = ? ORDER BY account, device_id LIMIT 1`, ip).
+		Scan(&account, &deviceID, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, fmt.Errorf("no device known with IP %s", ip)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var info models.DeviceInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return "", nil, err
+	}
+	if info.DeviceID == "" {
+		info.DeviceID = deviceID
+	}
+	return account, &info, nil
+}
+
+func (s *SQLiteStore) GetDeviceInfo(account, device string) (*models.DeviceInfo, error) {
+	var info models.DeviceInfo
+	err := scanJSON(s.db.QueryRow(`SELECT info FROM devices WHERE account = ? AND device_id = ?`, account, device), &info)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("device %s in account %s: %w", device, account, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (s *SQLiteStore) SaveDeviceInfo(account string, device string, info *models.DeviceInfo) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT OR REPLACE INTO devices (account, device_id, ip_address, info) VALUES (?, ?, ?, ?)`,
+			account, device, info.IPAddress, string(data))
+		return err
+	})
+}
+
+func (s *SQLiteStore) RemoveDevice(account string, device string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM devices WHERE account = ? AND device_id = ?`, account, device); err != nil {
+			return err
+		}
+		// The presets and recents of the device go with it
+		_, err := tx.Exec(`DELETE FROM device_lists WHERE account = ? AND device_id = ?`, account, device)
+		return err
+	})
+}
+
+func (s *SQLiteStore) GetPresets(account string) ([]models.Preset, error) {
+	presets := []models.Preset{}
+	if err := s.getAccountList(account, "presets", &presets); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+func (s *SQLiteStore) SavePresets(account string, presets []models.Preset) error {
+	return saveAccountList(s, account, "presets", presets)
+}
+
+func (s *SQLiteStore) GetRecents(account string) ([]models.Recent, error) {
+	recents := []models.Recent{}
+	if err := s.getAccountList(account, "recents", &recents); err != nil {
+		return nil, err
+	}
+	return recents, nil
+}
+
+func (s *SQLiteStore) SaveRecents(account string, recents []models.Recent) error {
+	return saveAccountList(s, account, "recents", recents)
+}
+
+func (s *SQLiteStore) GetConfiguredSources(account string) ([]models.ConfiguredSource, error) {
+	sources := []models.ConfiguredSource{}
+	if err := s.getAccountList(account, "sources", &sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+func (s *SQLiteStore) SaveConfiguredSources(account string, sources []models.ConfiguredSource) error {
+	sources, err := s.sealSources(sources)
+	if err != nil {
+		return err
+	}
+	return saveAccountList(s, account, "sources", sources)
+}
+
+// getAccountList reads the presets, recents or sources of an account into
+// list, a pointer to a slice. Like a missing XML file, a list that was never
+// saved is reported as os.ErrNotExist.
+func (s *SQLiteStore) getAccountList(account, table string, list interface{}) error {
+	if s.getETag(account, table) == 0 {
+		return fmt.Errorf("%s of account %s: %w", table, account, os.ErrNotExist)
+	}
+
+	return s.queryJSONList(list, `SELECT data FROM `+table+` WHERE account = ? ORDER BY slot`, account)
+}
+
+// queryJSONList reads the JSON column of all rows into list, a pointer to a slice.
+func (s *SQLiteStore) queryJSONList(list interface{}, query string, args ...any) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	raw := []json.RawMessage{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		raw = append(raw, json.RawMessage(data))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	joined, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(joined, list)
+}
+
+// saveAccountList replaces the presets, recents or sources of an account and
+// bumps the matching ETag.
+func saveAccountList[T any](s *SQLiteStore, account, table string, list []T) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE account = ?`, account); err != nil {
+			return err
+		}
+		for i, item := range list {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO `+table+` (account, slot, data) VALUES (?, ?, ?)`, account, i, string(data)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE accounts SET `+table+`_etag = ? WHERE name = ?`, s.nextETag(), account)
+		return err
+	})
+}
+
+func (s *SQLiteStore) GetDevicePresets(account, device string) ([]models.Preset, error) {
+	if s.getDeviceETag(account, device, "presets") == 0 {
+		return s.GetPresets(account)
+	}
+	presets := []models.Preset{}
+	if err := s.queryJSONList(&presets, `SELECT data FROM device_presets WHERE account = ? AND device_id = ? ORDER BY slot`, account, device); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+func (s *SQLiteStore) SaveDevicePresets(account, device string, presets []models.Preset) error {
+	return saveDeviceList(s, account, device, "presets", presets)
+}
+
+func (s *SQLiteStore) GetDeviceRecents(account, device string) ([]models.Recent, error) {
+	if s.getDeviceETag(account, device, "recents") == 0 {
+		return s.GetRecents(account)
+	}
+	recents := []models.Recent{}
+	if err := s.queryJSONList(&recents, `SELECT data FROM device_recents WHERE account = ? AND device_id = ? ORDER BY slot`, account, device); err != nil {
+		return nil, err
+	}
+	return recents, nil
+}
+
+func (s *SQLiteStore) SaveDeviceRecents(account, device string, recents []models.Recent) error {
+	return saveDeviceList(s, account, device, "recents", recents)
+}
+
+func (s *SQLiteStore) HasOwnDeviceLists(account, device string) (presets, recents bool) {
+	return s.getDeviceETag(account, device, "presets") != 0, s.getDeviceETag(account, device, "recents") != 0
+}
+
+// saveDeviceList replaces the presets or recents of a device and bumps the
+// matching ETag.
+func saveDeviceList[T any](s *SQLiteStore, account, device, kind string, list []T) error {
+	if device == "" {
+		return fmt.Errorf("device ID/name cannot be empty")
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO device_lists (account, device_id) VALUES (?, ?)`, account, device); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM device_`+kind+` WHERE account = ? AND device_id = ?`, account, device); err != nil {
+			return err
+		}
+		for i, item := range list {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO device_`+kind+` (account, device_id, slot, data) VALUES (?, ?, ?, ?)`, account, device, i, string(data)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE device_lists SET `+kind+`_etag = ? WHERE account = ? AND device_id = ?`, s.nextETag(), account, device)
+		return err
+	})
+}
+
+func (s *SQLiteStore) getDeviceETag(account, device, kind string) int64 {
+	var etag int64
+	err := s.db.QueryRow(`SELECT `+kind+`_etag FROM device_lists WHERE account = ? AND device_id = ?`, account, device).Scan(&etag)
+	if err != nil {
+		return 0
+	}
+	return etag
+}
+
+func (s *SQLiteStore) getETag(account, table string) int64 {
+	var etag int64
+	if err := s.db.QueryRow(`SELECT `+table+`_etag FROM accounts WHERE name = ?`, account).Scan(&etag); err != nil {
+		return 0
+	}
+	return etag
+}
+
+func (s *SQLiteStore) GetETagForPresets(account string) int64 {
+	return s.getETag(account, "presets")
+}
+
+func (s *SQLiteStore) GetETagForSources(account string) int64 {
+	return s.getETag(account, "sources")
+}
+
+func (s *SQLiteStore) GetETagForRecents(account string) int64 {
+	return s.getETag(account, "recents")
+}
+
+// GetETagForDevicePresets follows GetDevicePresets in falling back to the account.
+func (s *SQLiteStore) GetETagForDevicePresets(account, device string) int64 {
+	if etag := s.getDeviceETag(account, device, "presets"); etag != 0 {
+		return etag
+	}
+	return s.GetETagForPresets(account)
+}
+
+// GetETagForDeviceRecents follows GetDeviceRecents in falling back to the account.
+func (s *SQLiteStore) GetETagForDeviceRecents(account, device string) int64 {
+	if etag := s.getDeviceETag(account, device, "recents"); etag != 0 {
+		return etag
+	}
+	return s.GetETagForRecents(account)
+}
+
+// GetETagForAccount covers everything in the account, including the presets
+// and recents of each device.
+func (s *SQLiteStore) GetETagForAccount(account string) int64 {
+	var etag int64
+	err := s.db.QueryRow(`SELECT max(a.presets_etag, a.recents_etag, a.sources_etag,
+			coalesce((SELECT max(max(d.presets_etag, d.recents_etag)) FROM device_lists d WHERE d.account = a.name), 0))
+		FROM accounts a WHERE a.name = ?`, account).Scan(&etag)
+	if err != nil {
+		return 0
+	}
+	return etag
+}
+
+func (s *SQLiteStore) SaveUsageStats(stats models.UsageStats) error {
+	return s.insertStats("usage_stats", stats.DeviceID, stats)
+}
+
+func (s *SQLiteStore) SaveErrorStats(stats models.ErrorStats) error {
+	return s.insertStats("error_stats", stats.DeviceID, stats)
+}
+
+func (s *SQLiteStore) insertStats(table, deviceID string, stats interface{}) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO `+table+` (device_id, created_at, data) VALUES (?, ?, ?)`,
+		deviceID, time.Now().UnixNano(), string(data))
+	return err
+}
+
+func (s *SQLiteStore) GetStreamStats() (map[string]models.StreamStats, error) {
+	rows, err := s.db.Query(`SELECT url, successes, failures, last_success, last_failure FROM stream_stats`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]models.StreamStats)
+	for rows.Next() {
+		var streamURL string
+		var st models.StreamStats
+		if err := rows.Scan(&streamURL, &st.Successes, &st.Failures, &st.LastSuccess, &st.LastFailure); err != nil {
+			return nil, err
+		}
+		stats[streamURL] = st
+	}
+	return stats, rows.Err()
+}
+
+func (s *SQLiteStore) RecordStreamProbes(results map[string]bool) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return s.inTx(func(tx *sql.Tx) error {
+		for streamURL, ok := range results {
+			var err error
+			if ok {
+				_, err = tx.Exec(`INSERT INTO stream_stats (url, successes, last_success) VALUES (?, 1, ?)
+					ON CONFLICT (url) DO UPDATE SET successes = successes + 1, last_success = excluded.last_success`, streamURL, now)
+			} else {
+				_, err = tx.Exec(`INSERT INTO stream_stats (url, failures, last_failure) VALUES (?, 1, ?)
+					ON CONFLICT (url) DO UPDATE SET failures = failures + 1, last_failure = excluded.last_failure`, streamURL, now)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) SaveStreamStats(stats map[string]models.StreamStats) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM stream_stats`); err != nil {
+			return err
+		}
+		for streamURL, st := range stats {
+			if _, err := tx.Exec(`INSERT INTO stream_stats (url, successes, failures, last_success, last_failure) VALUES (?, ?, ?, ?, ?)`,
+				streamURL, st.Successes, st.Failures, st.LastSuccess, st.LastFailure); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) GetStations() ([]models.Station, error) {
+	rows, err := s.db.Query(`SELECT data FROM stations ORDER BY slot`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stations := []models.Station{}
+	for rows.Next() {
+		var st models.Station
+		if err := scanJSON(rows, &st); err != nil {
+			return nil, err
+		}
+		stations = append(stations, st)
+	}
+	return stations, rows.Err()
+}
+
+func (s *SQLiteStore) SaveStations(stations []models.Station) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM stations`); err != nil {
+			return err
+		}
+		for i, st := range stations {
+			data, err := json.Marshal(st)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO stations (slot, data) VALUES (?, ?)`, i, string(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) GetStation(id string) (*models.Station, error) {
+	return getStation(s, id)
+}
+
+func (s *SQLiteStore) AddStation(station models.Station) (*models.Station, error) {
+	return addStation(s, station)
+}
+
+func (s *SQLiteStore) UpdateStation(station models.Station) error {
+	return updateStation(s, station)
+}
+
+func (s *SQLiteStore) DeleteStation(id string) error {
+	return deleteStation(s, id)
+}
+
+func (s *SQLiteStore) GetFavorites(account string) ([]models.Favorite, error) {
+	rows, err := s.db.Query(`SELECT data FROM favorites WHERE account = ? ORDER BY slot`, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := []models.Favorite{}
+	for rows.Next() {
+		var f models.Favorite
+		if err := scanJSON(rows, &f); err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, f)
+	}
+	return favorites, rows.Err()
+}
+
+func (s *SQLiteStore) SaveFavorites(account string, favorites []models.Favorite) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM favorites WHERE account = ?`, account); err != nil {
+			return err
+		}
+		for i, f := range favorites {
+			data, err := json.Marshal(f)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO favorites (account, slot, data) VALUES (?, ?, ?)`, account, i, string(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) IsFavorite(account, id string) bool {
+	return isFavorite(s, account, id)
+}
+
+func (s *SQLiteStore) AddFavorite(account string, favorite models.Favorite) error {
+	return addFavorite(s, account, favorite)
+}
+
+func (s *SQLiteStore) RemoveFavorite(account, id string) error {
+	return removeFavorite(s, account, id)
+}
+
+func (s *SQLiteStore) GetPlaybackPositions(account string) ([]models.PlaybackPosition, error) {
+	rows, err := s.db.Query(`SELECT data FROM playback_positions WHERE account = ? ORDER BY updated_on DESC`, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []models.PlaybackPosition{}
+	for rows.Next() {
+		var p models.PlaybackPosition
+		if err := scanJSON(rows, &p); err != nil {
+			return nil, err
+		}
+		p.Account = ""
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+func (s *SQLiteStore) GetPlaybackPosition(account, episodeID string) (*models.PlaybackPosition, error) {
+	var p models.PlaybackPosition
+	err := scanJSON(s.db.QueryRow(`SELECT data FROM playback_positions WHERE account = ? AND episode_id = ?`, account, episodeID), &p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no playback position for %s", episodeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Account = ""
+	return &p, nil
+}
+
+func (s *SQLiteStore) GetAllPlaybackPositions() ([]models.PlaybackPosition, error) {
+	return allPlaybackPositions(s)
+}
+
+// SavePlaybackPosition stores the position of an episode, replacing an earlier one.
+func (s *SQLiteStore) SavePlaybackPosition(account string, position models.PlaybackPosition) error {
+	position.Account = ""
+	data, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT OR REPLACE INTO playback_positions (account, episode_id, updated_on, data) VALUES (?, ?, ?, ?)`,
+			account, position.EpisodeID, position.UpdatedOn, string(data))
+		return err
+	})
+}
+
+func (s *SQLiteStore) RemovePlaybackPosition(account, episodeID string) error {
+	res, err := s.db.Exec(`DELETE FROM playback_positions WHERE account = ? AND episode_id = ?`, account, episodeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no playback position for %s", episodeID)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) savePlaybackPositions(account string, positions []models.PlaybackPosition) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM playback_positions WHERE account = ?`, account); err != nil {
+			return err
+		}
+		for _, p := range positions {
+			p.Account = ""
+			data, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO playback_positions (account, episode_id, updated_on, data) VALUES (?, ?, ?, ?)`,
+				account, p.EpisodeID, p.UpdatedOn, string(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddPresetVersion appends a version to the preset history of an account and
+// returns it with its ID. A version that already has an ID keeps it.
+func (s *SQLiteStore) AddPresetVersion(account string, version models.PresetVersion) (*models.PresetVersion, error) {
+	err := s.inTx(func(tx *sql.Tx) error {
+		if err := ensureAccount(tx, account); err != nil {
+			return err
+		}
+		id, err := strconv.Atoi(version.ID)
+		if err != nil {
+			if err := tx.QueryRow(`SELECT coalesce(max(id), 0) + 1 FROM preset_history WHERE account = ?`, account).Scan(&id); err != nil {
+				return err
+			}
+			version.ID = strconv.Itoa(id)
+		}
+		data, err := json.Marshal(version)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO preset_history (account, id, device_id, data) VALUES (?, ?, ?, ?)`,
+			account, id, version.DeviceID, string(data)); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM preset_history WHERE account = ? AND device_id = ? AND id NOT IN
+			(SELECT id FROM preset_history WHERE account = ? AND device_id = ? ORDER BY id DESC LIMIT ?)`,
+			account, version.DeviceID, account, version.DeviceID, maxPresetVersions)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetPresetHistory returns the preset versions of a device, or of all devices
+// of the account if device is empty, most recent first.
+func (s *SQLiteStore) GetPresetHistory(account, device string) ([]models.PresetVersion, error) {
+	history := []models.PresetVersion{}
+	var err error
+	if device == "" {
+		err = s.queryJSONList(&history, `SELECT data FROM preset_history WHERE account = ? ORDER BY id DESC`, account)
+	} else {
+		err = s.queryJSONList(&history, `SELECT data FROM preset_history WHERE account = ? AND device_id = ? ORDER BY id DESC`, account, device)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (s *SQLiteStore) GetPresetVersion(account, id string) (*models.PresetVersion, error) {
+	var version models.PresetVersion
+	err := scanJSON(s.db.QueryRow(`SELECT data FROM preset_history WHERE account = ? AND id = ?`, account, id), &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no preset version %s: %w", id, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanJSON scans a single JSON column into v.
+func scanJSON(row rowScanner, v interface{}) error {
+	var data string
+	if err := row.Scan(&data); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+func queryStrings(db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
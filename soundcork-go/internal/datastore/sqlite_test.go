@@ -0,0 +1,265 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestSQLiteMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "soundcork.db")
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	if version, _ := s.SchemaVersion(); version != len(migrations) {
+		t.Errorf("Expected schema version %d, got %d", len(migrations), version)
+	}
+	s.SavePresets("acc1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}})
+	s.Close()
+
+	// Reopening must not re-run migrations or lose data
+	s, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	presets, err := s.GetPresets("acc1")
+	if err != nil || len(presets) != 1 {
+		t.Errorf("Expected preset to survive reopening, got %+v (%v)", presets, err)
+	}
+	s.Close()
+
+	// A database written by a newer version is refused
+	db, _ := sql.Open("sqlite", path)
+	db.Exec("PRAGMA user_version = 999")
+	db.Close()
+	if _, err := NewSQLiteStore(path); err == nil {
+		t.Error("Expected error opening a database with a newer schema")
+	}
+}
+
+func TestSQLiteImportExport(t *testing.T) {
+	xmlDir := t.TempDir()
+	src := NewDataStore(xmlDir)
+	src.Initialize()
+	src.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{
+		DeviceID:        "dev1",
+		Name:            "Kitchen",
+		ProductCode:     "SoundTouch 10",
+		FirmwareVersion: "27.0.6",
+		IPAddress:       "192.168.1.10",
+	})
+	src.SavePresets("acc1", []models.Preset{{
+		ContentItem:  models.ContentItem{ID: "1", Name: "Radio", Source: "TUNEIN", Type: "stationurl", Location: "/v1/playback/station/s1", IsPresetable: "true"},
+		ContainerArt: "http://example.com/art.png",
+		CreatedOn:    "1700000000",
+		UpdatedOn:    "1700000001",
+	}})
+	src.SaveRecents("acc1", []models.Recent{{
+		ContentItem: models.ContentItem{ID: "7", Name: "Jazz", Source: "TUNEIN", Type: "stationurl", Location: "/v1/playback/station/s7", IsPresetable: "true"},
+		DeviceID:    "dev1",
+		UtcTime:     "1700000002",
+	}})
+	src.SaveConfiguredSources("acc1", []models.ConfiguredSource{{ID: "100001", DisplayName: "AUX IN", SourceKeyType: "AUX", SourceKeyAccount: "AUX"}})
+	src.AddPresetVersion("acc1", models.PresetVersion{DeviceID: "dev1", PresetNumber: 1, Preset: models.Preset{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}, ChangedOn: "2026-01-01T00:00:00Z"})
+	src.AddFavorite("acc1", models.Favorite{ID: "s1", Name: "Radio", CreatedOn: "2026-01-01T00:00:00Z"})
+	src.SavePlaybackPosition("acc1", models.PlaybackPosition{EpisodeID: "t1", Position: 42, UpdatedOn: "2026-01-01T00:00:00Z"})
+	src.AddStation(models.Station{Name: "Local", StreamURLs: []string{"http://local.example.com/live"}})
+
+	db, err := NewSQLiteStore(filepath.Join(t.TempDir(), "soundcork.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer db.Close()
+	if err := Copy(db, src); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	accounts, _ := db.ListAccounts()
+	if !reflect.DeepEqual(accounts, []string{"acc1", "default"}) {
+		t.Errorf("Unexpected accounts after import: %v", accounts)
+	}
+	if _, err := db.GetPresets("default"); err == nil {
+		t.Error("Expected missing presets to stay missing after import")
+	}
+	if account, _, err := db.FindDeviceByIP("192.168.1.10"); err != nil || account != "acc1" {
+		t.Errorf("Expected imported device to be found by IP, got %s (%v)", account, err)
+	}
+
+	exported := NewDataStore(t.TempDir())
+	if err := Copy(exported, db); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// The exported tree must read back exactly like the original one
+	for _, check := range []struct {
+		name string
+		get  func(s Store) (interface{}, error)
+	}{
+		{"device", func(s Store) (interface{}, error) { return s.GetDeviceInfo("acc1", "dev1") }},
+		{"presets", func(s Store) (interface{}, error) { return s.GetPresets("acc1") }},
+		{"recents", func(s Store) (interface{}, error) { return s.GetRecents("acc1") }},
+		{"sources", func(s Store) (interface{}, error) { return s.GetConfiguredSources("acc1") }},
+		{"history", func(s Store) (interface{}, error) { return s.GetPresetHistory("acc1", "") }},
+		{"favorites", func(s Store) (interface{}, error) { return s.GetFavorites("acc1") }},
+		{"positions", func(s Store) (interface{}, error) { return s.GetPlaybackPositions("acc1") }},
+		{"stations", func(s Store) (interface{}, error) { return s.GetStations() }},
+	} {
+		want, err := check.get(src)
+		if err != nil {
+			t.Fatalf("%s: reading original failed: %v", check.name, err)
+		}
+		got, err := check.get(exported)
+		if err != nil {
+			t.Fatalf("%s: reading export failed: %v", check.name, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s differs after round trip:\nwant %+v\ngot  %+v", check.name, want, got)
+		}
+	}
+}
+
+func TestSQLiteImportExport_InheritedDeviceLists(t *testing.T) {
+	src := NewDataStore(t.TempDir())
+	src.Initialize()
+	src.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	src.SaveDeviceInfo("acc1", "dev2", &models.DeviceInfo{DeviceID: "dev2"})
+	src.SavePresets("acc1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Shared"}}})
+	src.SaveRecents("acc1", []models.Recent{{ContentItem: models.ContentItem{ID: "7", Name: "Jazz"}}})
+	src.SaveDevicePresets("acc1", "dev1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Kitchen"}}})
+
+	db, err := NewSQLiteStore(filepath.Join(t.TempDir(), "soundcork.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer db.Close()
+	if err := Copy(db, src); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	exported := NewDataStore(t.TempDir())
+	if err := Copy(exported, db); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	for name, s := range map[string]Store{"sqlite": db, "xml": exported} {
+		if presets, recents := s.HasOwnDeviceLists("acc1", "dev1"); !presets || recents {
+			t.Errorf("%s: expected only own presets of dev1, got presets %v, recents %v", name, presets, recents)
+		}
+		if presets, recents := s.HasOwnDeviceLists("acc1", "dev2"); presets || recents {
+			t.Errorf("%s: expected dev2 to inherit the account lists, got presets %v, recents %v", name, presets, recents)
+		}
+
+		// The inheriting device follows later changes of the account
+		s.SavePresets("acc1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Changed"}}})
+		if presets, _ := s.GetDevicePresets("acc1", "dev2"); len(presets) != 1 || presets[0].Name != "Changed" {
+			t.Errorf("%s: expected dev2 to follow the account presets, got %+v", name, presets)
+		}
+		if presets, _ := s.GetDevicePresets("acc1", "dev1"); len(presets) != 1 || presets[0].Name != "Kitchen" {
+			t.Errorf("%s: expected dev1 to keep its own presets, got %+v", name, presets)
+		}
+	}
+}
+
+func TestSQLiteMigrateDeviceLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "soundcork.db")
+
+	// Set up a database as it was before presets and recents moved to devices
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:3] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+	}
+	db.Exec(`PRAGMA user_version = 3`)
+	db.Exec(`INSERT INTO accounts (name, presets_etag) VALUES ('acc1', 42)`)
+	db.Exec(`INSERT INTO devices (account, device_id, info) VALUES ('acc1', 'dev1', '{}')`)
+	preset, _ := json.Marshal(models.Preset{ContentItem: models.ContentItem{ID: "1", Name: "Shared"}})
+	db.Exec(`INSERT INTO presets (account, slot, data) VALUES ('acc1', 0, ?)`, string(preset))
+	db.Close()
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer s.Close()
+
+	s.SavePresets("acc1", []models.Preset{})
+	presets, err := s.GetDevicePresets("acc1", "dev1")
+	if err != nil || len(presets) != 1 || presets[0].Name != "Shared" {
+		t.Errorf("Expected presets migrated to dev1, got %+v (%v)", presets, err)
+	}
+	if etag := s.GetETagForDevicePresets("acc1", "dev1"); etag != 42 {
+		t.Errorf("Expected migrated presets ETag 42, got %d", etag)
+	}
+}
+
+func TestSQLiteMigrateFavoriteKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "soundcork.db")
+
+	// Set up a database as it was while favorites used camelCase JSON keys
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:5] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+	}
+	db.Exec(`PRAGMA user_version = 5`)
+	db.Exec(`INSERT INTO accounts (name) VALUES ('acc1')`)
+	db.Exec(`INSERT INTO favorites (account, slot, data) VALUES ('acc1', 0, '{"id":"s12345","name":"Radio","imageUrl":"http://example.com/logo.png","createdOn":"2025-10-31T05:00:00Z"}')`)
+	db.Exec(`INSERT INTO favorites (account, slot, data) VALUES ('acc1', 1, '{"id":"s99999"}')`)
+	db.Close()
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer s.Close()
+
+	favorites, err := s.GetFavorites("acc1")
+	want := []models.Favorite{
+		{ID: "s12345", Name: "Radio", ImageUrl: "http://example.com/logo.png", CreatedOn: "2025-10-31T05:00:00Z"},
+		{ID: "s99999"},
+	}
+	if err != nil || !reflect.DeepEqual(favorites, want) {
+		t.Errorf("Expected migrated favorites %+v, got %+v (%v)", want, favorites, err)
+	}
+}
+
+func TestSQLiteDeleteAccount_Archives(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSQLiteStore(filepath.Join(dir, "soundcork.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	defer s.Close()
+	s.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1", Name: "Kitchen"})
+	s.SavePresets("acc1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}})
+
+	if err := s.DeleteAccount("acc1"); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+
+	// The account is exported in the XML layout, ready to be imported again
+	roots, _ := filepath.Glob(filepath.Join(dir, ".archive", "*"))
+	if len(roots) != 1 {
+		t.Fatalf("Expected one archive, found %v", roots)
+	}
+	archive := NewDataStore(roots[0])
+	if info, err := archive.GetDeviceInfo("acc1", "dev1"); err != nil || info.Name != "Kitchen" {
+		t.Errorf("Expected archived device, got %+v (%v)", info, err)
+	}
+	if presets, err := archive.GetPresets("acc1"); err != nil || len(presets) != 1 {
+		t.Errorf("Expected archived presets, got %+v (%v)", presets, err)
+	}
+}
@@ -0,0 +1,140 @@
+package datastore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+type stationsXML struct {
+	XMLName  xml.Name         `xml:"stations"`
+	Stations []models.Station `xml:"station"`
+}
+
+func (ds *DataStore) stationsPath() string {
+	return filepath.Join(ds.DataDir, constants.StationsFile)
+}
+
+// GetStations returns the local station library. A missing library is empty.
+func (ds *DataStore) GetStations() ([]models.Station, error) {
+	path := ds.stationsPath()
+	var wrap stationsXML
+	err := readXMLFile(path, &wrap, "stations")
+	if os.IsNotExist(err) {
+		return []models.Station{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if wrap.Stations == nil {
+		return []models.Station{}, nil
+	}
+	return wrap.Stations, nil
+}
+
+func (ds *DataStore) SaveStations(stations []models.Station) error {
+	if err := os.MkdirAll(ds.DataDir, 0755); err != nil {
+		return err
+	}
+
+	return writeXMLFile(ds.stationsPath(), stationsXML{Stations: stations})
+}
+
+// GetStation returns a single station from the local library.
+func (ds *DataStore) GetStation(id string) (*models.Station, error) {
+	return getStation(ds, id)
+}
+
+// AddStation appends a station to the library and assigns it the next free ID.
+func (ds *DataStore) AddStation(station models.Station) (*models.Station, error) {
+	return addStation(ds, station)
+}
+
+// UpdateStation replaces the station with the same ID.
+func (ds *DataStore) UpdateStation(station models.Station) error {
+	return updateStation(ds, station)
+}
+
+func (ds *DataStore) DeleteStation(id string) error {
+	return deleteStation(ds, id)
+}
+
+// stationLibrary is the storage needed by the station helpers shared between
+// Store implementations.
+type stationLibrary interface {
+	lock(key string) func()
+	GetStations() ([]models.Station, error)
+	SaveStations(stations []models.Station) error
+}
+
+func getStation(lib stationLibrary, id string) (*models.Station, error) {
+	stations, err := lib.GetStations()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range stations {
+		if st.ID == id {
+			return &st, nil
+		}
+	}
+	return nil, fmt.Errorf("station %s not found", id)
+}
+
+func addStation(lib stationLibrary, station models.Station) (*models.Station, error) {
+	defer lib.lock("stations")()
+
+	stations, err := lib.GetStations()
+	if err != nil {
+		return nil, err
+	}
+
+	maxID := 0
+	for _, st := range stations {
+		if id, err := strconv.Atoi(st.ID); err == nil && id > maxID {
+			maxID = id
+		}
+	}
+	station.ID = strconv.Itoa(maxID + 1)
+
+	stations = append(stations, station)
+	if err := lib.SaveStations(stations); err != nil {
+		return nil, err
+	}
+	return &station, nil
+}
+
+func updateStation(lib stationLibrary, station models.Station) error {
+	defer lib.lock("stations")()
+
+	stations, err := lib.GetStations()
+	if err != nil {
+		return err
+	}
+	for i, st := range stations {
+		if st.ID == station.ID {
+			stations[i] = station
+			return lib.SaveStations(stations)
+		}
+	}
+	return fmt.Errorf("station %s not found", station.ID)
+}
+
+func deleteStation(lib stationLibrary, id string) error {
+	defer lib.lock("stations")()
+
+	stations, err := lib.GetStations()
+	if err != nil {
+		return err
+	}
+	for i, st := range stations {
+		if st.ID == id {
+			return lib.SaveStations(append(stations[:i], stations[i+1:]...))
+		}
+	}
+	return fmt.Errorf("station %s not found", id)
+}
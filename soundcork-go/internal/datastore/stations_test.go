@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestStations(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+
+	stations, err := ds.GetStations()
+	if err != nil {
+		t.Fatalf("GetStations on empty store failed: %v", err)
+	}
+	if len(stations) != 0 {
+		t.Fatalf("Expected empty library, got %+v", stations)
+	}
+
+	first, err := ds.AddStation(models.Station{
+		Name:       "Radio One",
+		StreamURLs: []string{"http://one.example.com/live.mp3", "http://one.example.com/live.aac"},
+		Genre:      "Pop",
+	})
+	if err != nil {
+		t.Fatalf("AddStation failed: %v", err)
+	}
+	second, _ := ds.AddStation(models.Station{Name: "Radio Two", StreamURLs: []string{"http://two.example.com"}})
+	if first.ID != "1" || second.ID != "2" {
+		t.Errorf("Expected IDs 1 and 2, got %s and %s", first.ID, second.ID)
+	}
+
+	loaded, err := ds.GetStation("1")
+	if err != nil {
+		t.Fatalf("GetStation failed: %v", err)
+	}
+	if loaded.Name != "Radio One" || len(loaded.StreamURLs) != 2 || loaded.Genre != "Pop" {
+		t.Errorf("Unexpected station: %+v", loaded)
+	}
+
+	loaded.Name = "Radio Uno"
+	if err := ds.UpdateStation(*loaded); err != nil {
+		t.Fatalf("UpdateStation failed: %v", err)
+	}
+	if st, _ := ds.GetStation("1"); st.Name != "Radio Uno" {
+		t.Errorf("Expected updated name, got %s", st.Name)
+	}
+
+	if err := ds.DeleteStation("1"); err != nil {
+		t.Fatalf("DeleteStation failed: %v", err)
+	}
+	if _, err := ds.GetStation("1"); err == nil {
+		t.Error("Expected deleted station to be gone")
+	}
+	if err := ds.DeleteStation("1"); err == nil {
+		t.Error("Expected error deleting unknown station")
+	}
+
+	third, _ := ds.AddStation(models.Station{Name: "Radio Three"})
+	if third.ID != "3" {
+		t.Errorf("Expected ID 3 after deletion, got %s", third.ID)
+	}
+}
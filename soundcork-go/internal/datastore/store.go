@@ -0,0 +1,113 @@
+package datastore
+
+import (
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/secrets"
+)
+
+// DeviceStore keeps the accounts and the devices registered with them.
+// Deleted accounts are archived rather than removed.
+type DeviceStore interface {
+	CreateAccount(account string) error
+	ListAccounts() ([]string, error)
+	AccountExists(account string) bool
+	RenameAccount(account, newName string) error
+	DeleteAccount(account string) error
+	ListAccountDevices(account string) ([]string, error)
+	ListAllDevices() ([]models.DeviceInfo, error)
+	FindDeviceByIP(ip string) (string, *models.DeviceInfo, error)
+	GetDeviceInfo(account, device string) (*models.DeviceInfo, error)
+	SaveDeviceInfo(account string, device string, info *models.DeviceInfo) error
+	RemoveDevice(account string, device string) error
+}
+
+// AccountStore keeps the presets, recents and configured sources of an
+// account. Each device can have its own presets and recents; a device without
+// them uses those of its account. The ETags change whenever the corresponding
+// data is saved. Changes of device presets are kept as a history of versions.
+type AccountStore interface {
+	LockAccount(account string) func()
+
+	GetPresets(account string) ([]models.Preset, error)
+	SavePresets(account string, presets []models.Preset) error
+	GetRecents(account string) ([]models.Recent, error)
+	SaveRecents(account string, recents []models.Recent) error
+	GetDevicePresets(account, device string) ([]models.Preset, error)
+	SaveDevicePresets(account, device string, presets []models.Preset) error
+	GetDeviceRecents(account, device string) ([]models.Recent, error)
+	SaveDeviceRecents(account, device string, recents []models.Recent) error
+	// HasOwnDeviceLists reports whether a device has presets and recents of
+	// its own, rather than using those of its account.
+	HasOwnDeviceLists(account, device string) (presets, recents bool)
+	GetConfiguredSources(account string) ([]models.ConfiguredSource, error)
+	SaveConfiguredSources(account string, sources []models.ConfiguredSource) error
+	// Secrets of sources are encrypted when a key is set. RevealSources
+	// decrypts them for the responses to speakers.
+	SetSecretBox(box *secrets.Box)
+	RevealSources(sources []models.ConfiguredSource) ([]models.ConfiguredSource, error)
+
+	AddPresetVersion(account string, version models.PresetVersion) (*models.PresetVersion, error)
+	GetPresetHistory(account, device string) ([]models.PresetVersion, error)
+	GetPresetVersion(account, id string) (*models.PresetVersion, error)
+
+	GetETagForPresets(account string) int64
+	GetETagForSources(account string) int64
+	GetETagForRecents(account string) int64
+	GetETagForDevicePresets(account, device string) int64
+	GetETagForDeviceRecents(account, device string) int64
+	GetETagForAccount(account string) int64
+}
+
+// StatsStore keeps the stats and events reported by devices, and the results
+// of stream probes.
+type StatsStore interface {
+	SaveUsageStats(stats models.UsageStats) error
+	SaveErrorStats(stats models.ErrorStats) error
+	AddDeviceEvent(deviceID string, event models.DeviceEvent)
+	GetDeviceEvents(deviceID string) []models.DeviceEvent
+	RecordStreamProbes(results map[string]bool) error
+	GetStreamStats() (map[string]models.StreamStats, error)
+	SaveStreamStats(stats map[string]models.StreamStats) error
+}
+
+// LibraryStore keeps the local station library and the BMX favorites and
+// playback positions of each account.
+type LibraryStore interface {
+	GetStations() ([]models.Station, error)
+	GetStation(id string) (*models.Station, error)
+	SaveStations(stations []models.Station) error
+	AddStation(station models.Station) (*models.Station, error)
+	UpdateStation(station models.Station) error
+	DeleteStation(id string) error
+
+	GetFavorites(account string) ([]models.Favorite, error)
+	SaveFavorites(account string, favorites []models.Favorite) error
+	IsFavorite(account, id string) bool
+	AddFavorite(account string, favorite models.Favorite) error
+	RemoveFavorite(account, id string) error
+
+	GetPlaybackPositions(account string) ([]models.PlaybackPosition, error)
+	GetPlaybackPosition(account, episodeID string) (*models.PlaybackPosition, error)
+	GetAllPlaybackPositions() ([]models.PlaybackPosition, error)
+	SavePlaybackPosition(account string, position models.PlaybackPosition) error
+	RemovePlaybackPosition(account, episodeID string) error
+}
+
+// Store is the storage backend used by the server. DataStore keeps the XML
+// layout of the speaker on disk, SQLiteStore uses a single database and
+// MemoryStore keeps everything in memory.
+type Store interface {
+	DeviceStore
+	AccountStore
+	StatsStore
+	LibraryStore
+
+	// Initialize prepares the backend, including the "default" account.
+	Initialize() error
+}
+
+var (
+	_ Store = (*DataStore)(nil)
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
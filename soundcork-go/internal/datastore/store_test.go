@@ -0,0 +1,464 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/secrets"
+)
+
+// TestStores runs the same checks against every Store implementation.
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"xml": func(t *testing.T) Store {
+			return NewDataStore(t.TempDir())
+		},
+		"sqlite": func(t *testing.T) Store {
+			s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "soundcork.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore failed: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Devices", func(t *testing.T) { testStoreDevices(t, newStore(t)) })
+			t.Run("Account", func(t *testing.T) { testStoreAccount(t, newStore(t)) })
+			t.Run("Accounts", func(t *testing.T) { testStoreAccounts(t, newStore(t)) })
+			t.Run("DeviceLists", func(t *testing.T) { testStoreDeviceLists(t, newStore(t)) })
+			t.Run("PresetHistory", func(t *testing.T) { testStorePresetHistory(t, newStore(t)) })
+			t.Run("SourceSecrets", func(t *testing.T) { testStoreSourceSecrets(t, newStore(t)) })
+			t.Run("Stats", func(t *testing.T) { testStoreStats(t, newStore(t)) })
+			t.Run("Library", func(t *testing.T) { testStoreLibrary(t, newStore(t)) })
+		})
+	}
+}
+
+func testStoreDevices(t *testing.T, s Store) {
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	accounts, err := s.ListAccounts()
+	if err != nil || len(accounts) != 1 || accounts[0] != "default" {
+		t.Fatalf("Expected only the default account, got %v (%v)", accounts, err)
+	}
+
+	devices, err := s.ListAllDevices()
+	if err != nil || devices == nil || len(devices) != 0 {
+		t.Fatalf("Expected no devices, got %+v (%v)", devices, err)
+	}
+
+	s.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1", Name: "Kitchen", IPAddress: "192.168.1.10"})
+	s.SaveDeviceInfo("acc1", "dev2", &models.DeviceInfo{DeviceID: "dev2", Name: "Living Room", IPAddress: "192.168.1.11"})
+	if err := s.SaveDeviceInfo("acc1", "", &models.DeviceInfo{}); err == nil {
+		t.Error("Expected error saving a device without ID")
+	}
+
+	ids, err := s.ListAccountDevices("acc1")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("Expected 2 devices in acc1, got %v (%v)", ids, err)
+	}
+	devices, _ = s.ListAllDevices()
+	if len(devices) != 2 {
+		t.Errorf("Expected 2 devices, got %+v", devices)
+	}
+
+	info, err := s.GetDeviceInfo("acc1", "dev1")
+	if err != nil || info.Name != "Kitchen" {
+		t.Errorf("Unexpected device info %+v (%v)", info, err)
+	}
+	if _, err := s.GetDeviceInfo("acc1", "missing"); err == nil {
+		t.Error("Expected error for unknown device")
+	}
+
+	account, found, err := s.FindDeviceByIP("192.168.1.11")
+	if err != nil || account != "acc1" || found.DeviceID != "dev2" {
+		t.Errorf("FindDeviceByIP returned %s, %+v (%v)", account, found, err)
+	}
+	if _, _, err := s.FindDeviceByIP("10.0.0.1"); err == nil {
+		t.Error("Expected error for unknown IP")
+	}
+
+	if err := s.RemoveDevice("acc1", "dev1"); err != nil {
+		t.Fatalf("RemoveDevice failed: %v", err)
+	}
+	ids, _ = s.ListAccountDevices("acc1")
+	if len(ids) != 1 || ids[0] != "dev2" {
+		t.Errorf("Expected only dev2 after removal, got %v", ids)
+	}
+}
+
+func testStoreAccount(t *testing.T, s Store) {
+	account := "acc1"
+
+	if _, err := s.GetPresets(account); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for missing presets, got %v", err)
+	}
+	if _, err := s.GetRecents(account); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for missing recents, got %v", err)
+	}
+	if _, err := s.GetConfiguredSources(account); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for missing sources, got %v", err)
+	}
+	if etag := s.GetETagForAccount(account); etag != 0 {
+		t.Errorf("Expected ETag 0 for empty account, got %d", etag)
+	}
+
+	s.SaveDeviceInfo(account, "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	err := s.SavePresets(account, []models.Preset{{
+		ContentItem: models.ContentItem{ID: "1", Name: "Radio", Source: "TUNEIN", Location: "/v1/playback/station/s1"},
+	}})
+	if err != nil {
+		t.Fatalf("SavePresets failed: %v", err)
+	}
+	presets, err := s.GetPresets(account)
+	if err != nil || len(presets) != 1 || presets[0].Name != "Radio" || presets[0].Location != "/v1/playback/station/s1" {
+		t.Errorf("Unexpected presets %+v (%v)", presets, err)
+	}
+	presetsETag := s.GetETagForPresets(account)
+	if presetsETag == 0 {
+		t.Error("Expected presets ETag after save")
+	}
+
+	s.SaveRecents(account, []models.Recent{{ContentItem: models.ContentItem{ID: "7", Name: "Jazz"}, DeviceID: "dev1"}})
+	recents, err := s.GetRecents(account)
+	if err != nil || len(recents) != 1 || recents[0].DeviceID != "dev1" {
+		t.Errorf("Unexpected recents %+v (%v)", recents, err)
+	}
+
+	s.SaveConfiguredSources(account, []models.ConfiguredSource{{ID: "100001", DisplayName: "AUX IN", SourceKeyType: "AUX"}})
+	sources, err := s.GetConfiguredSources(account)
+	if err != nil || len(sources) != 1 || sources[0].SourceKeyType != "AUX" {
+		t.Errorf("Unexpected sources %+v (%v)", sources, err)
+	}
+
+	if s.GetETagForRecents(account) == 0 || s.GetETagForSources(account) == 0 {
+		t.Error("Expected recents and sources ETags after save")
+	}
+	if s.GetETagForAccount(account) < presetsETag {
+		t.Error("Expected account ETag to cover the presets ETag")
+	}
+}
+
+func testStoreAccounts(t *testing.T, s Store) {
+	if err := NewAccount(s, "../etc"); err == nil {
+		t.Error("Expected error creating an account with an invalid name")
+	}
+	for _, name := range []string{"stats", "cache", "tls"} {
+		if err := NewAccount(s, name); err == nil {
+			t.Errorf("Expected error creating an account with the reserved name %s", name)
+		}
+	}
+	if err := NewAccount(s, "acc1"); err != nil {
+		t.Fatalf("NewAccount failed: %v", err)
+	}
+	if !s.AccountExists("acc1") || s.AccountExists("acc2") {
+		t.Error("AccountExists does not match the created accounts")
+	}
+	if err := NewAccount(s, "acc1"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected ErrExist creating acc1 again, got %v", err)
+	}
+
+	// New accounts start with empty lists instead of missing ones
+	if presets, err := s.GetPresets("acc1"); err != nil || len(presets) != 0 {
+		t.Errorf("Expected empty presets, got %+v (%v)", presets, err)
+	}
+	if recents, err := s.GetRecents("acc1"); err != nil || len(recents) != 0 {
+		t.Errorf("Expected empty recents, got %+v (%v)", recents, err)
+	}
+	if sources, err := s.GetConfiguredSources("acc1"); err != nil || len(sources) != 0 {
+		t.Errorf("Expected empty sources, got %+v (%v)", sources, err)
+	}
+
+	s.SaveDeviceInfo("acc1", "dev1", &models.DeviceInfo{DeviceID: "dev1", IPAddress: "192.168.1.10"})
+	s.SaveDevicePresets("acc1", "dev1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}})
+	s.AddFavorite("acc1", models.Favorite{ID: "s1"})
+	NewAccount(s, "acc3")
+
+	if err := s.RenameAccount("acc1", "acc3"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected ErrExist renaming onto acc3, got %v", err)
+	}
+	if err := s.RenameAccount("missing", "acc4"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist renaming a missing account, got %v", err)
+	}
+	if err := s.RenameAccount("acc1", "acc2"); err != nil {
+		t.Fatalf("RenameAccount failed: %v", err)
+	}
+	if s.AccountExists("acc1") {
+		t.Error("Expected acc1 to be gone after rename")
+	}
+	if account, _, err := s.FindDeviceByIP("192.168.1.10"); err != nil || account != "acc2" {
+		t.Errorf("Expected device to move to acc2, got %s (%v)", account, err)
+	}
+	if presets, _ := s.GetDevicePresets("acc2", "dev1"); len(presets) != 1 || presets[0].Name != "Radio" {
+		t.Errorf("Expected device presets to move to acc2, got %+v", presets)
+	}
+	if !s.IsFavorite("acc2", "s1") {
+		t.Error("Expected favorites to move to acc2")
+	}
+
+	if err := s.DeleteAccount("acc2"); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+	if err := s.DeleteAccount("acc2"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist deleting acc2 again, got %v", err)
+	}
+	accounts, _ := s.ListAccounts()
+	if len(accounts) != 1 || accounts[0] != "acc3" {
+		t.Errorf("Expected only acc3 to be left, got %v", accounts)
+	}
+	if _, _, err := s.FindDeviceByIP("192.168.1.10"); err == nil {
+		t.Error("Expected devices of a deleted account to be gone")
+	}
+}
+
+func testStoreDeviceLists(t *testing.T, s Store) {
+	account := "acc1"
+	s.SaveDeviceInfo(account, "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	s.SaveDeviceInfo(account, "dev2", &models.DeviceInfo{DeviceID: "dev2"})
+
+	if _, err := s.GetDevicePresets(account, "dev1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for missing device presets, got %v", err)
+	}
+
+	// Without own lists, a device sees those of its account
+	s.SavePresets(account, []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Shared"}}})
+	s.SaveRecents(account, []models.Recent{{ContentItem: models.ContentItem{ID: "7", Name: "Jazz"}}})
+	presets, err := s.GetDevicePresets(account, "dev1")
+	if err != nil || len(presets) != 1 || presets[0].Name != "Shared" {
+		t.Errorf("Expected account presets as fallback, got %+v (%v)", presets, err)
+	}
+	if s.GetETagForDevicePresets(account, "dev1") != s.GetETagForPresets(account) {
+		t.Error("Expected the device presets ETag to fall back to the account")
+	}
+
+	if err := s.SaveDevicePresets(account, "dev1", []models.Preset{{ContentItem: models.ContentItem{ID: "1", Name: "Kitchen"}}}); err != nil {
+		t.Fatalf("SaveDevicePresets failed: %v", err)
+	}
+	if err := s.SaveDeviceRecents(account, "dev1", []models.Recent{}); err != nil {
+		t.Fatalf("SaveDeviceRecents failed: %v", err)
+	}
+	if err := s.SaveDevicePresets(account, "", nil); err == nil {
+		t.Error("Expected error saving presets without device")
+	}
+
+	if presets, recents := s.HasOwnDeviceLists(account, "dev1"); !presets || !recents {
+		t.Errorf("Expected own lists of dev1, got presets %v, recents %v", presets, recents)
+	}
+	if presets, recents := s.HasOwnDeviceLists(account, "dev2"); presets || recents {
+		t.Errorf("Expected dev2 to use the account lists, got presets %v, recents %v", presets, recents)
+	}
+	presets, _ = s.GetDevicePresets(account, "dev1")
+	if len(presets) != 1 || presets[0].Name != "Kitchen" {
+		t.Errorf("Expected own presets of dev1, got %+v", presets)
+	}
+	if recents, err := s.GetDeviceRecents(account, "dev1"); err != nil || len(recents) != 0 {
+		t.Errorf("Expected empty recents of dev1, got %+v (%v)", recents, err)
+	}
+	presets, _ = s.GetDevicePresets(account, "dev2")
+	if len(presets) != 1 || presets[0].Name != "Shared" {
+		t.Errorf("Expected dev2 to keep the account presets, got %+v", presets)
+	}
+	if shared, _ := s.GetPresets(account); len(shared) != 1 || shared[0].Name != "Shared" {
+		t.Errorf("Expected account presets to stay unchanged, got %+v", shared)
+	}
+
+	deviceETag := s.GetETagForDevicePresets(account, "dev1")
+	if deviceETag == 0 || deviceETag == s.GetETagForPresets(account) {
+		t.Errorf("Expected own presets ETag for dev1, got %d", deviceETag)
+	}
+	if s.GetETagForAccount(account) < deviceETag {
+		t.Error("Expected account ETag to cover the device presets ETag")
+	}
+
+	// Removing a device drops its lists
+	s.RemoveDevice(account, "dev1")
+	s.SaveDeviceInfo(account, "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+	presets, _ = s.GetDevicePresets(account, "dev1")
+	if len(presets) != 1 || presets[0].Name != "Shared" {
+		t.Errorf("Expected a re-added device to start from the account presets, got %+v", presets)
+	}
+}
+
+func testStorePresetHistory(t *testing.T, s Store) {
+	account := "acc1"
+	if history, err := s.GetPresetHistory(account, ""); err != nil || history == nil || len(history) != 0 {
+		t.Errorf("Expected empty history, got %+v (%v)", history, err)
+	}
+
+	first, err := s.AddPresetVersion(account, models.PresetVersion{DeviceID: "dev1", PresetNumber: 1,
+		Preset: models.Preset{ContentItem: models.ContentItem{ID: "1", Name: "Radio"}}})
+	if err != nil || first.ID != "1" {
+		t.Fatalf("AddPresetVersion returned %+v (%v)", first, err)
+	}
+	s.AddPresetVersion(account, models.PresetVersion{DeviceID: "dev2", PresetNumber: 1})
+	second, _ := s.AddPresetVersion(account, models.PresetVersion{DeviceID: "dev1", PresetNumber: 1,
+		Preset:   models.Preset{ContentItem: models.ContentItem{ID: "1", Name: "Jazz"}},
+		Previous: &first.Preset})
+	if second.ID != "3" {
+		t.Errorf("Expected third version to get ID 3, got %s", second.ID)
+	}
+
+	history, err := s.GetPresetHistory(account, "dev1")
+	if err != nil || len(history) != 2 || history[0].ID != "3" || history[1].ID != "1" {
+		t.Fatalf("Expected versions 3 and 1 of dev1, got %+v (%v)", history, err)
+	}
+	if history[0].Previous == nil || history[0].Previous.Name != "Radio" {
+		t.Errorf("Expected previous preset to be kept, got %+v", history[0].Previous)
+	}
+	if all, _ := s.GetPresetHistory(account, ""); len(all) != 3 {
+		t.Errorf("Expected 3 versions in the account, got %d", len(all))
+	}
+
+	if v, err := s.GetPresetVersion(account, "3"); err != nil || v.Preset.Name != "Jazz" {
+		t.Errorf("GetPresetVersion returned %+v (%v)", v, err)
+	}
+	if _, err := s.GetPresetVersion(account, "99"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for unknown version, got %v", err)
+	}
+
+	// Only the latest versions of each device are kept
+	for i := 0; i < maxPresetVersions; i++ {
+		s.AddPresetVersion(account, models.PresetVersion{DeviceID: "dev1", PresetNumber: 2})
+	}
+	if history, _ := s.GetPresetHistory(account, "dev1"); len(history) != maxPresetVersions {
+		t.Errorf("Expected %d versions of dev1, got %d", maxPresetVersions, len(history))
+	}
+	if history, _ := s.GetPresetHistory(account, "dev2"); len(history) != 1 {
+		t.Errorf("Expected dev2 history to be unaffected, got %d versions", len(history))
+	}
+}
+
+func newTestSecretBox(t *testing.T) *secrets.Box {
+	key, _ := secrets.GenerateKey()
+	box, err := secrets.LoadBox(key, "")
+	if err != nil {
+		t.Fatalf("LoadBox failed: %v", err)
+	}
+	return box
+}
+
+func testStoreSourceSecrets(t *testing.T, s Store) {
+	s.SaveConfiguredSources("acc1", []models.ConfiguredSource{{ID: "1", Secret: "token1"}})
+
+	box := newTestSecretBox(t)
+	s.SetSecretBox(box)
+	sources, _ := s.GetConfiguredSources("acc1")
+	if len(sources) != 1 || sources[0].Secret != "token1" {
+		t.Errorf("Expected existing secret to stay readable, got %+v", sources)
+	}
+
+	input := []models.ConfiguredSource{{ID: "1", Secret: "token1"}, {ID: "2"}}
+	if err := s.SaveConfiguredSources("acc1", input); err != nil {
+		t.Fatalf("SaveConfiguredSources failed: %v", err)
+	}
+	if input[0].Secret != "token1" {
+		t.Error("Expected the saved sources not to be modified")
+	}
+	sources, _ = s.GetConfiguredSources("acc1")
+	if len(sources) != 2 || !secrets.IsEncrypted(sources[0].Secret) || sources[1].Secret != "" {
+		t.Fatalf("Expected encrypted secrets, got %+v", sources)
+	}
+	revealed, err := s.RevealSources(sources)
+	if err != nil || revealed[0].Secret != "token1" || !secrets.IsEncrypted(sources[0].Secret) {
+		t.Errorf("RevealSources returned %+v (%v)", revealed, err)
+	}
+
+	newBox := newTestSecretBox(t)
+	s.SetSecretBox(newBox)
+	if _, err := s.RevealSources(sources); !errors.Is(err, secrets.ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey before rotating, got %v", err)
+	}
+	for range 2 {
+		// Running it again after it completed changes nothing
+		if n, err := RotateSecrets(s, box); err != nil || n != 1 {
+			t.Fatalf("RotateSecrets returned %d (%v)", n, err)
+		}
+	}
+	sources, _ = s.GetConfiguredSources("acc1")
+	if revealed, err := s.RevealSources(sources); err != nil || revealed[0].Secret != "token1" {
+		t.Errorf("Expected secrets readable with the new key, got %+v (%v)", revealed, err)
+	}
+}
+
+func testStoreStats(t *testing.T, s Store) {
+	if err := s.SaveUsageStats(models.UsageStats{DeviceID: "dev1"}); err != nil {
+		t.Errorf("SaveUsageStats failed: %v", err)
+	}
+	if err := s.SaveErrorStats(models.ErrorStats{DeviceID: "dev1"}); err != nil {
+		t.Errorf("SaveErrorStats failed: %v", err)
+	}
+
+	if events := s.GetDeviceEvents("dev1"); events == nil || len(events) != 0 {
+		t.Errorf("Expected no events, got %+v", events)
+	}
+	for i := 0; i < maxDeviceEvents+5; i++ {
+		s.AddDeviceEvent("dev1", models.DeviceEvent{Type: "test"})
+	}
+	if events := s.GetDeviceEvents("dev1"); len(events) != maxDeviceEvents {
+		t.Errorf("Expected %d events, got %d", maxDeviceEvents, len(events))
+	}
+
+	s.RecordStreamProbes(map[string]bool{"http://a.example.com": true})
+	s.RecordStreamProbes(map[string]bool{"http://a.example.com": false})
+	stats, err := s.GetStreamStats()
+	if err != nil {
+		t.Fatalf("GetStreamStats failed: %v", err)
+	}
+	if st := stats["http://a.example.com"]; st.Successes != 1 || st.Failures != 1 {
+		t.Errorf("Unexpected stream stats %+v", st)
+	}
+
+	if err := s.SaveStreamStats(map[string]models.StreamStats{"http://b.example.com": {Successes: 3}}); err != nil {
+		t.Fatalf("SaveStreamStats failed: %v", err)
+	}
+	stats, _ = s.GetStreamStats()
+	if len(stats) != 1 || stats["http://b.example.com"].Successes != 3 {
+		t.Errorf("Expected the saved stream stats only, got %+v", stats)
+	}
+
+	if accounts, _ := s.ListAccounts(); len(accounts) != 0 {
+		t.Errorf("Expected stats not to show up as accounts, got %v", accounts)
+	}
+}
+
+func testStoreLibrary(t *testing.T, s Store) {
+	created, err := s.AddStation(models.Station{Name: "Radio One", StreamURLs: []string{"http://one.example.com"}})
+	if err != nil || created.ID != "1" {
+		t.Fatalf("AddStation returned %+v (%v)", created, err)
+	}
+	if st, err := s.GetStation("1"); err != nil || st.Name != "Radio One" {
+		t.Errorf("GetStation returned %+v (%v)", st, err)
+	}
+	if err := s.DeleteStation("1"); err != nil {
+		t.Errorf("DeleteStation failed: %v", err)
+	}
+
+	s.AddFavorite("acc1", models.Favorite{ID: "s1", Name: "Station"})
+	if !s.IsFavorite("acc1", "s1") || s.IsFavorite("acc2", "s1") {
+		t.Error("Expected favorite to be stored per account")
+	}
+
+	s.SavePlaybackPosition("acc1", models.PlaybackPosition{EpisodeID: "e1", Position: 10, UpdatedOn: "2026-01-01T00:00:00Z"})
+	s.SavePlaybackPosition("acc1", models.PlaybackPosition{EpisodeID: "e2", Position: 20, UpdatedOn: "2026-01-02T00:00:00Z"})
+	positions, err := s.GetPlaybackPositions("acc1")
+	if err != nil || len(positions) != 2 || positions[0].EpisodeID != "e2" {
+		t.Errorf("Unexpected positions %+v (%v)", positions, err)
+	}
+	all, err := s.GetAllPlaybackPositions()
+	if err != nil || len(all) != 2 || all[0].Account != "acc1" {
+		t.Errorf("Unexpected positions of all accounts %+v (%v)", all, err)
+	}
+	if err := s.RemovePlaybackPosition("acc1", "e1"); err != nil {
+		t.Errorf("RemovePlaybackPosition failed: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func (ds *DataStore) streamStatsPath() string {
+	return filepath.Join(ds.DataDir, constants.StatsDir, "streams.json")
+}
+
+// GetStreamStats returns the recorded probe results per stream URL.
+func (ds *DataStore) GetStreamStats() (map[string]models.StreamStats, error) {
+	ds.statsMutex.Lock()
+	defer ds.statsMutex.Unlock()
+	return ds.readStreamStats()
+}
+
+// RecordStreamProbes adds the outcome of a probe round to the stream stats.
+func (ds *DataStore) RecordStreamProbes(results map[string]bool) error {
+	ds.statsMutex.Lock()
+	defer ds.statsMutex.Unlock()
+
+	stats, err := ds.readStreamStats()
+	if err != nil {
+		return err
+	}
+
+	addStreamProbes(stats, results)
+
+	path := ds.streamStatsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// SaveStreamStats replaces the stream stats, e.g. when importing an archive.
+func (ds *DataStore) SaveStreamStats(stats map[string]models.StreamStats) error {
+	ds.statsMutex.Lock()
+	defer ds.statsMutex.Unlock()
+
+	path := ds.streamStatsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (ds *DataStore) readStreamStats() (map[string]models.StreamStats, error) {
+	stats := make(map[string]models.StreamStats)
+	path := ds.streamStatsPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("malformed stream stats at %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+func addStreamProbes(stats map[string]models.StreamStats, results map[string]bool) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for streamURL, ok := range results {
+		st := stats[streamURL]
+		if ok {
+			st.Successes++
+			st.LastSuccess = now
+		} else {
+			st.Failures++
+			st.LastFailure = now
+		}
+		stats[streamURL] = st
+	}
+}
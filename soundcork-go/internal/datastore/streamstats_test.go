@@ -0,0 +1,28 @@
+package datastore
+
+import (
+	"testing"
+)
+
+func TestStreamStats(t *testing.T) {
+	ds := NewDataStore(t.TempDir())
+
+	stats, err := ds.GetStreamStats()
+	if err != nil || len(stats) != 0 {
+		t.Fatalf("Expected empty stats, got %+v (err %v)", stats, err)
+	}
+
+	ds.RecordStreamProbes(map[string]bool{"http://a.example.com": true, "http://b.example.com": false})
+	ds.RecordStreamProbes(map[string]bool{"http://a.example.com": true})
+
+	stats, err = NewDataStore(ds.DataDir).GetStreamStats()
+	if err != nil {
+		t.Fatalf("GetStreamStats failed: %v", err)
+	}
+	if a := stats["http://a.example.com"]; a.Successes != 2 || a.Failures != 0 || a.LastSuccess == "" {
+		t.Errorf("Unexpected stats for a: %+v", a)
+	}
+	if b := stats["http://b.example.com"]; b.Successes != 0 || b.Failures != 1 || b.LastFailure == "" {
+		t.Errorf("Unexpected stats for b: %+v", b)
+	}
+}
@@ -0,0 +1,168 @@
+// Package jwt signs and verifies the HS256 JSON Web Tokens soundcork issues
+// to the speakers.
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Issuer is set on every token signed by soundcork.
+const Issuer = "soundcork"
+
+var (
+	// ErrMalformed is returned for values that are not an HS256 JWT.
+	ErrMalformed = errors.New("malformed token")
+	// ErrSignature is returned for tokens not signed with the expected secret.
+	ErrSignature = errors.New("invalid token signature")
+	// ErrExpired is returned for tokens past their expiry.
+	ErrExpired = errors.New("token expired")
+)
+
+// Claims are the registered claims used by soundcork plus the account and
+// device a token is bound to.
+type Claims struct {
+	ID        string `json:"jti,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Device    string `json:"device,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Sign returns claims as a JWT signed with secret. Issuer and ID are filled
+// in if empty.
+func Sign(secret []byte, claims Claims) (string, error) {
+	if len(secret) == 0 {
+		return "", fmt.Errorf("token secret is not configured")
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = Issuer
+	}
+	if claims.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return "", err
+		}
+		claims.ID = id
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + signature(secret, signingInput), nil
+}
+
+// NewID returns a random token ID.
+func NewID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Peek returns the claims of token without verifying it, e.g. to tell which
+// secret it has to be verified with.
+func Peek(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	h, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+	}
+	if json.Unmarshal(h, &hdr) != nil || hdr.Alg != "HS256" {
+		return nil, ErrMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	return &claims, nil
+}
+
+// Verify checks the signature of token against secret and that it has not
+// expired at now, and returns its claims.
+func Verify(secret []byte, token string, now time.Time) (*Claims, error) {
+	claims, err := Peek(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, ErrSignature
+	}
+	i := strings.LastIndex(token, ".")
+	if !hmac.Equal([]byte(token[i+1:]), []byte(signature(secret, token[:i]))) {
+		return nil, ErrSignature
+	}
+	if claims.ExpiresAt != 0 && now.Unix() >= claims.ExpiresAt {
+		return claims, ErrExpired
+	}
+	return claims, nil
+}
+
+// LoadOrCreateSecret returns the secret stored in the file at path. Without
+// the file, it stores a new random secret there, so tokens stay valid across
+// restarts.
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("token secret file %s is empty", path)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	secret := []byte(hex.EncodeToString(b))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(secret, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return secret, f.Close()
+}
+
+func signature(secret []byte, signingInput string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
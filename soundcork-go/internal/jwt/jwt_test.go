@@ -0,0 +1,79 @@
+package jwt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+
+	if _, err := Sign(nil, Claims{}); err == nil {
+		t.Error("Expected error without secret")
+	}
+
+	token, err := Sign(secret, Claims{Account: "1234567", Device: "DEV1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	claims, err := Verify(secret, token, now)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.Issuer != Issuer || claims.ID == "" || claims.Account != "1234567" || claims.Device != "DEV1" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	if _, err := Verify([]byte("other"), token, now); !errors.Is(err, ErrSignature) {
+		t.Errorf("Expected ErrSignature for another secret, got %v", err)
+	}
+	if _, err := Verify(secret, token, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+
+	// Changing the claims invalidates the signature
+	forged, _ := Sign([]byte("other"), Claims{Account: "other", Device: "DEV1"})
+	parts, forgedParts := strings.Split(token, "."), strings.Split(forged, ".")
+	if _, err := Verify(secret, parts[0]+"."+forgedParts[1]+"."+parts[2], now); !errors.Is(err, ErrSignature) {
+		t.Errorf("Expected ErrSignature for changed claims, got %v", err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	for _, token := range []string{"", "soundcork-local-token-1700000000", "a.b.c", "eyJhbGciOiJub25lIn0.e30."} {
+		if _, err := Peek(token); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Expected ErrMalformed for %q, got %v", token, err)
+		}
+	}
+
+	token, _ := Sign([]byte("secret"), Claims{Audience: "marge"})
+	if claims, err := Peek(token); err != nil || claims.Audience != "marge" {
+		t.Errorf("Peek returned %+v (%v)", claims, err)
+	}
+}
+
+func TestLoadOrCreateSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token_secret")
+	secret, err := LoadOrCreateSecret(path)
+	if err != nil || len(secret) != 64 {
+		t.Fatalf("Expected a new secret, got %q (%v)", secret, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the secret file to be private, got %v", info.Mode())
+	}
+	if again, err := LoadOrCreateSecret(path); err != nil || !bytes.Equal(again, secret) {
+		t.Errorf("Expected the stored secret, got %q (%v)", again, err)
+	}
+
+	os.WriteFile(path, []byte("\n"), 0600)
+	if _, err := LoadOrCreateSecret(path); err == nil {
+		t.Error("Expected error for an empty secret file")
+	}
+}
@@ -2,9 +2,12 @@ package marge
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gesellix/bose-soundtouch-api/internal/constants"
@@ -97,12 +100,22 @@ func GetConfiguredSourceXML(cs models.ConfiguredSource) string {
 		cs.ID, DateStr, cs.Secret, cs.SourceKeyAccount, providerID, cs.DisplayName, DateStr, cs.SourceKeyAccount)
 }
 
-func PresetsToXML(ds *datastore.DataStore, account string) ([]byte, error) {
-	presets, err := ds.GetPresets(account)
+// accountSources returns the sources of account with the secrets the
+// speakers need, decrypted if they are stored encrypted.
+func accountSources(ds datastore.Store, account string) ([]models.ConfiguredSource, error) {
+	sources, err := ds.GetConfiguredSources(account)
 	if err != nil {
 		return nil, err
 	}
-	sources, err := ds.GetConfiguredSources(account)
+	return ds.RevealSources(sources)
+}
+
+func PresetsToXML(ds datastore.Store, account, device string) ([]byte, error) {
+	presets, err := ds.GetDevicePresets(account, device)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := accountSources(ds, account)
 	if err != nil {
 		return nil, err
 	}
@@ -137,12 +150,12 @@ func PresetsToXML(ds *datastore.DataStore, account string) ([]byte, error) {
 	return append([]byte(xml.Header), []byte(res)...), nil
 }
 
-func RecentsToXML(ds *datastore.DataStore, account string) ([]byte, error) {
-	recents, err := ds.GetRecents(account)
+func RecentsToXML(ds datastore.Store, account, device string) ([]byte, error) {
+	recents, err := ds.GetDeviceRecents(account, device)
 	if err != nil {
 		return nil, err
 	}
-	sources, err := ds.GetConfiguredSources(account)
+	sources, err := accountSources(ds, account)
 	if err != nil {
 		return nil, err
 	}
@@ -188,52 +201,48 @@ func SoftwareUpdateToXML() string {
 	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><software_update><softwareUpdateLocation></softwareUpdateLocation></software_update>`
 }
 
-func AccountFullToXML(ds *datastore.DataStore, account string) ([]byte, error) {
-	devicesDir := ds.AccountDevicesDir(account)
-	entries, err := os.ReadDir(devicesDir)
+func AccountFullToXML(ds datastore.Store, account string) ([]byte, error) {
+	deviceIDs, err := ds.ListAccountDevices(account)
 	if err != nil {
 		return nil, err
 	}
 
 	res := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><account id="%s"><accountStatus>OK</accountStatus><devices>`, account)
 	lastDeviceID := ""
-	for _, entry := range entries {
-		if entry.IsDir() {
-			deviceID := entry.Name()
-			lastDeviceID = deviceID
-			info, err := ds.GetDeviceInfo(account, deviceID)
-			if err != nil {
-				continue
-			}
+	for _, deviceID := range deviceIDs {
+		lastDeviceID = deviceID
+		info, err := ds.GetDeviceInfo(account, deviceID)
+		if err != nil {
+			continue
+		}
 
-			res += fmt.Sprintf(`<device deviceid="%s">`, deviceID)
-			res += fmt.Sprintf(`<attachedProduct product_code="%s"><components/><productlabel>%s</productlabel><serialnumber>%s</serialnumber></attachedProduct>`,
-				info.ProductCode, info.ProductCode, info.ProductSerialNumber)
-			res += fmt.Sprintf(`<createdOn>%s</createdOn>`, DateStr)
-			res += fmt.Sprintf(`<firmwareVersion>%s</firmwareVersion>`, info.FirmwareVersion)
-			res += fmt.Sprintf(`<ipaddress>%s</ipaddress>`, info.IPAddress)
-			res += fmt.Sprintf(`<name>%s</name>`, info.Name)
-
-			presets, _ := PresetsToXML(ds, account)
-			if len(presets) > len(xml.Header) {
-				res += string(presets[len(xml.Header):]) // strip header
-			}
+		res += fmt.Sprintf(`<device deviceid="%s">`, deviceID)
+		res += fmt.Sprintf(`<attachedProduct product_code="%s"><components/><productlabel>%s</productlabel><serialnumber>%s</serialnumber></attachedProduct>`,
+			info.ProductCode, info.ProductCode, info.ProductSerialNumber)
+		res += fmt.Sprintf(`<createdOn>%s</createdOn>`, DateStr)
+		res += fmt.Sprintf(`<firmwareVersion>%s</firmwareVersion>`, info.FirmwareVersion)
+		res += fmt.Sprintf(`<ipaddress>%s</ipaddress>`, info.IPAddress)
+		res += fmt.Sprintf(`<name>%s</name>`, info.Name)
 
-			recents, _ := RecentsToXML(ds, account)
-			if len(recents) > len(xml.Header) {
-				res += string(recents[len(xml.Header):]) // strip header
-			}
+		presets, _ := PresetsToXML(ds, account, deviceID)
+		if len(presets) > len(xml.Header) {
+			res += string(presets[len(xml.Header):]) // strip header
+		}
 
-			res += fmt.Sprintf(`<serialnumber>%s</serialnumber>`, info.DeviceSerialNumber)
-			res += fmt.Sprintf(`<updatedOn>%s</updatedOn>`, DateStr)
-			res += `</device>`
+		recents, _ := RecentsToXML(ds, account, deviceID)
+		if len(recents) > len(xml.Header) {
+			res += string(recents[len(xml.Header):]) // strip header
 		}
+
+		res += fmt.Sprintf(`<serialnumber>%s</serialnumber>`, info.DeviceSerialNumber)
+		res += fmt.Sprintf(`<updatedOn>%s</updatedOn>`, DateStr)
+		res += `</device>`
 	}
 	res += `</devices><mode>global</mode><preferredLanguage>en</preferredLanguage>`
 	res += ProviderSettingsToXML(account)
 
 	if lastDeviceID != "" {
-		sources, _ := ds.GetConfiguredSources(account)
+		sources, _ := accountSources(ds, account)
 		res += `<sources>`
 		for _, s := range sources {
 			res += GetConfiguredSourceXML(s)
@@ -245,12 +254,15 @@ func AccountFullToXML(ds *datastore.DataStore, account string) ([]byte, error) {
 	return []byte(res), nil
 }
 
-func UpdatePreset(ds *datastore.DataStore, account string, device string, presetNumber int, sourceXML []byte) ([]byte, error) {
-	sources, err := ds.GetConfiguredSources(account)
+func UpdatePreset(ds datastore.Store, account string, device string, presetNumber int, sourceXML []byte) ([]byte, error) {
+	// Speakers of the same account may update concurrently
+	defer ds.LockAccount(account)()
+
+	sources, err := accountSources(ds, account)
 	if err != nil {
 		return nil, err
 	}
-	presets, err := ds.GetPresets(account)
+	presets, err := ds.GetDevicePresets(account, device)
 	if err != nil {
 		return nil, err
 	}
@@ -266,6 +278,19 @@ func UpdatePreset(ds *datastore.DataStore, account string, device string, preset
 		return nil, err
 	}
 
+	// Stations from the local library can be preset by location alone;
+	// fill in what the speaker left out from the catalog.
+	if stationID, ok := strings.CutPrefix(newPresetElem.Location, constants.LibraryStationPath); ok {
+		if station, err := ds.GetStation(stationID); err == nil {
+			if newPresetElem.Name == "" {
+				newPresetElem.Name = station.Name
+			}
+			if newPresetElem.ContainerArt == "" {
+				newPresetElem.ContainerArt = station.Logo
+			}
+		}
+	}
+
 	var matchingSrc *models.ConfiguredSource
 	for _, s := range sources {
 		if s.ID == newPresetElem.SourceID {
@@ -293,13 +318,7 @@ func UpdatePreset(ds *datastore.DataStore, account string, device string, preset
 		UpdatedOn:    nowStr,
 	}
 
-	// Ensure presets list is large enough
-	for len(presets) < presetNumber {
-		presets = append(presets, models.Preset{})
-	}
-	presets[presetNumber-1] = presetObj
-
-	if err := ds.SavePresets(account, presets); err != nil {
+	if _, err := storePreset(ds, account, device, presets, presetNumber, presetObj, ""); err != nil {
 		return nil, err
 	}
 
@@ -317,12 +336,81 @@ func UpdatePreset(ds *datastore.DataStore, account string, device string, preset
 	return append([]byte(xml.Header), []byte(res)...), nil
 }
 
-func AddRecent(ds *datastore.DataStore, account string, device string, sourceXML []byte) ([]byte, error) {
-	sources, err := ds.GetConfiguredSources(account)
+// ErrEmptyPreset is returned when restoring what a preset version replaced,
+// but the button was empty before.
+var ErrEmptyPreset = errors.New("preset button was empty")
+
+// RestorePresetVersion stores the preset of a version on its device again,
+// recorded as a new version. With previous set, the content the version
+// replaced is restored instead, undoing the change. Speakers pick up the
+// restored preset with the next presets request, as its ETag changes.
+func RestorePresetVersion(ds datastore.Store, account, id string, previous bool) (*models.PresetVersion, error) {
+	defer ds.LockAccount(account)()
+
+	version, err := ds.GetPresetVersion(account, id)
+	if err != nil {
+		return nil, err
+	}
+	preset := version.Preset
+	if previous {
+		if version.Previous == nil {
+			return nil, fmt.Errorf("preset %d before version %s: %w", version.PresetNumber, id, ErrEmptyPreset)
+		}
+		preset = *version.Previous
+	}
+	preset.ID = strconv.Itoa(version.PresetNumber)
+	preset.UpdatedOn = strconv.FormatInt(time.Now().Unix(), 10)
+
+	presets, err := ds.GetDevicePresets(account, version.DeviceID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return storePreset(ds, account, version.DeviceID, presets, version.PresetNumber, preset, version.ID)
+}
+
+// storePreset puts preset on a button of the device and records the change
+// in the preset history. The caller must hold the account lock.
+func storePreset(ds datastore.Store, account, device string, presets []models.Preset, presetNumber int, preset models.Preset, restoredFrom string) (*models.PresetVersion, error) {
+	version := models.PresetVersion{
+		DeviceID:     device,
+		PresetNumber: presetNumber,
+		Preset:       preset,
+		RestoredFrom: restoredFrom,
+		ChangedOn:    time.Now().UTC().Format(time.RFC3339),
+	}
+	if presetNumber <= len(presets) && presets[presetNumber-1] != (models.Preset{}) {
+		previous := presets[presetNumber-1]
+		version.Previous = &previous
+	}
+
+	// Ensure presets list is large enough
+	for len(presets) < presetNumber {
+		presets = append(presets, models.Preset{})
+	}
+	presets[presetNumber-1] = preset
+
+	if err := ds.SaveDevicePresets(account, device, presets); err != nil {
+		return nil, err
+	}
+
+	// The preset is in place even if its history could not be kept
+	recorded, err := ds.AddPresetVersion(account, version)
+	if err != nil {
+		log.Printf("Warning: failed to record preset history of %s/%s: %v", account, device, err)
+		return &version, nil
+	}
+	return recorded, nil
+}
+
+func AddRecent(ds datastore.Store, account string, device string, sourceXML []byte) ([]byte, error) {
+	// Speakers of the same account may update concurrently
+	defer ds.LockAccount(account)()
+
+	sources, err := accountSources(ds, account)
 	if err != nil {
 		return nil, err
 	}
-	recents, err := ds.GetRecents(account)
+	recents, err := ds.GetDeviceRecents(account, device)
 	if err != nil {
 		return nil, err
 	}
@@ -401,7 +489,7 @@ func AddRecent(ds *datastore.DataStore, account string, device string, sourceXML
 		}
 	}
 
-	if err := ds.SaveRecents(account, recents); err != nil {
+	if err := ds.SaveDeviceRecents(account, device, recents); err != nil {
 		return nil, err
 	}
 
@@ -419,7 +507,7 @@ func AddRecent(ds *datastore.DataStore, account string, device string, sourceXML
 	return append([]byte(xml.Header), []byte(res)...), nil
 }
 
-func AddDeviceToAccount(ds *datastore.DataStore, account string, sourceXML []byte) ([]byte, error) {
+func AddDeviceToAccount(ds datastore.Store, account string, sourceXML []byte) ([]byte, error) {
 	var newDeviceElem struct {
 		DeviceID string `xml:"deviceid,attr"`
 		Name     string `xml:"name"`
@@ -449,6 +537,6 @@ func AddDeviceToAccount(ds *datastore.DataStore, account string, sourceXML []byt
 	return append([]byte(xml.Header), []byte(res)...), nil
 }
 
-func RemoveDeviceFromAccount(ds *datastore.DataStore, account string, device string) error {
+func RemoveDeviceFromAccount(ds datastore.Store, account string, device string) error {
 	return ds.RemoveDevice(account, device)
 }
@@ -1,13 +1,17 @@
 package marge
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
 	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/secrets"
 )
 
 func TestMargeXML(t *testing.T) {
@@ -90,7 +94,7 @@ func TestAddRecent_TimestampPreservation(t *testing.T) {
 		t.Fatalf("AddRecent failed: %v", err)
 	}
 
-	recents, _ := ds.GetRecents(account)
+	recents, _ := ds.GetDeviceRecents(account, device)
 	if len(recents) != 1 {
 		t.Fatalf("Expected 1 recent, got %d", len(recents))
 	}
@@ -111,7 +115,7 @@ func TestAddRecent_TimestampPreservation(t *testing.T) {
 		t.Errorf("Expected preserved DateStr in createdOn, got XML: %s", string(respXML))
 	}
 
-	recents, _ = ds.GetRecents(account)
+	recents, _ = ds.GetDeviceRecents(account, device)
 	if len(recents) != 1 {
 		t.Errorf("Expected still 1 recent, got %d", len(recents))
 	}
@@ -122,3 +126,159 @@ func TestAddRecent_TimestampPreservation(t *testing.T) {
 		// Since we slept, it should be different.
 	}
 }
+
+func TestUpdatePreset_LibraryStation(t *testing.T) {
+	ds := datastore.NewDataStore(t.TempDir())
+	account := "test-acc"
+
+	os.MkdirAll(ds.AccountDir(account), 0755)
+	ds.SaveConfiguredSources(account, []models.ConfiguredSource{
+		{ID: "201", DisplayName: "Custom Stations", SourceKeyType: "LOCAL_INTERNET_RADIO"},
+	})
+	ds.SavePresets(account, []models.Preset{})
+	station, _ := ds.AddStation(models.Station{
+		Name:       "Rock FM",
+		StreamURLs: []string{"http://rock.example.com/live"},
+		Logo:       "http://rock.example.com/logo.png",
+	})
+
+	sourceXML := []byte(`
+<preset>
+    <sourceid>201</sourceid>
+    <location>/v1/playback/library/` + station.ID + `</location>
+    <contentItemType>stationurl</contentItemType>
+</preset>`)
+	respXML, err := UpdatePreset(ds, account, "dev", 2, sourceXML)
+	if err != nil {
+		t.Fatalf("UpdatePreset failed: %v", err)
+	}
+	if !strings.Contains(string(respXML), "<name>Rock FM</name>") {
+		t.Errorf("Expected station name from library, got %s", respXML)
+	}
+
+	presets, _ := ds.GetDevicePresets(account, "dev")
+	if len(presets) != 2 || presets[1].ContainerArt != "http://rock.example.com/logo.png" {
+		t.Errorf("Expected preset 2 with library logo, got %+v", presets)
+	}
+}
+
+func TestUpdatePreset_Concurrent(t *testing.T) {
+	ds := datastore.NewDataStore(t.TempDir())
+	account := "test-acc"
+	ds.SaveConfiguredSources(account, []models.ConfiguredSource{
+		{ID: "101", DisplayName: "TuneIn", SourceKeyType: "TUNEIN"},
+	})
+	ds.SavePresets(account, []models.Preset{})
+
+	// Two speakers storing different presets at once must not lose either one
+	var wg sync.WaitGroup
+	for i := 1; i <= 6; i++ {
+		wg.Add(1)
+		go func(number int) {
+			defer wg.Done()
+			presetXML := fmt.Sprintf(`<preset><name>Station %d</name><sourceid>101</sourceid><location>/v1/playback/station/s%d</location><contentItemType>stationurl</contentItemType></preset>`, number, number)
+			if _, err := UpdatePreset(ds, account, "dev1", number, []byte(presetXML)); err != nil {
+				t.Errorf("UpdatePreset %d failed: %v", number, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	presets, err := ds.GetDevicePresets(account, "dev1")
+	if err != nil {
+		t.Fatalf("GetDevicePresets failed: %v", err)
+	}
+	if len(presets) != 6 {
+		t.Fatalf("Expected 6 presets, got %d", len(presets))
+	}
+	for i, p := range presets {
+		if p.Name != fmt.Sprintf("Station %d", i+1) {
+			t.Errorf("Preset %d lost, got %+v", i+1, p)
+		}
+	}
+}
+
+func TestRestorePresetVersion(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	account := "test-acc"
+	ds.SaveConfiguredSources(account, []models.ConfiguredSource{
+		{ID: "101", DisplayName: "TuneIn", SourceKeyType: "TUNEIN"},
+	})
+	ds.SavePresets(account, []models.Preset{})
+
+	for _, name := range []string{"Careful Choice", "Accident"} {
+		presetXML := fmt.Sprintf(`<preset><name>%s</name><sourceid>101</sourceid><location>/v1/playback/station/s1</location><contentItemType>stationurl</contentItemType></preset>`, name)
+		if _, err := UpdatePreset(ds, account, "dev1", 1, []byte(presetXML)); err != nil {
+			t.Fatalf("UpdatePreset failed: %v", err)
+		}
+	}
+
+	history, _ := ds.GetPresetHistory(account, "dev1")
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 versions, got %+v", history)
+	}
+	overwrite := history[0]
+	if overwrite.Preset.Name != "Accident" || overwrite.Previous == nil || overwrite.Previous.Name != "Careful Choice" {
+		t.Errorf("Unexpected version of the overwrite %+v", overwrite)
+	}
+	if history[1].Previous != nil {
+		t.Errorf("Expected no previous preset for the first version, got %+v", history[1].Previous)
+	}
+
+	etag := ds.GetETagForDevicePresets(account, "dev1")
+	restored, err := RestorePresetVersion(ds, account, overwrite.ID, true)
+	if err != nil {
+		t.Fatalf("RestorePresetVersion failed: %v", err)
+	}
+	if restored.RestoredFrom != overwrite.ID || restored.Preset.Name != "Careful Choice" {
+		t.Errorf("Unexpected restored version %+v", restored)
+	}
+	presets, _ := ds.GetDevicePresets(account, "dev1")
+	if len(presets) != 1 || presets[0].Name != "Careful Choice" || presets[0].ID != "1" {
+		t.Errorf("Expected the earlier preset to be back, got %+v", presets)
+	}
+	if ds.GetETagForDevicePresets(account, "dev1") == etag {
+		t.Error("Expected presets ETag to change so speakers pick up the restore")
+	}
+
+	if _, err := RestorePresetVersion(ds, account, history[1].ID, true); !errors.Is(err, ErrEmptyPreset) {
+		t.Errorf("Expected ErrEmptyPreset restoring before the first version, got %v", err)
+	}
+	if _, err := RestorePresetVersion(ds, account, "99", false); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for unknown version, got %v", err)
+	}
+}
+
+func TestEncryptedSourceSecrets(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	key, _ := secrets.GenerateKey()
+	box, _ := secrets.LoadBox(key, "")
+	ds.SetSecretBox(box)
+
+	account, device := "123", "ABC"
+	ds.SaveDeviceInfo(account, device, &models.DeviceInfo{DeviceID: device})
+	ds.SaveConfiguredSources(account, []models.ConfiguredSource{{ID: "1", SourceKeyType: "SPOTIFY", SourceKeyAccount: "user", Secret: "spotify-token"}})
+	ds.SaveDevicePresets(account, device, []models.Preset{})
+	ds.SaveDeviceRecents(account, device, []models.Recent{})
+
+	sources, _ := ds.GetConfiguredSources(account)
+	if !secrets.IsEncrypted(sources[0].Secret) {
+		t.Fatalf("Expected the stored secret to be encrypted, got %q", sources[0].Secret)
+	}
+
+	preset, err := UpdatePreset(ds, account, device, 1, []byte(`<preset><name>Mix</name><sourceid>1</sourceid><location>/playlist/1</location></preset>`))
+	if err != nil {
+		t.Fatalf("UpdatePreset failed: %v", err)
+	}
+	if !strings.Contains(string(preset), `<credential type="token">spotify-token</credential>`) {
+		t.Errorf("Expected the decrypted secret in the response, got %s", preset)
+	}
+
+	full, err := AccountFullToXML(ds, account)
+	if err != nil {
+		t.Fatalf("AccountFullToXML failed: %v", err)
+	}
+	if strings.Count(string(full), "spotify-token") != 2 || strings.Contains(string(full), "enc:v1:") {
+		t.Errorf("Expected only decrypted secrets in the account, got %s", full)
+	}
+}
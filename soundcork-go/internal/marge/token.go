@@ -0,0 +1,127 @@
+package marge
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/jwt"
+)
+
+const (
+	// StreamingTokenAudience marks streaming tokens, as opposed to the BMX
+	// access tokens, which are signed with a secret of their own.
+	StreamingTokenAudience = "marge"
+	// DefaultStreamingTokenTTL is how long a streaming token stays valid if
+	// not configured otherwise.
+	DefaultStreamingTokenTTL = 24 * time.Hour
+)
+
+// StreamingToken issues the token a speaker presents on later marge and BMX
+// calls. It is bound to the account and device and expires after ttl.
+func StreamingToken(secret []byte, account, device string, ttl time.Duration, now time.Time) (string, *jwt.Claims, error) {
+	id, err := jwt.NewID()
+	if err != nil {
+		return "", nil, err
+	}
+	claims := jwt.Claims{
+		ID:        id,
+		Issuer:    jwt.Issuer,
+		Audience:  StreamingTokenAudience,
+		Subject:   device,
+		Account:   account,
+		Device:    device,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	token, err := jwt.Sign(secret, claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &claims, nil
+}
+
+// Token statuses recorded by TokenAudit.
+const (
+	TokenValid      = "valid"
+	TokenRejected   = "rejected"
+	TokenUnverified = "unverified"
+)
+
+// maxTokenUses is the number of entries kept by TokenAudit.
+const maxTokenUses = 1000
+
+// TokenUse is what TokenAudit knows about one token presented by one device.
+type TokenUse struct {
+	TokenID string `json:"tokenId"`
+	// Account and Device are what the token is bound to, Caller is the device
+	// that presented it.
+	Account   string    `json:"account,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	Caller    string    `json:"caller"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Path      string    `json:"lastPath"`
+	Uses      int       `json:"uses"`
+	FirstUsed time.Time `json:"firstUsed"`
+	LastUsed  time.Time `json:"lastUsed"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// TokenAudit keeps track of which device used which token in memory. Its
+// zero value is ready to use.
+type TokenAudit struct {
+	mu   sync.Mutex
+	uses map[string]*TokenUse
+}
+
+// Record adds a use of a token. Uses of the same token by the same caller
+// with the same status are counted in one entry.
+func (a *TokenAudit) Record(use TokenUse) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.uses == nil {
+		a.uses = make(map[string]*TokenUse)
+	}
+	if use.LastUsed.IsZero() {
+		use.LastUsed = time.Now()
+	}
+
+	key := use.TokenID + "|" + use.Caller + "|" + use.Status
+	if known, ok := a.uses[key]; ok {
+		known.Uses++
+		known.Path = use.Path
+		known.Reason = use.Reason
+		known.LastUsed = use.LastUsed
+		return
+	}
+
+	if len(a.uses) >= maxTokenUses {
+		oldest := ""
+		for k, u := range a.uses {
+			if oldest == "" || u.LastUsed.Before(a.uses[oldest].LastUsed) {
+				oldest = k
+			}
+		}
+		delete(a.uses, oldest)
+	}
+	use.Uses = 1
+	use.FirstUsed = use.LastUsed
+	a.uses[key] = &use
+}
+
+// List returns the recorded uses, most recent first.
+func (a *TokenAudit) List() []TokenUse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	list := make([]TokenUse, 0, len(a.uses))
+	for _, u := range a.uses {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastUsed.After(list[j].LastUsed)
+	})
+	return list
+}
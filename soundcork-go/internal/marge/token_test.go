@@ -0,0 +1,46 @@
+package marge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/jwt"
+)
+
+func TestStreamingToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	if _, _, err := StreamingToken(nil, "1234567", "DEV1", time.Hour, now); err == nil {
+		t.Error("Expected error without secret")
+	}
+
+	token, claims, err := StreamingToken([]byte("secret"), "1234567", "DEV1", time.Hour, now)
+	if err != nil {
+		t.Fatalf("StreamingToken failed: %v", err)
+	}
+	verified, err := jwt.Verify([]byte("secret"), token, now)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if *verified != *claims || claims.Account != "1234567" || claims.Device != "DEV1" || claims.ExpiresAt != now.Add(time.Hour).Unix() {
+		t.Errorf("Unexpected claims %+v, returned %+v", verified, claims)
+	}
+}
+
+func TestTokenAudit(t *testing.T) {
+	var a TokenAudit
+	now := time.Now()
+	a.Record(TokenUse{TokenID: "t1", Caller: "DEV1", Status: TokenValid, Path: "/a", LastUsed: now.Add(-time.Minute)})
+	a.Record(TokenUse{TokenID: "t1", Caller: "DEV1", Status: TokenValid, Path: "/b", LastUsed: now})
+	a.Record(TokenUse{TokenID: "t1", Caller: "DEV2", Status: TokenRejected, LastUsed: now.Add(-time.Hour)})
+
+	uses := a.List()
+	if len(uses) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", uses)
+	}
+	if u := uses[0]; u.Caller != "DEV1" || u.Uses != 2 || u.Path != "/b" || !u.FirstUsed.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Unexpected entry %+v", u)
+	}
+	if uses[1].Caller != "DEV2" || uses[1].Uses != 1 {
+		t.Errorf("Unexpected entry %+v", uses[1])
+	}
+}
@@ -20,6 +20,7 @@ type Links struct {
 	BmxFavorite             *Link `json:"bmx_favorite,omitempty" xml:"bmx_favorite,omitempty"`
 	BmxNowPlaying           *Link `json:"bmx_nowplaying,omitempty" xml:"bmx_nowplaying,omitempty"`
 	BmxTrack                *Link `json:"bmx_track,omitempty" xml:"bmx_track,omitempty"`
+	BmxPlayback             *Link `json:"bmx_playback,omitempty" xml:"bmx_playback,omitempty"`
 }
 
 type IconSet struct {
@@ -90,6 +91,21 @@ type BmxPlaybackResponse struct {
 	Duration        int    `json:"duration,omitempty" xml:"duration,omitempty"`
 	ShuffleDisabled bool   `json:"shuffle_disabled,omitempty" xml:"shuffleDisabled,omitempty"`
 	RepeatDisabled  bool   `json:"repeat_disabled,omitempty" xml:"repeatDisabled,omitempty"`
+	// ResumeOffset is the stored position in seconds to continue an episode
+	// from. It is advisory: the field is not part of the BMX playback
+	// response of the Bose servers, and speakers are not known to honour it,
+	// so they may still start the episode from the beginning.
+	ResumeOffset int `json:"resumeOffset,omitempty" xml:"resumeOffset,omitempty"`
+}
+
+type BmxNowPlayingResponse struct {
+	Links  *Links `json:"_links,omitempty"`
+	Artist struct {
+		Name string `json:"name,omitempty"`
+	} `json:"artist,omitempty"`
+	ImageUrl   string `json:"imageUrl"`
+	Name       string `json:"name"`
+	StreamType string `json:"streamType"`
 }
 
 type Track struct {
@@ -107,6 +123,28 @@ type BmxPodcastInfoResponse struct {
 	Tracks          []Track `json:"tracks" xml:"tracks>track"`
 }
 
+type NavigateItem struct {
+	Links        *Links `json:"_links,omitempty" xml:"links,omitempty"`
+	Name         string `json:"name" xml:"name"`
+	Subtitle     string `json:"subtitle,omitempty" xml:"subtitle,omitempty"`
+	ImageUrl     string `json:"imageUrl,omitempty" xml:"imageUrl,omitempty"`
+	StreamType   string `json:"streamType,omitempty" xml:"streamType,omitempty"`
+	IsPresetable bool   `json:"isPresetable" xml:"isPresetable"`
+}
+
+type NavigateSection struct {
+	Name   string         `json:"name,omitempty" xml:"name,omitempty"`
+	Layout string         `json:"layout" xml:"layout"`
+	Items  []NavigateItem `json:"items" xml:"items>item"`
+}
+
+type BmxNavigateResponse struct {
+	Links    *Links            `json:"_links,omitempty" xml:"links,omitempty"`
+	Name     string            `json:"name" xml:"name"`
+	Layout   string            `json:"layout" xml:"layout"`
+	Sections []NavigateSection `json:"sections" xml:"sections>section"`
+}
+
 type SourceProvider struct {
 	ID        int    `json:"id" xml:"id,attr"`
 	CreatedOn string `json:"created_on" xml:"createdOn"`
@@ -132,6 +170,20 @@ type Preset struct {
 	UpdatedOn    string `json:"updated_on" xml:"updatedOn"`
 }
 
+// PresetVersion records one change of a preset button on a device. Preset is
+// the content stored by the change and Previous what it replaced, or nil if
+// the button was empty. RestoredFrom is set when the change restored the
+// version with that ID.
+type PresetVersion struct {
+	ID           string  `json:"id" xml:"id,attr"`
+	DeviceID     string  `json:"device_id" xml:"deviceId"`
+	PresetNumber int     `json:"preset_number" xml:"presetNumber"`
+	Preset       Preset  `json:"preset" xml:"preset"`
+	Previous     *Preset `json:"previous,omitempty" xml:"previous,omitempty"`
+	RestoredFrom string  `json:"restored_from,omitempty" xml:"restoredFrom,omitempty"`
+	ChangedOn    string  `json:"changed_on" xml:"changedOn"`
+}
+
 type Recent struct {
 	ContentItem
 	DeviceID     string `json:"device_id" xml:"deviceid"`
@@ -148,6 +200,49 @@ type ConfiguredSource struct {
 	SourceKeyAccount string `json:"source_key_account" xml:"username"`
 }
 
+type Station struct {
+	ID         string   `json:"id" xml:"id,attr"`
+	Name       string   `json:"name" xml:"name"`
+	StreamURLs []string `json:"stream_urls" xml:"streamUrls>streamUrl"`
+	Logo       string   `json:"logo,omitempty" xml:"logo,omitempty"`
+	Genre      string   `json:"genre,omitempty" xml:"genre,omitempty"`
+}
+
+type Favorite struct {
+	ID        string `json:"id" xml:"id,attr"`
+	Name      string `json:"name,omitempty" xml:"name,omitempty"`
+	ImageUrl  string `json:"image_url,omitempty" xml:"imageUrl,omitempty"`
+	CreatedOn string `json:"created_on,omitempty" xml:"createdOn,attr,omitempty"`
+}
+
+type BmxFavoriteResponse struct {
+	Links      *Links `json:"_links,omitempty"`
+	IsFavorite bool   `json:"isFavorite"`
+}
+
+// PlaybackPosition is how far an account got into an on-demand episode.
+// Position and Duration are in seconds.
+type PlaybackPosition struct {
+	Account   string `json:"account,omitempty" xml:"-"`
+	EpisodeID string `json:"episode_id" xml:"episodeId,attr"`
+	Name      string `json:"name,omitempty" xml:"name,omitempty"`
+	ShowName  string `json:"show_name,omitempty" xml:"showName,omitempty"`
+	ImageUrl  string `json:"image_url,omitempty" xml:"imageUrl,omitempty"`
+	Position  int    `json:"position" xml:"position"`
+	Duration  int    `json:"duration,omitempty" xml:"duration,omitempty"`
+	Playing   bool   `json:"playing" xml:"playing"`
+	DeviceID  string `json:"device_id,omitempty" xml:"deviceId,omitempty"`
+	UpdatedOn string `json:"updated_on" xml:"updatedOn"`
+}
+
+// StreamStats counts probe results for a single stream URL.
+type StreamStats struct {
+	Successes   int    `json:"successes"`
+	Failures    int    `json:"failures"`
+	LastSuccess string `json:"last_success,omitempty"`
+	LastFailure string `json:"last_failure,omitempty"`
+}
+
 type DeviceInfo struct {
 	DeviceID            string `json:"device_id" xml:"deviceID,attr"`
 	ProductCode         string `json:"product_code" xml:"type"`
@@ -205,3 +300,25 @@ type DeviceEvent struct {
 	MonoTime int64                  `json:"monoTime"`
 	Data     map[string]interface{} `json:"data"`
 }
+
+type BmxTokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type BmxTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+type BmxReportRequest struct {
+	TimeStamp     string `json:"timeStamp,omitempty"`
+	EventType     string `json:"eventType"`
+	Reason        string `json:"reason,omitempty"`
+	TimeIntoTrack int    `json:"timeIntoTrack,omitempty"`
+	PlaybackDelay int    `json:"playbackDelay,omitempty"`
+}
+
+type BmxReportResponse struct {
+	Links        *Links `json:"_links,omitempty"`
+	NextReportIn int    `json:"nextReportIn,omitempty"`
+}
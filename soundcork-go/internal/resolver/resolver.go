@@ -0,0 +1,177 @@
+// Package resolver implements a DNS server that answers queries for the
+// hostnames of the Bose cloud with the address of soundcork, so speakers
+// reach soundcork without changes to their configuration.
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// BoseHosts are the hostnames in the original SoundTouchSdkPrivateCfg.xml of
+// a speaker.
+var BoseHosts = []string{
+	"streaming.bose.com",
+	"content.api.bose.io",
+	"events.api.bosecm.com",
+	"worldwide.bose.com",
+}
+
+// DefaultTTL is the TTL of the answers for overridden hosts, in seconds.
+const DefaultTTL = 300
+
+const forwardTimeout = 5 * time.Second
+
+// ErrUpstreamLoop is returned by ListenAndServe if Upstream is the address the
+// server listens on, so forwarded queries would come back to it.
+var ErrUpstreamLoop = errors.New("DNS upstream is this server")
+
+// Server answers A and AAAA queries for Hosts with IP and forwards all other
+// queries to Upstream. It only serves clients with a loopback, private or
+// link-local address and refuses all others, so it cannot be used as an open
+// resolver when reachable from the internet.
+type Server struct {
+	IP       net.IP
+	Hosts    []string
+	Upstream string
+	TTL      uint32
+}
+
+// NewServer creates a Server overriding BoseHosts with ip.
+func NewServer(ip net.IP, upstream string) *Server {
+	return &Server{IP: ip, Hosts: BoseHosts, Upstream: upstream, TTL: DefaultTTL}
+}
+
+// SystemUpstream returns the first name server of the resolv.conf at path.
+func SystemUpstream(path string) (string, error) {
+	cfg, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return "", err
+	}
+	if len(cfg.Servers) == 0 {
+		return "", errors.New("no name server in " + path)
+	}
+	return net.JoinHostPort(cfg.Servers[0], cfg.Port), nil
+}
+
+// ListenAndServe serves DNS on addr over UDP and TCP until one of them fails.
+// It fails with ErrUpstreamLoop if Upstream is addr itself.
+func (s *Server) ListenAndServe(addr string) error {
+	if s.loops(addr) {
+		return fmt.Errorf("%w: %s", ErrUpstreamLoop, s.Upstream)
+	}
+	errc := make(chan error, 2)
+	for _, network := range []string{"udp", "tcp"} {
+		srv := &dns.Server{Addr: addr, Net: network, Handler: s}
+		go func() { errc <- srv.ListenAndServe() }()
+	}
+	return <-errc
+}
+
+// loops reports whether Upstream is the listen address addr. Upstreams given
+// by name are not resolved and never count as a loop.
+func (s *Server) loops(addr string) bool {
+	upstreamHost, upstreamPort, err := net.SplitHostPort(s.Upstream)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port != upstreamPort {
+		return false
+	}
+	upstream := net.ParseIP(upstreamHost)
+	if upstream == nil {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		return upstream.Equal(ip) || (upstream.IsLoopback() && ip.IsLoopback())
+	}
+	// Listening on all interfaces
+	if upstream.IsLoopback() || upstream.IsUnspecified() {
+		return true
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(upstream) {
+			return true
+		}
+	}
+	return false
+}
+
+// localClient reports whether a client address may be served.
+func localClient(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+}
+
+func (s *Server) overrides(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	for _, host := range s.Hosts {
+		if strings.EqualFold(name, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeDNS implements dns.Handler.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if !localClient(w.RemoteAddr()) {
+		res := new(dns.Msg)
+		res.SetRcode(req, dns.RcodeRefused)
+		w.WriteMsg(res)
+		return
+	}
+	if len(req.Question) == 1 && s.overrides(req.Question[0].Name) {
+		w.WriteMsg(s.answer(req))
+		return
+	}
+
+	network := "udp"
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		network = "tcp"
+	}
+	client := &dns.Client{Net: network, Timeout: forwardTimeout}
+	res, _, err := client.Exchange(req, s.Upstream)
+	if err != nil {
+		log.Printf("DNS: failed to forward query to %s: %v", s.Upstream, err)
+		res = new(dns.Msg)
+		res.SetRcode(req, dns.RcodeServerFailure)
+	}
+	w.WriteMsg(res)
+}
+
+// answer replies with IP to the address queries for an overridden host, and
+// with no records to other types. In particular an IPv4 override leaves AAAA
+// queries empty, so speakers don't reach the Bose cloud over IPv6.
+func (s *Server) answer(req *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+
+	q := req.Question[0]
+	hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: s.TTL}
+	if ip4 := s.IP.To4(); ip4 != nil {
+		if q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY {
+			hdr.Rrtype = dns.TypeA
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: ip4})
+		}
+	} else if q.Qtype == dns.TypeAAAA || q.Qtype == dns.TypeANY {
+		hdr.Rrtype = dns.TypeAAAA
+		m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: s.IP})
+	}
+	return m
+}
@@ -0,0 +1,149 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// serve runs handler on a UDP port of the loopback interface.
+func serve(t *testing.T, handler dns.Handler) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: handler}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func query(t *testing.T, addr, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	res, _, err := new(dns.Client).Exchange(req, addr)
+	if err != nil {
+		t.Fatalf("Query for %s failed: %v", name, err)
+	}
+	return res
+}
+
+func TestServer(t *testing.T) {
+	upstream := serve(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("93.184.216.34"),
+		})
+		w.WriteMsg(m)
+	}))
+	addr := serve(t, NewServer(net.ParseIP("192.168.1.5"), upstream))
+
+	for _, name := range []string{"streaming.bose.com.", "Content.API.Bose.io."} {
+		res := query(t, addr, name, dns.TypeA)
+		if len(res.Answer) != 1 || res.Answer[0].(*dns.A).A.String() != "192.168.1.5" {
+			t.Errorf("Expected the override for %s, got %v", name, res.Answer)
+		}
+	}
+	if res := query(t, addr, "streaming.bose.com.", dns.TypeAAAA); res.Rcode != dns.RcodeSuccess || len(res.Answer) != 0 {
+		t.Errorf("Expected no IPv6 address for an overridden host, got %v", res)
+	}
+
+	res := query(t, addr, "example.com.", dns.TypeA)
+	if len(res.Answer) != 1 || res.Answer[0].(*dns.A).A.String() != "93.184.216.34" {
+		t.Errorf("Expected the upstream answer, got %v", res.Answer)
+	}
+
+	t.Run("UpstreamDown", func(t *testing.T) {
+		pc, _ := net.ListenPacket("udp", "127.0.0.1:0")
+		closed := pc.LocalAddr().String()
+		pc.Close()
+		addr := serve(t, NewServer(net.ParseIP("192.168.1.5"), closed))
+		if res := query(t, addr, "example.com.", dns.TypeA); res.Rcode != dns.RcodeServerFailure {
+			t.Errorf("Expected SERVFAIL, got %v", dns.RcodeToString[res.Rcode])
+		}
+	})
+}
+
+// remoteWriter records the reply to a query from addr.
+type remoteWriter struct {
+	dns.ResponseWriter
+	addr  net.Addr
+	reply *dns.Msg
+}
+
+func (w *remoteWriter) RemoteAddr() net.Addr { return w.addr }
+
+func (w *remoteWriter) WriteMsg(m *dns.Msg) error {
+	w.reply = m
+	return nil
+}
+
+func TestServer_RefusesPublicClients(t *testing.T) {
+	upstream := serve(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		t.Errorf("Unexpected forwarded query for %s", req.Question[0].Name)
+	}))
+	s := NewServer(net.ParseIP("192.168.1.5"), upstream)
+
+	for _, name := range []string{"example.com.", "streaming.bose.com."} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &remoteWriter{addr: &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 5353}}
+		s.ServeDNS(w, req)
+		if w.reply == nil || w.reply.Rcode != dns.RcodeRefused {
+			t.Errorf("Expected REFUSED for %s from a public address, got %v", name, w.reply)
+		}
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("streaming.bose.com.", dns.TypeA)
+	w := &remoteWriter{addr: &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 5353}}
+	s.ServeDNS(w, req)
+	if w.reply == nil || len(w.reply.Answer) != 1 {
+		t.Errorf("Expected the override for a link-local client, got %v", w.reply)
+	}
+}
+
+func TestServer_UpstreamLoop(t *testing.T) {
+	tests := []struct {
+		upstream, addr string
+		loops          bool
+	}{
+		{"127.0.0.1:53", ":53", true},
+		{"127.0.0.1:53", "0.0.0.0:53", true},
+		{"192.168.1.5:53", "192.168.1.5:53", true},
+		{"127.0.0.53:53", "127.0.0.1:53", true},
+		{"127.0.0.1:5353", ":53", false},
+		{"192.168.1.1:53", "192.168.1.5:53", false},
+		{"dns.lan:53", ":53", false},
+	}
+	for _, tt := range tests {
+		s := NewServer(net.ParseIP("192.168.1.5"), tt.upstream)
+		if got := s.loops(tt.addr); got != tt.loops {
+			t.Errorf("Upstream %s on %s: expected loop=%v", tt.upstream, tt.addr, tt.loops)
+		}
+	}
+
+	s := NewServer(net.ParseIP("192.168.1.5"), "127.0.0.1:53")
+	if err := s.ListenAndServe("127.0.0.1:53"); !errors.Is(err, ErrUpstreamLoop) {
+		t.Errorf("Expected ErrUpstreamLoop, got %v", err)
+	}
+}
+
+func TestSystemUpstream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	os.WriteFile(path, []byte("search lan\nnameserver 192.168.1.1\nnameserver 1.1.1.1\n"), 0644)
+	if upstream, err := SystemUpstream(path); err != nil || upstream != "192.168.1.1:53" {
+		t.Errorf("Expected 192.168.1.1:53, got %q (%v)", upstream, err)
+	}
+
+	os.WriteFile(path, []byte("search lan\n"), 0644)
+	if _, err := SystemUpstream(path); err == nil {
+		t.Error("Expected error without a name server")
+	}
+}
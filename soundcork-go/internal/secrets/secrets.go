@@ -0,0 +1,141 @@
+// Package secrets encrypts the credentials of configured sources at rest with
+// AES-256-GCM.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the size of a key in bytes.
+const KeySize = 32
+
+// prefix marks an encrypted value, followed by the key ID and the base64
+// encoded nonce and ciphertext: enc:v1:<keyID>:<data>.
+const prefix = "enc:v1:"
+
+// ErrWrongKey is returned when decrypting a value that was encrypted with
+// another key, or without a key at all.
+var ErrWrongKey = errors.New("secret was encrypted with another key")
+
+// Box encrypts and decrypts values with one key.
+type Box struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+// NewBox returns a Box for a key of KeySize bytes.
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d bytes", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &Box{aead: aead, keyID: hex.EncodeToString(sum[:4])}, nil
+}
+
+// GenerateKey returns a new random key, base64 encoded as ParseKey expects it.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 encoded key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d bytes", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// LoadBox returns a Box for the base64 encoded key in value, or else in the
+// file at path. Without either, it returns nil and secrets stay unencrypted.
+func LoadBox(value, path string) (*Box, error) {
+	if value == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		value = string(data)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	key, err := ParseKey(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewBox(key)
+}
+
+// KeyID identifies the key of b in encrypted values.
+func (b *Box) KeyID() string {
+	return b.keyID
+}
+
+// IsEncrypted reports whether s is an encrypted value.
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Encrypt encrypts s. Empty and already encrypted values are returned as
+// they are.
+func (b *Box) Encrypt(s string) (string, error) {
+	if s == "" || IsEncrypted(s) {
+		return s, nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(s), nil)
+	return prefix + b.keyID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt. Values that are not
+// encrypted are returned as they are. b may be nil, in which case encrypted
+// values fail with ErrWrongKey.
+func (b *Box) Decrypt(s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	keyID, data, ok := strings.Cut(strings.TrimPrefix(s, prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted secret")
+	}
+	if b == nil || keyID != b.keyID {
+		return "", fmt.Errorf("%w (key ID %s)", ErrWrongKey, keyID)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plain, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestBox(t *testing.T) *Box {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	box, err := LoadBox(key, "")
+	if err != nil {
+		t.Fatalf("LoadBox failed: %v", err)
+	}
+	return box
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	box := newTestBox(t)
+
+	enc, err := box.Encrypt("spotify-token")
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if !IsEncrypted(enc) || strings.Contains(enc, "spotify-token") || !strings.Contains(enc, box.KeyID()) {
+		t.Errorf("Unexpected encrypted value %q", enc)
+	}
+	if again, _ := box.Encrypt(enc); again != enc {
+		t.Error("Expected an encrypted value not to be encrypted again")
+	}
+	if other, _ := box.Encrypt("spotify-token"); other == enc {
+		t.Error("Expected a new nonce for every encryption")
+	}
+
+	if plain, err := box.Decrypt(enc); err != nil || plain != "spotify-token" {
+		t.Errorf("Decrypt returned %q (%v)", plain, err)
+	}
+	if plain, err := box.Decrypt("plain"); err != nil || plain != "plain" {
+		t.Errorf("Expected plaintext to pass, got %q (%v)", plain, err)
+	}
+	if empty, _ := box.Encrypt(""); empty != "" {
+		t.Errorf("Expected empty value to stay empty, got %q", empty)
+	}
+
+	if _, err := newTestBox(t).Decrypt(enc); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey for another key, got %v", err)
+	}
+	var none *Box
+	if _, err := none.Decrypt(enc); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey without a key, got %v", err)
+	}
+
+	tampered := enc[:len(enc)-2] + "AA"
+	if _, err := box.Decrypt(tampered); err == nil {
+		t.Error("Expected tampered value to fail")
+	}
+}
+
+func TestLoadBox(t *testing.T) {
+	if box, err := LoadBox("", ""); box != nil || err != nil {
+		t.Errorf("Expected no box without a key, got %v (%v)", box, err)
+	}
+	if _, err := LoadBox("c2hvcnQ=", ""); err == nil {
+		t.Error("Expected short key to fail")
+	}
+
+	key, _ := GenerateKey()
+	path := filepath.Join(t.TempDir(), "source.key")
+	os.WriteFile(path, []byte(key+"\n"), 0600)
+	fromFile, err := LoadBox("", path)
+	if err != nil {
+		t.Fatalf("LoadBox from file failed: %v", err)
+	}
+	fromValue, _ := LoadBox(key, "")
+	if fromFile.KeyID() != fromValue.KeyID() {
+		t.Errorf("Expected the same key ID, got %s and %s", fromFile.KeyID(), fromValue.KeyID())
+	}
+	if _, err := LoadBox("", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected missing key file to fail")
+	}
+}
@@ -0,0 +1,68 @@
+package setup
+
+import (
+	"fmt"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/ssh"
+)
+
+// SpeakerCAPath is where the soundcork CA certificate is stored on a speaker.
+const SpeakerCAPath = "/etc/ssl/certs/soundcork-ca.pem"
+
+// speakerCABundles are the CA bundles the TLS clients of a speaker may read.
+var speakerCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+}
+
+func runRemoteSSH(host, command string) (string, error) {
+	return ssh.NewClient(host).Run(command)
+}
+
+func uploadRemoteSSH(host string, content []byte, path string) error {
+	return ssh.NewClient(host).UploadContent(content, path)
+}
+
+// InstallCA makes the speaker at deviceIP trust the CA certificate caPEM, so
+// it accepts the certificate soundcork serves HTTPS with. The certificate is
+// stored at SpeakerCAPath and appended to the CA bundles of the speaker,
+// once, after keeping a copy of the original bundle. It returns the bundles
+// containing the CA. The speaker has to be rebooted to pick it up.
+func (m *Manager) InstallCA(deviceIP string, caPEM []byte, fingerprint string) ([]string, error) {
+	run, upload := m.runRemote, m.uploadRemote
+	if run == nil {
+		run = runRemoteSSH
+	}
+	if upload == nil {
+		upload = uploadRemoteSSH
+	}
+	host := speakerHost(deviceIP)
+	rwCmd := "(rw || mount -o remount,rw /)"
+
+	_, _ = run(host, rwCmd)
+	if err := upload(host, caPEM, SpeakerCAPath); err != nil {
+		return nil, fmt.Errorf("failed to upload CA certificate: %v", err)
+	}
+
+	marker := "# soundcork CA " + fingerprint
+	var installed []string
+	for _, bundle := range speakerCABundles {
+		if _, err := run(host, fmt.Sprintf("[ -f %s ]", bundle)); err != nil {
+			continue
+		}
+		if _, err := run(host, fmt.Sprintf("grep -qF '%s' %s", marker, bundle)); err == nil {
+			installed = append(installed, bundle)
+			continue
+		}
+		cmd := fmt.Sprintf("%s && ([ -f %s.original ] || cp %s %s.original) && (echo; echo '%s'; cat %s) >> %s",
+			rwCmd, bundle, bundle, bundle, marker, SpeakerCAPath, bundle)
+		if output, err := run(host, cmd); err != nil {
+			return installed, fmt.Errorf("failed to add CA to %s: %v (output: %s)", bundle, err, output)
+		}
+		installed = append(installed, bundle)
+	}
+	if len(installed) == 0 {
+		return nil, fmt.Errorf("no CA bundle found on the speaker (tried %v)", speakerCABundles)
+	}
+	return installed, nil
+}
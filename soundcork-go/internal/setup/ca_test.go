@@ -0,0 +1,77 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeSpeaker answers the commands used by InstallCA from files in memory.
+type fakeSpeaker struct {
+	files    map[string]string
+	commands []string
+}
+
+func (f *fakeSpeaker) run(host, command string) (string, error) {
+	f.commands = append(f.commands, command)
+	var path, marker string
+	switch {
+	case strings.HasPrefix(command, "[ -f "):
+		if _, ok := f.files[strings.TrimSuffix(strings.TrimPrefix(command, "[ -f "), " ]")]; !ok {
+			return "", errors.New("exit status 1")
+		}
+	case strings.HasPrefix(command, "grep -qF "):
+		fmt.Sscanf(command[strings.LastIndex(command, "' ")+2:], "%s", &path)
+		marker = command[len("grep -qF '"):strings.LastIndex(command, "' ")]
+		if !strings.Contains(f.files[path], marker) {
+			return "", errors.New("exit status 1")
+		}
+	case strings.Contains(command, ">> "):
+		path = command[strings.LastIndex(command, ">> ")+3:]
+		marker = command[strings.Index(command, "echo '")+6 : strings.LastIndex(command, "'; cat")]
+		f.files[path+".original"] = f.files[path]
+		f.files[path] += "\n" + marker + "\n" + f.files[SpeakerCAPath]
+	}
+	return "", nil
+}
+
+func (f *fakeSpeaker) upload(host string, content []byte, path string) error {
+	f.files[path] = string(content)
+	return nil
+}
+
+func TestInstallCA(t *testing.T) {
+	speaker := &fakeSpeaker{files: map[string]string{"/etc/ssl/certs/ca-certificates.crt": "BUNDLE\n"}}
+	manager := NewManager("https://soundcork.local:8443", nil)
+	manager.runRemote = speaker.run
+	manager.uploadRemote = speaker.upload
+
+	for i := 0; i < 2; i++ {
+		bundles, err := manager.InstallCA("192.168.1.10", []byte("CA PEM\n"), "abc123")
+		if err != nil {
+			t.Fatalf("InstallCA failed: %v", err)
+		}
+		if len(bundles) != 1 || bundles[0] != "/etc/ssl/certs/ca-certificates.crt" {
+			t.Errorf("Unexpected bundles %v", bundles)
+		}
+	}
+
+	if speaker.files[SpeakerCAPath] != "CA PEM\n" {
+		t.Errorf("Expected the CA at %s, got %q", SpeakerCAPath, speaker.files[SpeakerCAPath])
+	}
+	bundle := speaker.files["/etc/ssl/certs/ca-certificates.crt"]
+	if bundle != "BUNDLE\n\n# soundcork CA abc123\nCA PEM\n" {
+		t.Errorf("Expected the CA to be appended once, got %q", bundle)
+	}
+	if speaker.files["/etc/ssl/certs/ca-certificates.crt.original"] != "BUNDLE\n" {
+		t.Error("Expected a copy of the original bundle")
+	}
+
+	empty := &fakeSpeaker{files: map[string]string{}}
+	manager.runRemote = empty.run
+	manager.uploadRemote = empty.upload
+	if _, err := manager.InstallCA("192.168.1.11", []byte("CA PEM\n"), "abc123"); err == nil {
+		t.Error("Expected error without a CA bundle on the speaker")
+	}
+}
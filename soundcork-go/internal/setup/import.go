@@ -0,0 +1,199 @@
+package setup
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/ssh"
+)
+
+// ImportResult describes what ImportFromSpeaker stored.
+type ImportResult struct {
+	Account        string   `json:"account"`
+	DeviceID       string   `json:"device_id"`
+	DeviceName     string   `json:"device_name"`
+	AccountCreated bool     `json:"account_created"`
+	Presets        int      `json:"presets"`
+	Recents        int      `json:"recents"`
+	Sources        int      `json:"sources"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+var speakerHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrNoAccount is returned by ImportFromSpeaker if neither the speaker nor
+// the caller names the account to import into.
+var ErrNoAccount = errors.New("speaker is not registered with an account, please choose one")
+
+// ErrInvalidAccount is wrapped by the errors of ImportFromSpeaker for account
+// names that cannot be used.
+var ErrInvalidAccount = errors.New("invalid account")
+
+// speakerURL returns the URL of path on the web API of the speaker. For
+// testing, deviceIP may include a port, which then replaces the default one.
+func speakerURL(deviceIP, path string) string {
+	if _, _, err := net.SplitHostPort(deviceIP); err == nil {
+		return fmt.Sprintf("http://%s%s", deviceIP, path)
+	}
+	return fmt.Sprintf("http://%s:%d%s", deviceIP, constants.SpeakerHTTPPort, path)
+}
+
+// speakerHost strips a port from deviceIP, see speakerURL.
+func speakerHost(deviceIP string) string {
+	if host, _, err := net.SplitHostPort(deviceIP); err == nil {
+		return host
+	}
+	return deviceIP
+}
+
+func fetchSpeakerXML(deviceIP, path string) ([]byte, error) {
+	u := speakerURL(deviceIP, path)
+	resp, err := speakerHTTPClient.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// readRemoteFileSSH reads a file from the speaker at host over SSH.
+func readRemoteFileSSH(host, path string) (string, error) {
+	return ssh.NewClient(host).Run(fmt.Sprintf("cat %s", path))
+}
+
+// ImportFromSpeaker onboards the speaker at deviceIP. It reads the device
+// info, presets and recents from its web API and its Sources.xml over SSH,
+// and stores them in the account the speaker is registered with, or in
+// account if that is not empty. A new account starts with the presets and
+// recents of its first speaker. Without SSH access, the sources are left as
+// they are and a warning is returned.
+func (m *Manager) ImportFromSpeaker(deviceIP, account string) (*ImportResult, error) {
+	if m.DataStore == nil {
+		return nil, fmt.Errorf("no datastore configured")
+	}
+
+	infoData, err := fetchSpeakerXML(deviceIP, constants.SpeakerDeviceInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := datastore.ParseDeviceInfoXML(infoData)
+	if err != nil {
+		return nil, err
+	}
+	if info.DeviceID == "" {
+		return nil, fmt.Errorf("speaker at %s did not report a device ID", deviceIP)
+	}
+	if account == "" {
+		var registration struct {
+			Account string `xml:"margeAccountUUID"`
+		}
+		xml.Unmarshal(infoData, &registration)
+		account = registration.Account
+	}
+	if account == "" {
+		return nil, fmt.Errorf("%s: %w", deviceIP, ErrNoAccount)
+	}
+	if err := datastore.ValidateAccountName(account); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccount, err)
+	}
+	if info.IPAddress == "" {
+		info.IPAddress = speakerHost(deviceIP)
+	}
+
+	presetsData, err := fetchSpeakerXML(deviceIP, constants.SpeakerPresetsPath)
+	if err != nil {
+		return nil, err
+	}
+	presets, err := datastore.ParsePresetsXML(presetsData)
+	if err != nil {
+		return nil, err
+	}
+	recentsData, err := fetchSpeakerXML(deviceIP, constants.SpeakerRecentsPath)
+	if err != nil {
+		return nil, err
+	}
+	recents, err := datastore.ParseRecentsXML(recentsData)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{
+		Account:    account,
+		DeviceID:   info.DeviceID,
+		DeviceName: info.Name,
+		Presets:    len(presets),
+		Recents:    len(recents),
+	}
+
+	readRemoteFile := m.readRemoteFile
+	if readRemoteFile == nil {
+		readRemoteFile = readRemoteFileSSH
+	}
+	var sources []models.ConfiguredSource
+	sourcesData, err := readRemoteFile(speakerHost(deviceIP), constants.SpeakerSourcesFileLocation)
+	if err == nil {
+		sources, err = datastore.ParseSourcesXML([]byte(sourcesData))
+	}
+	sourcesRead := err == nil
+	if sourcesRead {
+		result.Sources = len(sources)
+	} else {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Sources.xml not imported: %v", err))
+	}
+
+	ds := m.DataStore
+	defer ds.LockAccount(account)()
+
+	if !ds.AccountExists(account) {
+		if err := ds.CreateAccount(account); err != nil {
+			return nil, err
+		}
+		result.AccountCreated = true
+	}
+	if err := ds.SaveDeviceInfo(account, info.DeviceID, info); err != nil {
+		return nil, err
+	}
+
+	if _, err := ds.GetPresets(account); errors.Is(err, os.ErrNotExist) {
+		if err := ds.SavePresets(account, presets); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := ds.GetRecents(account); errors.Is(err, os.ErrNotExist) {
+		if err := ds.SaveRecents(account, recents); err != nil {
+			return nil, err
+		}
+	}
+	if err := ds.SaveDevicePresets(account, info.DeviceID, presets); err != nil {
+		return nil, err
+	}
+	if err := ds.SaveDeviceRecents(account, info.DeviceID, recents); err != nil {
+		return nil, err
+	}
+
+	if sourcesRead {
+		if err := ds.SaveConfiguredSources(account, sources); err != nil {
+			return nil, err
+		}
+	} else if _, err := ds.GetConfiguredSources(account); errors.Is(err, os.ErrNotExist) {
+		// Presets can only be stored once the account has sources, so
+		// start with none rather than a missing file.
+		if err := ds.SaveConfiguredSources(account, []models.ConfiguredSource{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,129 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+)
+
+// speakerServer serves the web API of a speaker registered with account.
+func speakerServer(t *testing.T, account string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.URL.Path {
+		case "/info":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<info deviceID="08DF1F0BA325">
+    <name>Kitchen</name>
+    <type>SoundTouch 20</type>
+    <margeAccountUUID>%s</margeAccountUUID>
+    <components>
+        <component>
+            <componentCategory>SCM</componentCategory>
+            <softwareVersion>27.0.6</softwareVersion>
+            <serialNumber>I6332527703739342000020</serialNumber>
+        </component>
+    </components>
+    <networkInfo type="SCM"><ipAddress>192.168.1.10</ipAddress></networkInfo>
+</info>`, account)
+		case "/presets":
+			fmt.Fprint(w, `<presets>
+    <preset id="1" createdOn="1700000000" updatedOn="1700000001">
+        <ContentItem source="TUNEIN" type="stationurl" location="/v1/playback/station/s33828" sourceAccount="" isPresetable="true">
+            <itemName>Radio One</itemName>
+            <containerArt>http://example.com/art.png</containerArt>
+        </ContentItem>
+    </preset>
+</presets>`)
+		case "/recents":
+			fmt.Fprint(w, `<recents>
+    <recent deviceID="08DF1F0BA325" utcTime="1700000002" id="7">
+        <contentItem source="TUNEIN" type="stationurl" location="/v1/playback/station/s33828" isPresetable="true">
+            <itemName>Radio One</itemName>
+        </contentItem>
+    </recent>
+</recents>`)
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestImportFromSpeaker(t *testing.T) {
+	server := speakerServer(t, "1234567")
+	defer server.Close()
+
+	ds := datastore.NewMemoryStore()
+	manager := NewManager("http://localhost:8000", ds)
+	var readPath string
+	manager.readRemoteFile = func(host, path string) (string, error) {
+		readPath = path
+		return `<sources><source displayName="AUX IN" id="100001" secret="" secretType=""><sourceKey type="AUX" account="AUX" /></source></sources>`, nil
+	}
+
+	result, err := manager.ImportFromSpeaker(server.Listener.Addr().String(), "")
+	if err != nil {
+		t.Fatalf("ImportFromSpeaker failed: %v", err)
+	}
+	if result.Account != "1234567" || !result.AccountCreated || result.Presets != 1 || result.Recents != 1 || result.Sources != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if readPath != "/mnt/nv/BoseApp-Persistence/1/Sources.xml" {
+		t.Errorf("Expected Sources.xml to be read from the speaker, got %s", readPath)
+	}
+
+	info, err := ds.GetDeviceInfo("1234567", "08DF1F0BA325")
+	if err != nil || info.Name != "Kitchen" || info.IPAddress != "192.168.1.10" || info.FirmwareVersion != "27.0.6" {
+		t.Errorf("Unexpected device info %+v (%v)", info, err)
+	}
+	presets, _ := ds.GetDevicePresets("1234567", "08DF1F0BA325")
+	if len(presets) != 1 || presets[0].Name != "Radio One" || presets[0].Location != "/v1/playback/station/s33828" {
+		t.Errorf("Unexpected device presets %+v", presets)
+	}
+	if accountPresets, err := ds.GetPresets("1234567"); err != nil || len(accountPresets) != 1 {
+		t.Errorf("Expected new account to start with the presets of the speaker, got %+v (%v)", accountPresets, err)
+	}
+	recents, _ := ds.GetDeviceRecents("1234567", "08DF1F0BA325")
+	if len(recents) != 1 || recents[0].UtcTime != "1700000002" {
+		t.Errorf("Unexpected device recents %+v", recents)
+	}
+	sources, _ := ds.GetConfiguredSources("1234567")
+	if len(sources) != 1 || sources[0].SourceKeyType != "AUX" {
+		t.Errorf("Unexpected sources %+v", sources)
+	}
+}
+
+func TestImportFromSpeaker_WithoutSSH(t *testing.T) {
+	server := speakerServer(t, "")
+	defer server.Close()
+
+	ds := datastore.NewMemoryStore()
+	manager := NewManager("http://localhost:8000", ds)
+	manager.readRemoteFile = func(host, path string) (string, error) {
+		return "", errors.New("failed to dial")
+	}
+
+	if _, err := manager.ImportFromSpeaker(server.Listener.Addr().String(), ""); !errors.Is(err, ErrNoAccount) {
+		t.Errorf("Expected ErrNoAccount for a speaker without account, got %v", err)
+	}
+	if _, err := manager.ImportFromSpeaker(server.Listener.Addr().String(), "../family"); !errors.Is(err, ErrInvalidAccount) {
+		t.Errorf("Expected ErrInvalidAccount, got %v", err)
+	}
+
+	result, err := manager.ImportFromSpeaker(server.Listener.Addr().String(), "family")
+	if err != nil {
+		t.Fatalf("ImportFromSpeaker failed: %v", err)
+	}
+	if result.Account != "family" || len(result.Warnings) != 1 {
+		t.Errorf("Expected import into the given account with a warning, got %+v", result)
+	}
+	// The account still gets sources, so presets can be stored
+	if sources, err := ds.GetConfiguredSources("family"); err != nil || len(sources) != 0 {
+		t.Errorf("Expected empty sources, got %+v (%v)", sources, err)
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"encoding/xml"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
 	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
 	"github.com/gesellix/bose-soundtouch-api/internal/ssh"
 )
@@ -45,12 +45,25 @@ type MigrationSummary struct {
 // Manager handles the migration of speakers to the soundcork service.
 type Manager struct {
 	ServerURL string
-	DataStore *datastore.DataStore
+	DataStore datastore.Store
+
+	// readRemoteFile reads a file from a speaker, over SSH unless replaced in tests.
+	readRemoteFile func(host, path string) (string, error)
+	// runRemote and uploadRemote run a command on a speaker and write a file
+	// to it, over SSH unless replaced in tests.
+	runRemote    func(host, command string) (string, error)
+	uploadRemote func(host string, content []byte, path string) error
 }
 
 // NewManager creates a new Manager with the given base server URL.
-func NewManager(serverURL string, ds *datastore.DataStore) *Manager {
-	return &Manager{ServerURL: serverURL, DataStore: ds}
+func NewManager(serverURL string, ds datastore.Store) *Manager {
+	return &Manager{
+		ServerURL:      serverURL,
+		DataStore:      ds,
+		readRemoteFile: readRemoteFileSSH,
+		runRemote:      runRemoteSSH,
+		uploadRemote:   uploadRemoteSSH,
+	}
 }
 
 // DeviceInfoXML represents the XML structure from :8090/info
@@ -71,12 +84,7 @@ type DeviceInfoXML struct {
 
 // GetLiveDeviceInfo fetches live information from the speaker's :8090/info endpoint.
 func (m *Manager) GetLiveDeviceInfo(deviceIP string) (*DeviceInfoXML, error) {
-	infoURL := fmt.Sprintf("http://%s:8090/info", deviceIP)
-	// For testing, if the IP already contains a port, don't append :8090
-	if host, _, err := net.SplitHostPort(deviceIP); err == nil {
-		infoURL = fmt.Sprintf("http://%s/info", deviceIP)
-		_ = host
-	}
+	infoURL := speakerURL(deviceIP, constants.SpeakerDeviceInfoPath)
 	resp, err := http.Get(infoURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch info from %s: %v", infoURL, err)
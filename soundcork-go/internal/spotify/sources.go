@@ -0,0 +1,98 @@
+package spotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+const (
+	// SourceType is the source key type of Spotify sources.
+	SourceType = "SPOTIFY"
+	// SecretType is the type of the refresh token stored as source secret.
+	SecretType = "token_version_3"
+)
+
+// firstSourceID is where the speakers start numbering sources.
+const firstSourceID = 100001
+
+// SaveSource stores refreshToken as the secret of the SPOTIFY source of user
+// in account, adding the source if the user was not connected yet.
+func SaveSource(ds datastore.Store, account string, user *User, refreshToken string) (*models.ConfiguredSource, error) {
+	defer ds.LockAccount(account)()
+
+	sources, err := ds.GetConfiguredSources(account)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	name := user.DisplayName
+	if user.Email != "" {
+		name = user.Email
+	}
+	source := models.ConfiguredSource{
+		DisplayName:      name,
+		Secret:           refreshToken,
+		SecretType:       SecretType,
+		SourceKeyType:    SourceType,
+		SourceKeyAccount: user.ID,
+	}
+
+	found := false
+	nextID := firstSourceID
+	for i, s := range sources {
+		if id, err := strconv.Atoi(s.ID); err == nil && id >= nextID {
+			nextID = id + 1
+		}
+		if s.SourceKeyType == SourceType && s.SourceKeyAccount == user.ID {
+			source.ID = s.ID
+			sources[i] = source
+			found = true
+		}
+	}
+	if !found {
+		source.ID = strconv.Itoa(nextID)
+		sources = append(sources, source)
+	}
+
+	if err := ds.SaveConfiguredSources(account, sources); err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// FindSource returns the SPOTIFY source of account with refreshToken as its
+// secret, or else the first SPOTIFY source of account, with its secret
+// decrypted. It returns an error wrapping os.ErrNotExist if the account has
+// no Spotify account connected.
+func FindSource(ds datastore.Store, account, refreshToken string) (*models.ConfiguredSource, error) {
+	sources, err := ds.GetConfiguredSources(account)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	sources, err = ds.RevealSources(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	var first *models.ConfiguredSource
+	for i, s := range sources {
+		if s.SourceKeyType != SourceType || s.Secret == "" {
+			continue
+		}
+		if refreshToken != "" && s.Secret == refreshToken {
+			return &sources[i], nil
+		}
+		if first == nil {
+			first = &sources[i]
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("no spotify account connected to %s: %w", account, os.ErrNotExist)
+	}
+	return first, nil
+}
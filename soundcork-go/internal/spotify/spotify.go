@@ -0,0 +1,277 @@
+// Package spotify connects Spotify accounts to soundcork with the OAuth
+// authorization code flow and refreshes their access tokens for the speakers,
+// as the Bose cloud did for the SPOTIFY source.
+package spotify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAccountsURL = "https://accounts.spotify.com"
+	DefaultAPIURL      = "https://api.spotify.com"
+	DefaultTimeout     = 10 * time.Second
+
+	// Scopes are requested for playback and for identifying the account.
+	Scopes = "streaming user-read-email user-read-private user-read-playback-state user-modify-playback-state"
+
+	// ProviderID is the number of the SPOTIFY source provider, as used in the
+	// token paths requested by the speakers.
+	ProviderID = 15
+
+	// stateTTL is how long an authorization started with AuthURL can be
+	// confirmed.
+	stateTTL = 10 * time.Minute
+	// refreshMargin is how long before it expires a cached access token is
+	// refreshed.
+	refreshMargin = time.Minute
+)
+
+// ErrNotConfigured is returned when no Spotify app credentials are set.
+var ErrNotConfigured = errors.New("spotify is not configured")
+
+// ErrUnknownState is returned by Confirm for a state that was not issued by
+// AuthURL or has expired.
+var ErrUnknownState = errors.New("unknown or expired authorization state")
+
+// Config holds the credentials of the Spotify app soundcork acts as.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must be registered with the app and lead to the confirm
+	// endpoint of the setup API.
+	RedirectURL string
+	// AccountsURL and APIURL allow pointing at a stand-in, e.g. in tests.
+	AccountsURL string
+	APIURL      string
+}
+
+// Token is the response of the Spotify token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope,omitempty"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// User is the Spotify account a token belongs to.
+type User struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+}
+
+type pendingAuth struct {
+	account string
+	expires time.Time
+}
+
+type cachedToken struct {
+	token   Token
+	expires time.Time
+}
+
+// Client talks to the Spotify accounts service and web API. It keeps the
+// pending authorizations and caches access tokens per refresh token.
+type Client struct {
+	Config
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	pending map[string]pendingAuth
+	tokens  map[string]cachedToken
+}
+
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if cfg.AccountsURL == "" {
+		cfg.AccountsURL = DefaultAccountsURL
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	cfg.AccountsURL = strings.TrimSuffix(cfg.AccountsURL, "/")
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{
+		Config:     cfg,
+		HTTPClient: httpClient,
+		pending:    make(map[string]pendingAuth),
+		tokens:     make(map[string]cachedToken),
+	}
+}
+
+// Configured reports whether app credentials are set.
+func (c *Client) Configured() bool {
+	return c.ClientID != "" && c.ClientSecret != ""
+}
+
+// AuthURL starts connecting a Spotify account to the soundcork account and
+// returns the Spotify page to send the user to.
+func (c *Client) AuthURL(account string) (string, error) {
+	if !c.Configured() {
+		return "", ErrNotConfigured
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+
+	c.mu.Lock()
+	now := time.Now()
+	for s, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, s)
+		}
+	}
+	c.pending[state] = pendingAuth{account: account, expires: now.Add(stateTTL)}
+	c.mu.Unlock()
+
+	q := url.Values{}
+	q.Set("client_id", c.ClientID)
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", c.RedirectURL)
+	q.Set("scope", Scopes)
+	q.Set("state", state)
+	return c.AccountsURL + "/authorize?" + q.Encode(), nil
+}
+
+// Confirm completes an authorization started with AuthURL. It returns the
+// soundcork account it was started for, the token and the Spotify user.
+func (c *Client) Confirm(ctx context.Context, state, code string) (string, *Token, *User, error) {
+	c.mu.Lock()
+	p, ok := c.pending[state]
+	delete(c.pending, state)
+	c.mu.Unlock()
+	if !ok || time.Now().After(p.expires) {
+		return "", nil, nil, ErrUnknownState
+	}
+
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {c.RedirectURL},
+	})
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if token.RefreshToken == "" {
+		return "", nil, nil, errors.New("spotify returned no refresh token")
+	}
+	user, err := c.CurrentUser(ctx, token.AccessToken)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	c.cache(token.RefreshToken, *token)
+	return p.account, token, user, nil
+}
+
+// Refresh returns an access token for refreshToken. Tokens are reused until
+// shortly before they expire. If Spotify issued a new refresh token, it is
+// set in the result and replaces the old one from now on.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	if !c.Configured() {
+		return nil, ErrNotConfigured
+	}
+	c.mu.Lock()
+	cached, ok := c.tokens[refreshToken]
+	c.mu.Unlock()
+	if remaining := time.Until(cached.expires); ok && remaining > refreshMargin {
+		token := cached.token
+		token.ExpiresIn = int(remaining.Seconds())
+		return &token, nil
+	}
+
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == refreshToken {
+		token.RefreshToken = ""
+	}
+	c.cache(refreshToken, *token)
+	if token.RefreshToken != "" {
+		c.cache(token.RefreshToken, *token)
+	}
+	return token, nil
+}
+
+func (c *Client) cache(refreshToken string, token Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token.RefreshToken = ""
+	c.tokens[refreshToken] = cachedToken{
+		token:   token,
+		expires: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+}
+
+func (c *Client) requestToken(ctx context.Context, form url.Values) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.AccountsURL+"/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+
+	var token Token
+	if err := c.do(req, &token); err != nil {
+		return nil, fmt.Errorf("spotify token request failed: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("spotify returned no access token")
+	}
+	return &token, nil
+}
+
+// CurrentUser returns the Spotify user of accessToken.
+func (c *Client) CurrentUser(ctx context.Context, accessToken string) (*User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.APIURL+"/v1/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var user User
+	if err := c.do(req, &user); err != nil {
+		return nil, fmt.Errorf("spotify user request failed: %w", err)
+	}
+	if user.ID == "" {
+		return nil, errors.New("spotify returned no user ID")
+	}
+	return &user, nil
+}
+
+func (c *Client) do(req *http.Request, v interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
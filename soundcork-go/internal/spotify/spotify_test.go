@@ -0,0 +1,162 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+// newStandIn serves the token and user endpoints like Spotify does. Refresh
+// token "rotate" is answered with a new refresh token.
+func newStandIn(t *testing.T, tokenRequests *atomic.Int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		token := Token{TokenType: "Bearer", ExpiresIn: 3600, Scope: Scopes}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if r.Form.Get("code") != "good-code" || r.Form.Get("redirect_uri") != "http://soundcork/confirm" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			token.AccessToken = "access-1"
+			token.RefreshToken = "refresh-1"
+		case "refresh_token":
+			token.AccessToken = "access-" + r.Form.Get("refresh_token")
+			if r.Form.Get("refresh_token") == "rotate" {
+				token.RefreshToken = "rotated"
+			}
+		default:
+			http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(token)
+	})
+	mux.HandleFunc("GET /v1/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(User{ID: "spotify-user", DisplayName: "Jo", Email: "jo@example.com"})
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newTestClient(ts *httptest.Server) *Client {
+	return NewClient(Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://soundcork/confirm",
+		AccountsURL:  ts.URL,
+		APIURL:       ts.URL,
+	}, nil)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(newStandIn(t, &requests))
+
+	authURL, err := c.AuthURL("1234567")
+	if err != nil {
+		t.Fatalf("AuthURL failed: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != "client" || q.Get("response_type") != "code" || q.Get("state") == "" {
+		t.Errorf("Unexpected authorization URL %s", authURL)
+	}
+
+	if _, _, _, err := c.Confirm(context.Background(), "forged", "good-code"); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("Expected ErrUnknownState, got %v", err)
+	}
+
+	account, token, user, err := c.Confirm(context.Background(), q.Get("state"), "good-code")
+	if err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+	if account != "1234567" || token.RefreshToken != "refresh-1" || user.ID != "spotify-user" {
+		t.Errorf("Unexpected confirmation %s %+v %+v", account, token, user)
+	}
+
+	if _, _, _, err := c.Confirm(context.Background(), q.Get("state"), "good-code"); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("Expected the state to be usable once, got %v", err)
+	}
+}
+
+func TestConfirm_BadCode(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(newStandIn(t, &requests))
+	authURL, _ := c.AuthURL("1234567")
+	u, _ := url.Parse(authURL)
+
+	if _, _, _, err := c.Confirm(context.Background(), u.Query().Get("state"), "bad-code"); err == nil {
+		t.Error("Expected an error for a rejected code")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(newStandIn(t, &requests))
+
+	token, err := c.Refresh(context.Background(), "refresh-1")
+	if err != nil || token.AccessToken != "access-refresh-1" || token.RefreshToken != "" {
+		t.Fatalf("Refresh returned %+v (%v)", token, err)
+	}
+	if token, _ := c.Refresh(context.Background(), "refresh-1"); token.AccessToken != "access-refresh-1" || requests.Load() != 1 {
+		t.Errorf("Expected the cached token, got %+v after %d requests", token, requests.Load())
+	}
+
+	token, err = c.Refresh(context.Background(), "rotate")
+	if err != nil || token.RefreshToken != "rotated" {
+		t.Errorf("Expected a new refresh token, got %+v (%v)", token, err)
+	}
+
+	if _, err := NewClient(Config{}, nil).Refresh(context.Background(), "refresh-1"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured, got %v", err)
+	}
+}
+
+func TestSources(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	if _, err := FindSource(ds, "1234567", ""); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist without sources, got %v", err)
+	}
+
+	ds.SaveConfiguredSources("1234567", []models.ConfiguredSource{{ID: "100001", SourceKeyType: "TUNEIN"}})
+	src, err := SaveSource(ds, "1234567", &User{ID: "spotify-user", Email: "jo@example.com"}, "refresh-1")
+	if err != nil || src.ID != "100002" || src.DisplayName != "jo@example.com" {
+		t.Fatalf("SaveSource returned %+v (%v)", src, err)
+	}
+	SaveSource(ds, "1234567", &User{ID: "other-user"}, "refresh-2")
+	if src, _ := SaveSource(ds, "1234567", &User{ID: "spotify-user"}, "refresh-3"); src.ID != "100002" {
+		t.Errorf("Expected the source of the user to be updated, got %+v", src)
+	}
+
+	sources, _ := ds.GetConfiguredSources("1234567")
+	if len(sources) != 3 {
+		t.Errorf("Expected 3 sources, got %+v", sources)
+	}
+
+	if src, _ := FindSource(ds, "1234567", "refresh-2"); src.SourceKeyAccount != "other-user" {
+		t.Errorf("Expected the source matching the refresh token, got %+v", src)
+	}
+	if src, _ := FindSource(ds, "1234567", "unknown"); src.SourceKeyAccount != "spotify-user" || src.Secret != "refresh-3" {
+		t.Errorf("Expected the first Spotify source, got %+v", src)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/go-chi/chi/v5"
+)
+
+// accountSummary is an account as listed by the setup API.
+type accountSummary struct {
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+type accountRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) accountSummary(account string) accountSummary {
+	devices, err := s.ds.ListAccountDevices(account)
+	if err != nil {
+		devices = []string{}
+	}
+	return accountSummary{Name: account, Devices: devices}
+}
+
+// accountError writes err with the status matching it.
+func accountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, os.ErrExist):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleListAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := s.ds.ListAccounts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := []accountSummary{}
+	for _, account := range accounts {
+		summaries = append(summaries, s.accountSummary(account))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+	if !s.ds.AccountExists(account) {
+		http.Error(w, "account not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.accountSummary(account))
+}
+
+// handleCreateAccount creates an account with empty presets, recents and sources.
+func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
+	var req accountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := datastore.ValidateAccountName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := datastore.NewAccount(s.ds, req.Name); err != nil {
+		accountError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s.accountSummary(req.Name))
+}
+
+// handleRenameAccount renames an account. Speakers keep using the old name
+// until they are migrated again.
+func (s *Server) handleRenameAccount(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+	var req accountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := datastore.ValidateAccountName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ds.RenameAccount(account, req.Name); err != nil {
+		accountError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.accountSummary(req.Name))
+}
+
+// handleDeleteAccount archives an account, see datastore.DeviceStore.
+func (s *Server) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+	if err := s.ds.DeleteAccount(account); err != nil {
+		accountError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "message": "Account archived"})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestAccountsAPI(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	ds.Initialize()
+	r, _ := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	doJSON := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		res := doJSON("POST", "/setup/accounts", `{"name": "1234567"}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected 201, got %v", res.Status)
+		}
+		if presets, err := ds.GetPresets("1234567"); err != nil || len(presets) != 0 {
+			t.Errorf("Expected empty presets for new account, got %+v (%v)", presets, err)
+		}
+
+		res = doJSON("POST", "/setup/accounts", `{"name": "1234567"}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusConflict {
+			t.Errorf("Expected 409 for existing account, got %v", res.Status)
+		}
+
+		res = doJSON("POST", "/setup/accounts", `{"name": "../x"}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for invalid name, got %v", res.Status)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		ds.SaveDeviceInfo("1234567", "dev1", &models.DeviceInfo{DeviceID: "dev1"})
+
+		res := doJSON("GET", "/setup/accounts", "")
+		defer res.Body.Close()
+		var accounts []accountSummary
+		json.NewDecoder(res.Body).Decode(&accounts)
+		if len(accounts) != 2 || accounts[0].Name != "1234567" || len(accounts[0].Devices) != 1 || accounts[1].Name != "default" {
+			t.Errorf("Unexpected accounts %+v", accounts)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		res := doJSON("PUT", "/setup/accounts/1234567", `{"name": "default"}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusConflict {
+			t.Errorf("Expected 409 renaming onto an existing account, got %v", res.Status)
+		}
+
+		res = doJSON("PUT", "/setup/accounts/1234567", `{"name": "7654321"}`)
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", res.Status)
+		}
+		var renamed accountSummary
+		json.NewDecoder(res.Body).Decode(&renamed)
+		if renamed.Name != "7654321" || len(renamed.Devices) != 1 {
+			t.Errorf("Unexpected renamed account %+v", renamed)
+		}
+
+		res = doJSON("GET", "/setup/accounts/1234567", "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for old name, got %v", res.Status)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		res := doJSON("DELETE", "/setup/accounts/7654321", "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", res.Status)
+		}
+		if ds.AccountExists("7654321") {
+			t.Error("Expected account to be gone")
+		}
+
+		res = doJSON("DELETE", "/setup/accounts/7654321", "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 deleting again, got %v", res.Status)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+)
+
+// maxImportSize limits the size of an uploaded archive.
+const maxImportSize = 256 << 20
+
+// handleExport downloads all accounts, stations and stream stats as a
+// tar.gz archive, see datastore.ExportArchive.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if _, err := datastore.ExportArchive(&buf, s.ds); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("soundcork-export-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(buf.Bytes())
+}
+
+// handleImport restores an archive from the request body. The mode query
+// parameter selects "merge" (default) or "replace".
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	mode := datastore.ImportMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = datastore.ImportMerge
+	}
+	if mode != datastore.ImportMerge && mode != datastore.ImportReplace {
+		http.Error(w, fmt.Sprintf("unknown import mode %q", mode), http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := datastore.ImportArchive(s.ds, http.MaxBytesReader(w, r.Body, maxImportSize), mode)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrInvalidArchive) {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":       true,
+		"message":  fmt.Sprintf("Imported %d accounts", len(manifest.Accounts)),
+		"manifest": manifest,
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestExportImport(t *testing.T) {
+	src := datastore.NewMemoryStore()
+	src.Initialize()
+	src.SaveDeviceInfo("1234567", "dev1", &models.DeviceInfo{DeviceID: "dev1", Name: "Kitchen"})
+	src.SavePresets("1234567", []models.Preset{})
+	r, _ := setupRouter("http://localhost:8001", src)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/setup/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/gzip" {
+		t.Fatalf("Unexpected export response %v (%s)", res.Status, res.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(res.Header.Get("Content-Disposition"), "soundcork-export-") {
+		t.Errorf("Unexpected Content-Disposition %q", res.Header.Get("Content-Disposition"))
+	}
+
+	dst := datastore.NewMemoryStore()
+	dst.SaveDeviceInfo("other", "dev2", &models.DeviceInfo{DeviceID: "dev2"})
+	r, _ = setupRouter("http://localhost:8001", dst)
+	ts2 := httptest.NewServer(r)
+	defer ts2.Close()
+
+	t.Run("Invalid", func(t *testing.T) {
+		res, err := http.Post(ts2.URL+"/setup/import", "application/gzip", strings.NewReader("not an archive"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %v", res.Status)
+		}
+
+		res, err = http.Post(ts2.URL+"/setup/import?mode=append", "application/gzip", bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for unknown mode, got %v", res.Status)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		res, err := http.Post(ts2.URL+"/setup/import", "application/gzip", bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var result struct {
+			OK       bool                      `json:"ok"`
+			Manifest datastore.ArchiveManifest `json:"manifest"`
+		}
+		json.NewDecoder(res.Body).Decode(&result)
+		if res.StatusCode != http.StatusOK || !result.OK || len(result.Manifest.Accounts) != 2 {
+			t.Fatalf("Unexpected import response %v %+v", res.Status, result)
+		}
+		if info, err := dst.GetDeviceInfo("1234567", "dev1"); err != nil || info.Name != "Kitchen" {
+			t.Errorf("Unexpected device info %+v (%v)", info, err)
+		}
+		if !dst.AccountExists("other") {
+			t.Error("Expected existing account to be kept")
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		res, err := http.Post(ts2.URL+"/setup/import?mode=replace", "application/gzip", bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", res.Status)
+		}
+		if dst.AccountExists("other") {
+			t.Error("Expected existing account to be removed")
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// adminOnlyReads are GET endpoints the read-only role may not use, because
+// they hand out data a backup would contain or start a change.
+var adminOnlyReads = []string{
+	"/setup/export",
+	"/setup/spotify/init",
+	"/setup/spotify/confirm",
+	"/setup/api-tokens",
+}
+
+// requireSetupAuth lets requests to the management API through only with a
+// session or API token, once credentials are configured. The read-only role
+// may only view.
+func (s *Server) requireSetupAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.auth.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		role, ok := s.auth.Authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="soundcork"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if role != auth.RoleAdmin && !readOnlyAllowed(r) {
+			http.Error(w, "not allowed for role "+string(role), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func readOnlyAllowed(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return !slices.Contains(adminOnlyReads, r.URL.Path)
+}
+
+// handleAuthStatus tells the management page whether a login is needed.
+func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{"enabled": false}
+	if s.auth.Enabled() {
+		status["enabled"] = true
+		if role, ok := s.auth.Authenticate(r); ok {
+			status["role"] = role
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid login request", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.auth.Enabled() {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "role": auth.RoleAdmin})
+		return
+	}
+	id, role, err := s.auth.Login(req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		log.Printf("Failed login to the management API from %s", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": err.Error()})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(auth.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax still sends the cookie when Spotify redirects back to the confirm endpoint
+		SameSite: http.SameSiteLaxMode,
+	})
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "role": role})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(auth.SessionCookie); err == nil {
+		s.auth.Logout(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: auth.SessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListAPITokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.auth.Tokens())
+}
+
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string    `json:"name"`
+		Role auth.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "name and role are required", http.StatusBadRequest)
+		return
+	}
+	if req.Role != auth.RoleAdmin && req.Role != auth.RoleReadOnly {
+		http.Error(w, "role must be admin or read-only", http.StatusBadRequest)
+		return
+	}
+
+	token, created, err := s.auth.CreateToken(req.Name, req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Created API token %s (%s) with role %s", created.ID, created.Name, created.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":    created.ID,
+		"name":  created.Name,
+		"role":  created.Role,
+		"token": token,
+	})
+}
+
+func (s *Server) handleDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	err := s.auth.DeleteToken(chi.URLParam(r, "tokenID"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
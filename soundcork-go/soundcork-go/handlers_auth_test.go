@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/auth"
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+)
+
+func TestSetupAuth(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	ds.Initialize()
+	r, server := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(client *http.Client, method, path, token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	if res := do(http.DefaultClient, http.MethodGet, "/setup/stations", "", ""); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the API to be open without credentials, got %v", res.Status)
+	}
+
+	server.auth, _ = auth.NewManager(auth.Config{AdminPassword: "admin", ReadOnlyPassword: "viewer", AdminToken: "bootstrap"}, "")
+
+	t.Run("Anonymous", func(t *testing.T) {
+		for _, path := range []string{"/setup/stations", "/setup/proxy-settings", "/setup/export"} {
+			if res := do(http.DefaultClient, http.MethodGet, path, "", ""); res.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected 401 for %s, got %v", path, res.Status)
+			}
+		}
+		if res := do(http.DefaultClient, http.MethodPost, "/setup/proxy-settings", "", `{"redact":false}`); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for changing proxy settings, got %v", res.Status)
+		}
+		if res := do(http.DefaultClient, http.MethodGet, "/marge/streaming/sourceproviders", "", ""); res.StatusCode != http.StatusOK {
+			t.Errorf("Expected speaker endpoints to stay open, got %v", res.Status)
+		}
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		if res := do(client, http.MethodPost, "/setup/login", "", `{"password":"wrong"}`); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a wrong password, got %v", res.Status)
+		}
+
+		if res := do(client, http.MethodPost, "/setup/login", "", `{"password":"viewer"}`); res.StatusCode != http.StatusOK {
+			t.Fatalf("Login failed: %v", res.Status)
+		}
+		res, _ := client.Get(ts.URL + "/setup/auth")
+		var status struct {
+			Enabled bool      `json:"enabled"`
+			Role    auth.Role `json:"role"`
+		}
+		json.NewDecoder(res.Body).Decode(&status)
+		res.Body.Close()
+		if !status.Enabled || status.Role != auth.RoleReadOnly {
+			t.Errorf("Unexpected auth status %+v", status)
+		}
+
+		if res := do(client, http.MethodGet, "/setup/stations", "", ""); res.StatusCode != http.StatusOK {
+			t.Errorf("Expected the read-only role to view stations, got %v", res.Status)
+		}
+		if res := do(client, http.MethodGet, "/setup/export", "", ""); res.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected the read-only role not to export, got %v", res.Status)
+		}
+		if res := do(client, http.MethodPost, "/setup/proxy-settings", "", `{"redact":false}`); res.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected the read-only role not to change settings, got %v", res.Status)
+		}
+
+		do(client, http.MethodPost, "/setup/logout", "", "")
+		if res := do(client, http.MethodGet, "/setup/stations", "", ""); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 after logout, got %v", res.Status)
+		}
+
+		do(client, http.MethodPost, "/setup/login", "", `{"password":"admin"}`)
+		if res := do(client, http.MethodGet, "/setup/export", "", ""); res.StatusCode != http.StatusOK {
+			t.Errorf("Expected the admin to export, got %v", res.Status)
+		}
+	})
+
+	t.Run("APITokens", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/setup/api-tokens", strings.NewReader(`{"name":"monitoring","role":"read-only"}`))
+		req.Header.Set("Authorization", "Bearer bootstrap")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var created struct {
+			ID    string `json:"id"`
+			Token string `json:"token"`
+		}
+		json.NewDecoder(res.Body).Decode(&created)
+		res.Body.Close()
+		if res.StatusCode != http.StatusCreated || created.Token == "" {
+			t.Fatalf("Expected a new token, got %v %+v", res.Status, created)
+		}
+
+		if res := do(http.DefaultClient, http.MethodGet, "/setup/stations", created.Token, ""); res.StatusCode != http.StatusOK {
+			t.Errorf("Expected the API token to be accepted, got %v", res.Status)
+		}
+		if res := do(http.DefaultClient, http.MethodGet, "/setup/api-tokens", created.Token, ""); res.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected a read-only token not to list tokens, got %v", res.Status)
+		}
+		if res := do(http.DefaultClient, http.MethodPost, "/setup/api-tokens", "bootstrap", `{"name":"x","role":"root"}`); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown role, got %v", res.Status)
+		}
+
+		if res := do(http.DefaultClient, http.MethodDelete, "/setup/api-tokens/"+created.ID, "bootstrap", ""); res.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected the token to be deleted, got %v", res.Status)
+		}
+		if res := do(http.DefaultClient, http.MethodGet, "/setup/stations", created.Token, ""); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected a deleted token to be rejected, got %v", res.Status)
+		}
+	})
+}
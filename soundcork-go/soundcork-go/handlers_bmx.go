@@ -1,44 +1,46 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gesellix/bose-soundtouch-api/internal/bmx"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
 	"github.com/go-chi/chi/v5"
 )
 
+// bmxFavoritePath is the prefix of the bmx_favorite links in playback responses.
+const bmxFavoritePath = "/v1/favorite/"
+
 func (s *Server) handleBMXRegistry(w http.ResponseWriter, r *http.Request) {
-	data, err := os.ReadFile("soundcork/bmx_services.json")
-	if err != nil {
-		data, err = os.ReadFile("../soundcork/bmx_services.json")
-	}
-	if err != nil {
-		data, err = os.ReadFile("../../soundcork/bmx_services.json")
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.registry.Services(s.serverURL))
+}
+
+func (s *Server) handleTuneInPlayback(w http.ResponseWriter, r *http.Request) {
+	stationID := chi.URLParam(r, "stationID")
+	resp, err := s.tuneIn.TuneInPlayback(r.Context(), stationID)
 	if err != nil {
-		http.Error(w, "Failed to read services", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8000"
-	}
-
-	content := string(data)
-	content = strings.ReplaceAll(content, "{BMX_SERVER}", baseURL)
-	content = strings.ReplaceAll(content, "{MEDIA_SERVER}", baseURL+"/media")
-
+	s.markFavorite(r, resp)
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(content))
+	json.NewEncoder(w).Encode(resp)
 }
 
-func (s *Server) handleTuneInPlayback(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleTuneInNowPlaying(w http.ResponseWriter, r *http.Request) {
 	stationID := chi.URLParam(r, "stationID")
-	resp, err := bmx.TuneInPlayback(stationID)
+	resp, err := s.tuneIn.TuneInNowPlaying(r.Context(), stationID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -50,7 +52,7 @@ func (s *Server) handleTuneInPlayback(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleTuneInPodcastInfo(w http.ResponseWriter, r *http.Request) {
 	podcastID := chi.URLParam(r, "podcastID")
 	encodedName := r.URL.Query().Get("encoded_name")
-	resp, err := bmx.TuneInPodcastInfo(podcastID, encodedName)
+	resp, err := s.tuneIn.TuneInPodcastInfo(r.Context(), podcastID, encodedName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -61,11 +63,17 @@ func (s *Server) handleTuneInPodcastInfo(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) handleTuneInPlaybackPodcast(w http.ResponseWriter, r *http.Request) {
 	podcastID := chi.URLParam(r, "podcastID")
-	resp, err := bmx.TuneInPlaybackPodcast(podcastID)
+	resp, err := s.tuneIn.TuneInPlaybackPodcast(r.Context(), podcastID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.markFavorite(r, resp)
+	if s.ds != nil {
+		if pos, err := s.ds.GetPlaybackPosition(s.accountForRequest(r), podcastID); err == nil {
+			resp.ResumeOffset = pos.Position
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
@@ -77,6 +85,244 @@ func (s *Server) handleOrionPlayback(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.tuneIn.ResolveAudio(r.Context(), &resp.Audio)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+func (s *Server) handleLibraryNavigate(w http.ResponseWriter, r *http.Request) {
+	stations, err := s.ds.GetStations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bmx.LibraryNavigate(stations))
+}
+
+func (s *Server) handleLibraryPlayback(w http.ResponseWriter, r *http.Request) {
+	station, err := s.ds.GetStation(chi.URLParam(r, "stationID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	resp, err := bmx.LibraryPlayback(*station)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.tuneIn.ResolveAudio(r.Context(), &resp.Audio)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleTuneInToken(w http.ResponseWriter, r *http.Request) {
+	var req models.BmxTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid token request", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := bmx.TuneInToken(s.bmxTokenSecret, s.deviceIDForRequest(r), req)
+	if errors.Is(err, bmx.ErrInvalidTokenRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleTuneInReport(w http.ResponseWriter, r *http.Request) {
+	var report models.BmxReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil && err != io.EOF {
+		http.Error(w, "Invalid report payload", http.StatusBadRequest)
+		return
+	}
+
+	event, resp := bmx.TuneInReport(r.URL.Query(), report)
+	if s.ds != nil {
+		s.ds.AddDeviceEvent(s.deviceIDForRequest(r), *event)
+		s.recordPlaybackPosition(r, report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recordPlaybackPosition keeps the position of on-demand episodes from playback
+// reports, so they can be resumed on any speaker of the account.
+func (s *Server) recordPlaybackPosition(r *http.Request, report models.BmxReportRequest) {
+	query := r.URL.Query()
+	episodeID := query.Get("guide_id")
+	if query.Get("stream_type") != "onDemand" || episodeID == "" {
+		return
+	}
+
+	account, deviceID := s.deviceForRequest(r)
+	pos, err := s.ds.GetPlaybackPosition(account, episodeID)
+	if err != nil {
+		pos = &models.PlaybackPosition{EpisodeID: episodeID}
+		// Usually served from the cache, as the speaker just fetched the episode.
+		if playback, err := s.tuneIn.TuneInPlaybackPodcast(r.Context(), episodeID); err == nil {
+			pos.Name = playback.Name
+			pos.ShowName = playback.Artist.Name
+			pos.ImageUrl = playback.ImageUrl
+			pos.Duration = playback.Duration
+		}
+	}
+	pos.DeviceID = deviceID
+
+	updated, inProgress := bmx.ResumePosition(*pos, report, time.Now())
+	if !inProgress {
+		s.ds.RemovePlaybackPosition(account, episodeID)
+		return
+	}
+	if err := s.ds.SavePlaybackPosition(account, updated); err != nil {
+		log.Printf("Failed to save playback position for %s: %v", episodeID, err)
+	}
+}
+
+// deviceForRequest identifies the calling speaker and its account by the remote
+// address. BMX requests carry neither, so known devices are matched by IP,
+// falling back to the default account and the IP itself for devices we have
+// not discovered yet.
+func (s *Server) deviceForRequest(r *http.Request) (account string, deviceID string) {
+	account, deviceID, _ = s.callerDevice(r)
+	return account, deviceID
+}
+
+// callerDevice identifies the device sending r by its address. For unknown
+// addresses, known is false, account is "default" and deviceID the address.
+// Within identifyCaller, the device is only looked up once per request.
+func (s *Server) callerDevice(r *http.Request) (account, deviceID string, known bool) {
+	c, ok := r.Context().Value(callerKey{}).(*caller)
+	if !ok {
+		return s.lookupCaller(r)
+	}
+	c.once.Do(func() {
+		c.account, c.deviceID, c.known = s.lookupCaller(r)
+	})
+	return c.account, c.deviceID, c.known
+}
+
+func (s *Server) lookupCaller(r *http.Request) (account, deviceID string, known bool) {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if s.ds == nil {
+		return "default", ip, false
+	}
+	account, info, err := s.ds.FindDeviceByIP(ip)
+	if err != nil {
+		log.Printf("BMX request from unknown device %s", ip)
+		return "default", ip, false
+	}
+	return account, info.DeviceID, true
+}
+
+type callerKey struct{}
+
+// caller is the device sending a request, looked up on first use.
+type caller struct {
+	once     sync.Once
+	account  string
+	deviceID string
+	known    bool
+}
+
+// identifyCaller lets all handlers and middleware of a request share one
+// lookup of the calling device, which reads every known device.
+func (s *Server) identifyCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, &caller{})))
+	})
+}
+
+func (s *Server) deviceIDForRequest(r *http.Request) string {
+	_, deviceID := s.deviceForRequest(r)
+	return deviceID
+}
+
+func (s *Server) accountForRequest(r *http.Request) string {
+	account, _ := s.deviceForRequest(r)
+	return account
+}
+
+// accountForDevice returns the account device is registered with, falling
+// back to the caller's address for unknown devices.
+func (s *Server) accountForDevice(r *http.Request, device string) string {
+	accounts, _ := s.ds.ListAccounts()
+	for _, account := range accounts {
+		devices, _ := s.ds.ListAccountDevices(account)
+		if slices.Contains(devices, device) {
+			return account
+		}
+	}
+	return s.accountForRequest(r)
+}
+
+// markFavorite sets IsFavorite on a playback response from the caller's favorites.
+func (s *Server) markFavorite(r *http.Request, resp *models.BmxPlaybackResponse) {
+	if s.ds == nil || resp.Links == nil || resp.Links.BmxFavorite == nil {
+		return
+	}
+	id := strings.TrimPrefix(resp.Links.BmxFavorite.Href, bmxFavoritePath)
+	isFavorite := s.ds.IsFavorite(s.accountForRequest(r), id)
+	resp.IsFavorite = &isFavorite
+}
+
+func (s *Server) handleTuneInFavorites(w http.ResponseWriter, r *http.Request) {
+	favorites, err := s.ds.GetFavorites(s.accountForRequest(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(favorites)
+}
+
+func (s *Server) handleTuneInAddFavorite(w http.ResponseWriter, r *http.Request) {
+	var favorite models.Favorite
+	if err := json.NewDecoder(r.Body).Decode(&favorite); err != nil && err != io.EOF {
+		http.Error(w, "Invalid favorite payload", http.StatusBadRequest)
+		return
+	}
+	favorite.ID = chi.URLParam(r, "favoriteID")
+
+	// The speaker only sends the ID; stations can be named from TuneIn.
+	if favorite.Name == "" && strings.HasPrefix(favorite.ID, "s") {
+		if playback, err := s.tuneIn.TuneInPlayback(r.Context(), favorite.ID); err == nil {
+			favorite.Name = playback.Name
+			favorite.ImageUrl = playback.ImageUrl
+		}
+	}
+
+	if err := s.ds.AddFavorite(s.accountForRequest(r), favorite); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeFavoriteResponse(w, favorite.ID, true)
+}
+
+func (s *Server) handleTuneInRemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "favoriteID")
+	if err := s.ds.RemoveFavorite(s.accountForRequest(r), id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeFavoriteResponse(w, id, false)
+}
+
+func writeFavoriteResponse(w http.ResponseWriter, id string, isFavorite bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.BmxFavoriteResponse{
+		Links: &models.Links{
+			Self: &models.Link{Href: bmxFavoritePath + id},
+		},
+		IsFavorite: isFavorite,
+	})
+}
@@ -5,8 +5,13 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/bmx"
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
 )
 
 func TestBMXServices(t *testing.T) {
@@ -69,3 +74,340 @@ func TestOrionPlayback(t *testing.T) {
 		t.Errorf("Expected name Test Orion, got %v", resp["name"])
 	}
 }
+
+func TestTuneInToken(t *testing.T) {
+	r, _ := setupRouter("http://localhost:8001", nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	payload := `{"grant_type": "refresh_token", "refresh_token": "a-bose-jwt"}`
+	res, err := http.Post(ts.URL+"/bmx/tunein/v1/token", "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", res.Status)
+	}
+
+	var resp map[string]string
+	json.NewDecoder(res.Body).Decode(&resp)
+	if strings.Count(resp["access_token"], ".") != 2 {
+		t.Errorf("Expected a JWT access token, got %q", resp["access_token"])
+	}
+}
+
+func TestTuneInToken_MissingRefreshToken(t *testing.T) {
+	r, _ := setupRouter("http://localhost:8001", nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, payload := range []string{"", `{"grant_type": "refresh_token"}`} {
+		res, err := http.Post(ts.URL+"/bmx/tunein/v1/token", "application/json", strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %v", payload, res.Status)
+		}
+	}
+}
+
+func TestTuneInReport(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	ds.SaveDeviceInfo("default", "SPEAKER1", &models.DeviceInfo{DeviceID: "SPEAKER1", IPAddress: "127.0.0.1"})
+
+	r, _ := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	reportURL := ts.URL + "/bmx/tunein/v1/report?stream_id=e3342&guide_id=s12345&listen_id=1&stream_type=liveRadio"
+	payload := `{"timeStamp": "2025-10-31T05:38:55+0000", "eventType": "START", "reason": "USER_SELECT_PLAYABLE", "timeIntoTrack": 0, "playbackDelay": 6664}`
+	res, err := http.Post(reportURL, "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", res.Status)
+	}
+
+	var resp models.BmxReportResponse
+	json.NewDecoder(res.Body).Decode(&resp)
+	if resp.NextReportIn != 1800 {
+		t.Errorf("Expected nextReportIn 1800, got %d", resp.NextReportIn)
+	}
+
+	events := ds.GetDeviceEvents("SPEAKER1")
+	if len(events) != 1 || events[0].Type != "tunein-start" {
+		t.Errorf("Expected one tunein-start event for SPEAKER1, got %+v", events)
+	}
+}
+
+func TestTuneInPlaybackHandler(t *testing.T) {
+	fixtures := "../internal/bmx/testdata"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		file := "tune_" + id + ".txt"
+		if r.URL.Path == "/describe.ashx" {
+			file = "describe_" + id + ".xml"
+		}
+		http.ServeFile(w, r, filepath.Join(fixtures, file))
+	}))
+	defer upstream.Close()
+
+	r, server := setupRouter("http://localhost:8001", nil)
+	server.tuneIn = bmx.NewClient(upstream.URL, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/bmx/tunein/v1/playback/station/s12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", res.Status)
+	}
+
+	var resp models.BmxPlaybackResponse
+	json.NewDecoder(res.Body).Decode(&resp)
+	if resp.Name != "Test Radio" {
+		t.Errorf("Expected name Test Radio, got %s", resp.Name)
+	}
+	if resp.Audio.StreamUrl != "http://stream.example.com/test.mp3" {
+		t.Errorf("Unexpected stream URL %s", resp.Audio.StreamUrl)
+	}
+}
+
+func TestTuneInNowPlayingHandler(t *testing.T) {
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/describe.ashx":
+			http.ServeFile(w, r, filepath.Join("../internal/bmx/testdata", "describe_s12345.xml"))
+		case "/Tune.ashx":
+			w.Write([]byte(upstream.URL + "/stream\n"))
+		case "/stream":
+			meta := []byte("StreamTitle='Artist - Title';\x00\x00\x00")
+			w.Header().Set("icy-metaint", "4")
+			w.Write([]byte{0, 0, 0, 0, byte(len(meta) / 16)})
+			w.Write(meta)
+		}
+	}))
+	defer upstream.Close()
+
+	r, server := setupRouter("http://localhost:8001", nil)
+	server.tuneIn = bmx.NewClient(upstream.URL, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/bmx/tunein/v1/now-playing/station/s12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", res.Status)
+	}
+
+	var resp models.BmxNowPlayingResponse
+	json.NewDecoder(res.Body).Decode(&resp)
+	if resp.Artist.Name != "Artist" || resp.Name != "Title" {
+		t.Errorf("Expected Artist / Title, got %q / %q", resp.Artist.Name, resp.Name)
+	}
+}
+
+func TestTuneInFavorites(t *testing.T) {
+	fixtures := "../internal/bmx/testdata"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		file := "tune_" + id + ".txt"
+		if r.URL.Path == "/describe.ashx" {
+			file = "describe_" + id + ".xml"
+		}
+		http.ServeFile(w, r, filepath.Join(fixtures, file))
+	}))
+	defer upstream.Close()
+
+	ds := datastore.NewMemoryStore()
+	r, server := setupRouter("http://localhost:8001", ds)
+	server.tuneIn = bmx.NewClient(upstream.URL, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	isFavorite := func() bool {
+		res, err := http.Get(ts.URL + "/bmx/tunein/v1/playback/station/s12345")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var resp models.BmxPlaybackResponse
+		json.NewDecoder(res.Body).Decode(&resp)
+		return resp.IsFavorite != nil && *resp.IsFavorite
+	}
+
+	if isFavorite() {
+		t.Error("Expected station not to be a favorite initially")
+	}
+
+	res, err := http.Post(ts.URL+"/bmx/tunein/v1/favorite/s12345", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var favResp models.BmxFavoriteResponse
+	json.NewDecoder(res.Body).Decode(&favResp)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !favResp.IsFavorite {
+		t.Fatalf("Expected favorite to be added, got %v %+v", res.Status, favResp)
+	}
+
+	if !isFavorite() {
+		t.Error("Expected station to be a favorite after adding")
+	}
+
+	res, _ = http.Get(ts.URL + "/bmx/tunein/v1/favorites")
+	var favorites []models.Favorite
+	json.NewDecoder(res.Body).Decode(&favorites)
+	res.Body.Close()
+	if len(favorites) != 1 || favorites[0].Name != "Test Radio" {
+		t.Errorf("Expected favorite named from TuneIn, got %+v", favorites)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/bmx/tunein/v1/favorite/s12345", nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected favorite to be removed, got %v", res.Status)
+	}
+	if isFavorite() {
+		t.Error("Expected station not to be a favorite after removing")
+	}
+}
+
+func TestTuneInResumePosition(t *testing.T) {
+	fixtures := "../internal/bmx/testdata"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		file := "tune_" + id + ".txt"
+		if r.URL.Path == "/describe.ashx" {
+			file = "describe_" + id + ".xml"
+		}
+		http.ServeFile(w, r, filepath.Join(fixtures, file))
+	}))
+	defer upstream.Close()
+
+	ds := datastore.NewMemoryStore()
+	ds.SaveDeviceInfo("default", "KITCHEN", &models.DeviceInfo{DeviceID: "KITCHEN", IPAddress: "127.0.0.1"})
+	r, server := setupRouter("http://localhost:8001", ds)
+	server.tuneIn = bmx.NewClient(upstream.URL, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	reportURL := ts.URL + "/bmx/tunein/v1/report?stream_id=e3342&guide_id=t98765&listen_id=1&stream_type=onDemand"
+	res, err := http.Post(reportURL, "application/json", strings.NewReader(`{"eventType": "START", "timeIntoTrack": 600}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = http.Get(ts.URL + "/bmx/tunein/v1/playback/episode/t98765")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var playback models.BmxPlaybackResponse
+	json.NewDecoder(res.Body).Decode(&playback)
+	res.Body.Close()
+	if playback.ResumeOffset != 600 {
+		t.Errorf("Expected resume offset 600, got %d", playback.ResumeOffset)
+	}
+
+	// Another speaker starting the episode reports no timeIntoTrack yet
+	res, err = http.Post(reportURL, "application/json", strings.NewReader(`{"eventType": "START", "timeIntoTrack": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = http.Get(ts.URL + "/bmx/tunein/v1/playback/episode/t98765")
+	if err != nil {
+		t.Fatal(err)
+	}
+	playback = models.BmxPlaybackResponse{}
+	json.NewDecoder(res.Body).Decode(&playback)
+	res.Body.Close()
+	if playback.ResumeOffset != 600 {
+		t.Errorf("Expected resume offset 600 after a START at 0, got %d", playback.ResumeOffset)
+	}
+
+	res, _ = http.Get(ts.URL + "/setup/playback-positions")
+	var positions []models.PlaybackPosition
+	json.NewDecoder(res.Body).Decode(&positions)
+	res.Body.Close()
+	if len(positions) != 1 {
+		t.Fatalf("Expected one in-progress episode, got %+v", positions)
+	}
+	pos := positions[0]
+	if pos.Account != "default" || pos.Name != "Episode 42" || pos.ShowName != "Test Show" || pos.Duration != 1800 || pos.DeviceID != "KITCHEN" {
+		t.Errorf("Unexpected position %+v", pos)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/setup/playback-positions/default/t98765", nil)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 clearing position, got %v", res.Status)
+	}
+	if _, err := ds.GetPlaybackPosition("default", "t98765"); err == nil {
+		t.Error("Expected position to be cleared")
+	}
+}
+
+// countingStore counts the lookups of devices by address.
+type countingStore struct {
+	datastore.Store
+	lookups int
+}
+
+func (c *countingStore) FindDeviceByIP(ip string) (string, *models.DeviceInfo, error) {
+	c.lookups++
+	return c.Store.FindDeviceByIP(ip)
+}
+
+func TestIdentifyCaller(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	ds.SaveDeviceInfo("1234567", "DEV1", &models.DeviceInfo{DeviceID: "DEV1", IPAddress: "192.168.1.10"})
+	store := &countingStore{Store: ds}
+	server := &Server{ds: store}
+
+	for _, ip := range []string{"192.168.1.10", "192.168.1.99"} {
+		store.lookups = 0
+		var accounts []string
+		handler := server.identifyCaller(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accounts = append(accounts, server.accountForRequest(r), server.accountForRequest(r))
+			if _, deviceID, known := server.callerDevice(r); known != (ip == "192.168.1.10") || deviceID == "" {
+				t.Errorf("Unexpected caller %s (known %v) for %s", deviceID, known, ip)
+			}
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/bmx/tunein/v1/favorites", nil)
+		req.RemoteAddr = ip + ":41000"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if store.lookups != 1 {
+			t.Errorf("Expected one lookup for %s, got %d", ip, store.lookups)
+		}
+		if accounts[0] != accounts[1] {
+			t.Errorf("Expected the same account on every call, got %v", accounts)
+		}
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 func TestEventLog(t *testing.T) {
-	ds := datastore.NewDataStore(t.TempDir())
+	ds := datastore.NewMemoryStore()
 	s := &Server{ds: ds}
 
 	r := chi.NewRouter()
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/marge"
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *Server) handleListPresetHistory(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+	device := chi.URLParam(r, "device")
+	history, err := s.ds.GetPresetHistory(account, device)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleRestorePresetVersion puts a past preset version back on its device.
+// With ?previous=true, the content the version replaced is restored instead.
+func (s *Server) handleRestorePresetVersion(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+	versionID := chi.URLParam(r, "versionID")
+	previous := r.URL.Query().Get("previous") == "true"
+
+	restored, err := marge.RestorePresetVersion(s.ds, account, versionID, previous)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, marge.ErrEmptyPreset) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restored)
+}
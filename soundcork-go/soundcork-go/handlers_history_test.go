@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestPresetHistory(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	account := "12345"
+	ds.SaveConfiguredSources(account, []models.ConfiguredSource{{ID: "SRC1", SourceKeyType: "TUNEIN"}})
+	ds.SavePresets(account, []models.Preset{})
+
+	r, _ := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, name := range []string{"Favourite", "Overwritten"} {
+		payload := `<preset><name>` + name + `</name><sourceid>SRC1</sourceid><location>/station/s1</location><contentItemType>station</contentItemType></preset>`
+		res, err := http.Post(ts.URL+"/marge/accounts/"+account+"/devices/DEV1/presets/1", "application/xml", strings.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	var history []models.PresetVersion
+	t.Run("List per device", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/setup/preset-history/" + account + "/DEV1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		json.NewDecoder(res.Body).Decode(&history)
+		if len(history) != 2 || history[0].Preset.Name != "Overwritten" {
+			t.Fatalf("Unexpected history %+v", history)
+		}
+
+		res, err = http.Get(ts.URL + "/setup/preset-history/" + account + "/DEV2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var other []models.PresetVersion
+		json.NewDecoder(res.Body).Decode(&other)
+		if other == nil || len(other) != 0 {
+			t.Errorf("Expected empty history for another device, got %+v", other)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		res, _ := http.Get(ts.URL + "/marge/accounts/" + account + "/devices/DEV1/presets")
+		res.Body.Close()
+		etag := res.Header.Get("ETag")
+
+		res, err := http.Post(ts.URL+"/setup/preset-history/"+account+"/"+history[0].ID+"/restore?previous=true", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", res.Status)
+		}
+
+		// The speaker gets the restored preset with its next presets request
+		req, _ := http.NewRequest("GET", ts.URL+"/marge/accounts/"+account+"/devices/DEV1/presets", nil)
+		req.Header.Set("If-None-Match", etag)
+		res, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "<name>Favourite</name>") {
+			t.Errorf("Expected restored preset in marge response, got %v: %s", res.Status, body)
+		}
+	})
+
+	t.Run("Restore errors", func(t *testing.T) {
+		res, _ := http.Post(ts.URL+"/setup/preset-history/"+account+"/99/restore", "application/json", nil)
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for unknown version, got %v", res.Status)
+		}
+
+		res, _ = http.Post(ts.URL+"/setup/preset-history/"+account+"/"+history[1].ID+"/restore?previous=true", "application/json", nil)
+		res.Body.Close()
+		if res.StatusCode != http.StatusConflict {
+			t.Errorf("Expected 409 restoring an empty button, got %v", res.Status)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// hostPrefixes are the paths soundcork serves the Bose hosts under. It has an
+// entry for each of resolver.BoseHosts; the empty prefix serves a host at the
+// root.
+var hostPrefixes = map[string]string{
+	"streaming.bose.com":    "/marge", // marge API
+	"content.api.bose.io":   "",       // /bmx
+	"events.api.bosecm.com": "",       // /streaming/stats
+	"worldwide.bose.com":    "/marge", // /updates/soundtouch
+}
+
+// routeBoseHosts serves requests addressed to a Bose host, e.g. resolved to
+// soundcork by the DNS override, like requests to the migrated URLs. A path is
+// only prefixed if the result is routed, so requests to the root routes keep
+// working on every host.
+func routeBoseHosts(mux *chi.Mux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			prefix := hostPrefixes[strings.ToLower(host)]
+			if prefix != "" && !strings.HasPrefix(r.URL.Path, prefix+"/") &&
+				mux.Match(chi.NewRouteContext(), r.Method, prefix+r.URL.Path) {
+				r.URL.Path = prefix + r.URL.Path
+				r.URL.RawPath = ""
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/resolver"
+)
+
+func TestRouteBoseHosts(t *testing.T) {
+	r, _ := setupRouter("http://localhost:8001", datastore.NewMemoryStore())
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"http://streaming.bose.com/streaming/sourceproviders", http.StatusOK},
+		{"https://STREAMING.bose.com:443/streaming/sourceproviders", http.StatusOK},
+		{"http://streaming.bose.com/marge/streaming/sourceproviders", http.StatusOK},
+		{"http://content.api.bose.io/bmx/registry/v1/services", http.StatusOK},
+		{"http://worldwide.bose.com/updates/soundtouch", http.StatusOK},
+		// Neither other hosts nor unrouted paths are rewritten, they go to the proxy
+		{"http://soundcork.local/streaming/sourceproviders", http.StatusAccepted},
+		{"http://streaming.bose.com/unknown", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if rr.Code != tt.status {
+			t.Errorf("Expected status %v for %s, got %v", tt.status, tt.url, rr.Code)
+		}
+	}
+}
+
+func TestHostPrefixes_CoverOverriddenHosts(t *testing.T) {
+	for _, host := range resolver.BoseHosts {
+		if _, ok := hostPrefixes[host]; !ok {
+			t.Errorf("No route for overridden host %s", host)
+		}
+	}
+	if len(hostPrefixes) != len(resolver.BoseHosts) {
+		t.Errorf("Expected a route for each of %v, got %v", resolver.BoseHosts, hostPrefixes)
+	}
+}
@@ -85,13 +85,14 @@ func (s *Server) handleMargeSoftwareUpdate(w http.ResponseWriter, r *http.Reques
 
 func (s *Server) handleMargePresets(w http.ResponseWriter, r *http.Request) {
 	account := chi.URLParam(r, "account")
-	etag := strconv.FormatInt(s.ds.GetETagForPresets(account), 10)
+	device := chi.URLParam(r, "device")
+	etag := strconv.FormatInt(s.ds.GetETagForDevicePresets(account, device), 10)
 	if r.Header.Get("If-None-Match") == etag {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	data, err := marge.PresetsToXML(s.ds, account)
+	data, err := marge.PresetsToXML(s.ds, account, device)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -105,7 +106,7 @@ func (s *Server) handleMargeUpdatePreset(w http.ResponseWriter, r *http.Request)
 	account := chi.URLParam(r, "account")
 	device := chi.URLParam(r, "device")
 
-	etag := strconv.FormatInt(s.ds.GetETagForPresets(account), 10)
+	etag := strconv.FormatInt(s.ds.GetETagForDevicePresets(account, device), 10)
 	w.Header()["ETag"] = []string{etag}
 
 	presetNumberStr := chi.URLParam(r, "presetNumber")
@@ -132,7 +133,7 @@ func (s *Server) handleMargeAddRecent(w http.ResponseWriter, r *http.Request) {
 	account := chi.URLParam(r, "account")
 	device := chi.URLParam(r, "device")
 
-	etag := strconv.FormatInt(s.ds.GetETagForRecents(account), 10)
+	etag := strconv.FormatInt(s.ds.GetETagForDeviceRecents(account, device), 10)
 	w.Header()["ETag"] = []string{etag}
 
 	body, err := io.ReadAll(r.Body)
@@ -183,11 +184,25 @@ func (s *Server) handleMargeProviderSettings(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *Server) handleMargeStreamingToken(w http.ResponseWriter, r *http.Request) {
-	// Simple mock token for offline use.
-	// In a real production environment, this would be a JWT or similar signed token.
-	// Some speakers might expect a specific format; soundcork uses a distinctive prefix
-	// to indicate it's a locally generated token.
-	token := "soundcork-local-token-" + strconv.FormatInt(time.Now().Unix(), 10)
+	device := chi.URLParam(r, "device")
+	account := s.accountForDevice(r, device)
+	token, claims, err := marge.StreamingToken(s.streamingTokenSecret, account, device, s.streamingTokenTTL, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.ds.AddDeviceEvent(device, models.DeviceEvent{
+		Type:     "streaming-token-issued",
+		Time:     time.Now().Format(time.RFC3339),
+		MonoTime: time.Now().UnixNano() / int64(time.Millisecond),
+		Data: map[string]interface{}{
+			"tokenId":   claims.ID,
+			"account":   account,
+			"expiresAt": time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339),
+		},
+	})
+
 	w.Header().Set("Authorization", "Bearer "+token)
 	w.WriteHeader(http.StatusOK)
 }
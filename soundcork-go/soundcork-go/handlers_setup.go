@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/gesellix/bose-soundtouch-api/internal/bmx"
+	"github.com/gesellix/bose-soundtouch-api/internal/setup"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -175,3 +178,72 @@ func (s *Server) handleUpdateProxySettings(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "message": "Proxy settings updated"})
 }
+
+func (s *Server) handleGetBMXServices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.registry.Config())
+}
+
+func (s *Server) handleUpdateBMXServices(w http.ResponseWriter, r *http.Request) {
+	var config bmx.RegistryConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.registry.Update(config); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "message": "BMX services updated"})
+}
+
+func (s *Server) handleListPlaybackPositions(w http.ResponseWriter, r *http.Request) {
+	positions, err := s.ds.GetAllPlaybackPositions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(positions)
+}
+
+func (s *Server) handleDeletePlaybackPosition(w http.ResponseWriter, r *http.Request) {
+	account := chi.URLParam(r, "account")
+	episodeID := chi.URLParam(r, "episodeID")
+	if err := s.ds.RemovePlaybackPosition(account, episodeID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "message": "Playback position removed"})
+}
+
+// handleImportFromSpeaker onboards a speaker by importing its data into its
+// account, or into the account given with ?account=. Errors the caller can
+// fix by choosing an account are 400, all others are blamed on the speaker.
+func (s *Server) handleImportFromSpeaker(w http.ResponseWriter, r *http.Request) {
+	deviceIP := chi.URLParam(r, "deviceIP")
+	account := r.URL.Query().Get("account")
+
+	result, err := s.sm.ImportFromSpeaker(deviceIP, account)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, setup.ErrNoAccount) || errors.Is(err, setup.ErrInvalidAccount) {
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -5,7 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/bmx"
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
 )
 
 func TestProxySettingsAPI(t *testing.T) {
@@ -66,3 +71,100 @@ func TestProxySettingsAPI(t *testing.T) {
 		t.Errorf("GET (after update): Unexpected settings: %+v", settings)
 	}
 }
+
+func TestBMXServicesSetup(t *testing.T) {
+	r, _ := setupRouter("http://localhost:8001", nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/setup/bmx-services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg bmx.RegistryConfig
+	json.NewDecoder(res.Body).Decode(&cfg)
+	res.Body.Close()
+	if len(cfg.Registry.BmxServices) == 0 {
+		t.Fatal("Expected services in registry config")
+	}
+
+	cfg.Disabled = []string{"TUNEIN"}
+	body, _ := json.Marshal(cfg)
+	res, err = http.Post(ts.URL+"/setup/bmx-services", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %v", res.Status)
+	}
+
+	res, _ = http.Get(ts.URL + "/bmx/registry/v1/services")
+	var services models.BmxResponse
+	json.NewDecoder(res.Body).Decode(&services)
+	res.Body.Close()
+	for _, svc := range services.BmxServices {
+		if svc.ID.Name == "TUNEIN" {
+			t.Error("Expected TUNEIN to be hidden after disabling it")
+		}
+	}
+
+	cfg.Disabled = []string{"NOPE"}
+	body, _ = json.Marshal(cfg)
+	res, _ = http.Post(ts.URL+"/setup/bmx-services", "application/json", bytes.NewReader(body))
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid config, got %v", res.Status)
+	}
+}
+
+func TestImportFromSpeaker_Unreachable(t *testing.T) {
+	r, _ := setupRouter("http://localhost:8001", datastore.NewMemoryStore())
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	// Nothing listens on port 1, so the speaker cannot be reached
+	res, err := http.Post(ts.URL+"/setup/import/127.0.0.1:1", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected 502 for unreachable speaker, got %v", res.Status)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&body)
+	if body["ok"] != false || body["message"] == "" {
+		t.Errorf("Unexpected response %v", body)
+	}
+}
+
+func TestImportFromSpeaker_AccountErrors(t *testing.T) {
+	speaker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<info deviceID="08DF1F0BA325"><name>Kitchen</name><margeAccountUUID></margeAccountUUID></info>`))
+	}))
+	defer speaker.Close()
+
+	r, _ := setupRouter("http://localhost:8001", datastore.NewMemoryStore())
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for name, query := range map[string]string{
+		"NoAccount":      "",
+		"InvalidAccount": "?account=.hidden",
+		"ReservedName":   "?account=stats",
+	} {
+		t.Run(name, func(t *testing.T) {
+			addr := strings.TrimPrefix(speaker.URL, "http://")
+			res, err := http.Post(ts.URL+"/setup/import/"+addr+query, "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %v", res.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/spotify"
+	"github.com/go-chi/chi/v5"
+)
+
+// handleSpotifyInit starts connecting a Spotify account to the account given
+// as query parameter and returns the Spotify authorization page to open.
+func (s *Server) handleSpotifyInit(w http.ResponseWriter, r *http.Request) {
+	account := r.URL.Query().Get("account")
+	if account == "" {
+		http.Error(w, "account is required", http.StatusBadRequest)
+		return
+	}
+	if !s.ds.AccountExists(account) {
+		http.Error(w, "account not found", http.StatusNotFound)
+		return
+	}
+
+	authURL, err := s.spotify.AuthURL(account)
+	if errors.Is(err, spotify.ErrNotConfigured) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"url": authURL})
+}
+
+// handleSpotifyConfirm is where Spotify redirects to after the user allowed
+// access. It stores the refresh token as the SPOTIFY source of the account
+// and returns to the management page.
+func (s *Server) handleSpotifyConfirm(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if reason := q.Get("error"); reason != "" {
+		http.Error(w, "Spotify authorization failed: "+reason, http.StatusBadRequest)
+		return
+	}
+
+	account, token, user, err := s.spotify.Confirm(r.Context(), q.Get("state"), q.Get("code"))
+	if errors.Is(err, spotify.ErrUnknownState) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if _, err := spotify.SaveSource(s.ds, account, user, token.RefreshToken); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Connected Spotify user %s to account %s", user.ID, account)
+	http.Redirect(w, r, "/?spotify=connected", http.StatusSeeOther)
+}
+
+// handleSpotifyDeviceToken answers the token refresh of a speaker playing
+// from its SPOTIFY source with an access token from Spotify.
+func (s *Server) handleSpotifyDeviceToken(w http.ResponseWriter, r *http.Request) {
+	if chi.URLParam(r, "provider") != strconv.Itoa(spotify.ProviderID) {
+		http.Error(w, "unsupported music provider", http.StatusNotFound)
+		return
+	}
+	if !s.spotify.Configured() {
+		http.Error(w, spotify.ErrNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var req models.BmxTokenRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		r.ParseForm()
+		req.GrantType = r.PostForm.Get("grant_type")
+		req.RefreshToken = r.PostForm.Get("refresh_token")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid token request", http.StatusBadRequest)
+		return
+	}
+	if req.GrantType != "" && req.GrantType != "refresh_token" {
+		http.Error(w, "unsupported grant_type", http.StatusBadRequest)
+		return
+	}
+
+	// Only a known speaker gets the access token of its own account
+	account, caller, known := s.callerDevice(r)
+	if !known || caller != chi.URLParam(r, "device") {
+		http.Error(w, "unknown device", http.StatusForbidden)
+		return
+	}
+	src, err := spotify.FindSource(s.ds, account, req.RefreshToken)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := s.spotify.Refresh(r.Context(), src.Secret)
+	if err != nil {
+		log.Printf("Spotify token refresh for account %s failed: %v", account, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if token.RefreshToken != "" {
+		user := &spotify.User{ID: src.SourceKeyAccount, DisplayName: src.DisplayName}
+		if _, err := spotify.SaveSource(s.ds, account, user, token.RefreshToken); err != nil {
+			log.Printf("Failed to store new Spotify refresh token for account %s: %v", account, err)
+		}
+		// The speaker gets the new refresh token with its sources from marge
+		token.RefreshToken = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
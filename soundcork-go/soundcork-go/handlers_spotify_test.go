@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/marge"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/gesellix/bose-soundtouch-api/internal/spotify"
+)
+
+// newSpotifyStandIn serves the Spotify endpoints used by the OAuth flow.
+func newSpotifyStandIn(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		token := spotify.Token{TokenType: "Bearer", ExpiresIn: 3600}
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			token.AccessToken = "access-code"
+			token.RefreshToken = "refresh-1"
+		case "refresh_token":
+			token.AccessToken = "access-" + r.Form.Get("refresh_token")
+		}
+		json.NewEncoder(w).Encode(token)
+	})
+	mux.HandleFunc("GET /v1/me", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(spotify.User{ID: "spotify-user", DisplayName: "Jo"})
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSpotifyOAuth(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	ds.Initialize()
+	ds.SaveDeviceInfo("1234567", "DEV1", &models.DeviceInfo{DeviceID: "DEV1", IPAddress: "127.0.0.1"})
+	ds.SaveDeviceInfo("7654321", "DEV3", &models.DeviceInfo{DeviceID: "DEV3", IPAddress: "192.168.1.13"})
+	r, server := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tokenPath := "/oauth/device/DEV1/music/musicprovider/15/token/cs3"
+	res, _ := http.Post(ts.URL+tokenPath, "application/json", strings.NewReader(`{"grant_type":"refresh_token"}`))
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without Spotify credentials, got %v", res.Status)
+	}
+
+	standIn := newSpotifyStandIn(t)
+	server.spotify = spotify.NewClient(spotify.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  ts.URL + "/setup/spotify/confirm",
+		AccountsURL:  standIn.URL,
+		APIURL:       standIn.URL,
+	}, nil)
+
+	t.Run("NoSource", func(t *testing.T) {
+		res, _ := http.Post(ts.URL+tokenPath, "application/json", strings.NewReader(`{}`))
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 without a connected account, got %v", res.Status)
+		}
+	})
+
+	t.Run("Connect", func(t *testing.T) {
+		res, _ := http.Get(ts.URL + "/setup/spotify/init?account=unknown")
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for unknown account, got %v", res.Status)
+		}
+
+		res, err := http.Get(ts.URL + "/setup/spotify/init?account=1234567")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var init struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(res.Body).Decode(&init)
+		res.Body.Close()
+		authURL, err := url.Parse(init.URL)
+		if err != nil || !strings.HasPrefix(init.URL, standIn.URL+"/authorize") {
+			t.Fatalf("Unexpected authorization URL %q", init.URL)
+		}
+
+		// Spotify redirects the browser back with a code
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		res, err = client.Get(ts.URL + "/setup/spotify/confirm?code=abc&state=" + authURL.Query().Get("state"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/?spotify=connected" {
+			t.Fatalf("Expected redirect to the management page, got %v %s", res.Status, res.Header.Get("Location"))
+		}
+
+		sources, _ := ds.GetConfiguredSources("1234567")
+		if len(sources) != 1 || sources[0].SourceKeyType != "SPOTIFY" || sources[0].SourceKeyAccount != "spotify-user" || sources[0].Secret != "refresh-1" {
+			t.Errorf("Unexpected sources %+v", sources)
+		}
+
+		res, _ = client.Get(ts.URL + "/setup/spotify/confirm?code=abc&state=" + authURL.Query().Get("state"))
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a used state, got %v", res.Status)
+		}
+	})
+
+	t.Run("DeviceToken", func(t *testing.T) {
+		res, err := http.Post(ts.URL+tokenPath, "application/json", strings.NewReader(`{"grant_type":"refresh_token","refresh_token":"refresh-1"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var token spotify.Token
+		json.NewDecoder(res.Body).Decode(&token)
+		// The token from connecting the account is still valid
+		if res.StatusCode != http.StatusOK || token.AccessToken != "access-code" || token.ExpiresIn < 3500 || token.RefreshToken != "" {
+			t.Errorf("Unexpected token response %v %+v", res.Status, token)
+		}
+
+		res2, _ := http.Post(ts.URL+"/oauth/device/DEV1/music/musicprovider/14/token/cs3", "application/json", strings.NewReader(`{}`))
+		res2.Body.Close()
+		if res2.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for another provider, got %v", res2.Status)
+		}
+
+		// Neither unknown devices nor other speakers get the token
+		for _, device := range []string{"DEV2", "DEV3"} {
+			res, _ := http.Post(ts.URL+"/oauth/device/"+device+"/music/musicprovider/15/token/cs3", "application/json", strings.NewReader(`{"refresh_token":"refresh-1"}`))
+			res.Body.Close()
+			if res.StatusCode != http.StatusForbidden {
+				t.Errorf("Expected 403 for %s, got %v", device, res.Status)
+			}
+		}
+
+		forged, _, _ := marge.StreamingToken([]byte("guessed"), "1234567", "DEV1", time.Hour, time.Now())
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+tokenPath, strings.NewReader(`{"refresh_token":"refresh-1"}`))
+		req.Header.Set("Authorization", "Bearer "+forged)
+		res3, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res3.Body.Close()
+		if res3.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a forged token, got %v", res3.Status)
+		}
+	})
+}
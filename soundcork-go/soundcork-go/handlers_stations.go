@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func validateStation(station models.Station) error {
+	if station.Name == "" {
+		return fmt.Errorf("station name is required")
+	}
+	if len(station.StreamURLs) == 0 {
+		return fmt.Errorf("at least one stream URL is required")
+	}
+	for _, sURL := range station.StreamURLs {
+		u, err := url.Parse(sURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid stream URL %q", sURL)
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleListStations(w http.ResponseWriter, r *http.Request) {
+	stations, err := s.ds.GetStations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stations)
+}
+
+func (s *Server) handleGetStation(w http.ResponseWriter, r *http.Request) {
+	station, err := s.ds.GetStation(chi.URLParam(r, "stationID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(station)
+}
+
+func (s *Server) handleCreateStation(w http.ResponseWriter, r *http.Request) {
+	var station models.Station
+	if err := json.NewDecoder(r.Body).Decode(&station); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateStation(station); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.ds.AddStation(station)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) handleUpdateStation(w http.ResponseWriter, r *http.Request) {
+	stationID := chi.URLParam(r, "stationID")
+	if _, err := s.ds.GetStation(stationID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var station models.Station
+	if err := json.NewDecoder(r.Body).Decode(&station); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	station.ID = stationID
+	if err := validateStation(station); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ds.UpdateStation(station); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(station)
+}
+
+func (s *Server) handleDeleteStation(w http.ResponseWriter, r *http.Request) {
+	if err := s.ds.DeleteStation(chi.URLParam(r, "stationID")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "message": "Station deleted"})
+}
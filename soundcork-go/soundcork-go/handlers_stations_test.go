@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestStationLibrary(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	r, _ := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	t.Run("Create rejects invalid stations", func(t *testing.T) {
+		body := `{"name": "No Streams", "stream_urls": []}`
+		res, err := http.Post(ts.URL+"/setup/stations", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %v", res.Status)
+		}
+
+		body = `{"name": "Bad URL", "stream_urls": ["ftp://example.com/stream"]}`
+		res, _ = http.Post(ts.URL+"/setup/stations", "application/json", strings.NewReader(body))
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for non-http stream URL, got %v", res.Status)
+		}
+	})
+
+	var created models.Station
+	t.Run("Create", func(t *testing.T) {
+		station := models.Station{
+			Name:       "Rock FM",
+			StreamURLs: []string{"http://rock.example.com/live.mp3"},
+			Logo:       "http://rock.example.com/logo.png",
+			Genre:      "Rock",
+		}
+		body, _ := json.Marshal(station)
+		res, err := http.Post(ts.URL+"/setup/stations", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected 201, got %v", res.Status)
+		}
+		json.NewDecoder(res.Body).Decode(&created)
+		if created.ID == "" || created.Name != "Rock FM" {
+			t.Errorf("Unexpected created station %+v", created)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		body := `{"name": "Rock FM HD", "stream_urls": ["https://rock.example.com/hd.aac"], "genre": "Rock"}`
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/setup/stations/"+created.ID, strings.NewReader(body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", res.Status)
+		}
+
+		req, _ = http.NewRequest(http.MethodPut, ts.URL+"/setup/stations/999", strings.NewReader(body))
+		res, _ = http.DefaultClient.Do(req)
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for unknown station, got %v", res.Status)
+		}
+	})
+
+	t.Run("BMX navigate and playback", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/core02/svc-bmx-adapter-orion/prod/orion/v1/navigate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nav models.BmxNavigateResponse
+		json.NewDecoder(res.Body).Decode(&nav)
+		res.Body.Close()
+		if len(nav.Sections) != 1 || len(nav.Sections[0].Items) != 1 {
+			t.Fatalf("Expected one station in navigation, got %+v", nav.Sections)
+		}
+		href := nav.Sections[0].Items[0].Links.BmxPlayback.Href
+
+		res, err = http.Get(ts.URL + "/bmx/orion" + href)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for playback, got %v", res.Status)
+		}
+		var playback models.BmxPlaybackResponse
+		json.NewDecoder(res.Body).Decode(&playback)
+		if playback.Name != "Rock FM HD" || playback.Audio.StreamUrl != "https://rock.example.com/hd.aac" {
+			t.Errorf("Unexpected playback %+v", playback)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/setup/stations/"+created.ID, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %v", res.Status)
+		}
+
+		res, _ = http.Get(ts.URL + "/bmx/orion/v1/playback/library/" + created.ID)
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 after delete, got %v", res.Status)
+		}
+	})
+}
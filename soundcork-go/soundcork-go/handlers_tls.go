@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleGetCACert serves the certificate of the local CA, e.g. to install it
+// on other clients.
+func (s *Server) handleGetCACert(w http.ResponseWriter, r *http.Request) {
+	if s.ca == nil {
+		http.Error(w, "local CA is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="soundcork-ca.pem"`)
+	w.Write(s.ca.CertPEM)
+}
+
+func (s *Server) handleInstallCA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.ca == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": "Local CA is not enabled"})
+		return
+	}
+
+	deviceIP := chi.URLParam(r, "deviceIP")
+	bundles, err := s.sm.InstallCA(deviceIP, s.ca.CertPEM, s.ca.Fingerprint())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":      true,
+		"message": fmt.Sprintf("CA installed in %s, reboot the speaker to use it", strings.Join(bundles, ", ")),
+		"bundles": bundles,
+	})
+}
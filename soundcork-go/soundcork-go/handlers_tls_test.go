@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/certs"
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+)
+
+func TestLocalCA(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	r, server := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, _ := http.Get(ts.URL + "/setup/tls/ca.pem")
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without local CA, got %v", res.Status)
+	}
+	res, _ = http.Post(ts.URL+"/setup/tls/install-ca/192.168.1.10", "", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 installing without local CA, got %v", res.Status)
+	}
+
+	dir := t.TempDir()
+	ca, err := certs.LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ca = ca
+
+	res, err = http.Get(ts.URL + "/setup/tls/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !bytes.Equal(body, ca.CertPEM) {
+		t.Errorf("Expected the CA certificate, got %v %q", res.Status, body)
+	}
+
+	t.Run("HTTPS", func(t *testing.T) {
+		certFile, keyFile, err := ca.ServerCert(dir, []string{"127.0.0.1"}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pair, _ := tls.LoadX509KeyPair(certFile, keyFile)
+		tlsServer := httptest.NewUnstartedServer(r)
+		tlsServer.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+		tlsServer.StartTLS()
+		defer tlsServer.Close()
+
+		// A client trusting only the local CA, like a speaker it was installed on
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(body)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		res, err := client.Get(tlsServer.URL + "/marge/streaming/sourceproviders")
+		if err != nil {
+			t.Fatalf("HTTPS request failed: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected status OK, got %v", res.Status)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/jwt"
+	"github.com/gesellix/bose-soundtouch-api/internal/marge"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	// errTokenBinding is returned for streaming tokens presented for another
+	// account or device than they were issued for.
+	errTokenBinding = errors.New("token was issued for another account or device")
+	// errTokenIssuer is returned for JWTs not issued by soundcork.
+	errTokenIssuer = errors.New("token was not issued by soundcork")
+)
+
+// verifyToken checks the tokens speakers present on marge and BMX calls and
+// records which device used which token. JWTs must have been issued by
+// soundcork and be valid. Opaque tokens, e.g. from the Bose cloud before the
+// migration, cannot be verified and are let through. Requests without a token
+// are not affected.
+//
+// It has to run after routing (chi's Group or With) to see the account and
+// device of the path.
+func (s *Server) verifyToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := bearerToken(r)
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		caller := chi.URLParam(r, "device")
+		if caller == "" {
+			caller = s.deviceIDForRequest(r)
+		}
+		use := marge.TokenUse{Caller: caller, Path: r.URL.Path}
+		sum := sha256.Sum256([]byte(raw))
+		use.TokenID = "sha256:" + hex.EncodeToString(sum[:8])
+
+		// A JWT has three dot-separated parts, legacy tokens are opaque
+		if strings.Count(raw, ".") != 2 {
+			use.Status = marge.TokenUnverified
+			s.tokenAudit.Record(use)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := jwt.Peek(raw)
+		if err != nil {
+			claims = &jwt.Claims{}
+		} else if claims.Issuer != jwt.Issuer {
+			err = errTokenIssuer
+		} else {
+			secret := s.bmxTokenSecret
+			if claims.Audience == marge.StreamingTokenAudience {
+				secret = s.streamingTokenSecret
+			}
+			if _, err = jwt.Verify(secret, raw, time.Now()); err == nil {
+				err = checkTokenBinding(r, claims)
+			}
+		}
+
+		if claims.ID != "" {
+			use.TokenID = claims.ID
+		}
+		use.Account = claims.Account
+		use.Device = claims.Device
+		if use.Device == "" {
+			use.Device = claims.Subject
+		}
+		if claims.ExpiresAt != 0 {
+			use.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+		}
+		if err == nil {
+			use.Status = marge.TokenValid
+			s.tokenAudit.Record(use)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		use.Status = marge.TokenRejected
+		use.Reason = err.Error()
+		s.tokenAudit.Record(use)
+		log.Printf("Rejected token %s from device %s for %s: %v", use.TokenID, caller, r.URL.Path, err)
+		if s.ds != nil {
+			s.ds.AddDeviceEvent(caller, models.DeviceEvent{
+				Type:     "token-rejected",
+				Time:     time.Now().Format(time.RFC3339),
+				MonoTime: time.Now().UnixNano() / int64(time.Millisecond),
+				Data: map[string]interface{}{
+					"tokenId": use.TokenID,
+					"path":    r.URL.Path,
+					"reason":  err.Error(),
+				},
+			})
+		}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	})
+}
+
+// checkTokenBinding compares the account and device of a streaming token
+// with those in the request path.
+func checkTokenBinding(r *http.Request, claims *jwt.Claims) error {
+	if claims.Audience != marge.StreamingTokenAudience {
+		return nil
+	}
+	if account := chi.URLParam(r, "account"); account != "" && account != claims.Account {
+		return errTokenBinding
+	}
+	if device := chi.URLParam(r, "device"); device != "" && device != claims.Device {
+		return errTokenBinding
+	}
+	return nil
+}
+
+// bearerToken returns the token of the Authorization header. Speakers do not
+// always use the Bearer scheme.
+func bearerToken(r *http.Request) string {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return auth
+}
+
+func (s *Server) handleListTokenUses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.tokenAudit.List())
+}
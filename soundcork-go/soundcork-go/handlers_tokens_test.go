@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/jwt"
+	"github.com/gesellix/bose-soundtouch-api/internal/marge"
+	"github.com/gesellix/bose-soundtouch-api/internal/models"
+)
+
+func TestStreamingTokens(t *testing.T) {
+	ds := datastore.NewMemoryStore()
+	ds.Initialize()
+	ds.SaveDeviceInfo("1234567", "DEV1", &models.DeviceInfo{DeviceID: "DEV1", IPAddress: "127.0.0.1"})
+	r, server := setupRouter("http://localhost:8001", ds)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	get := func(path, token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	res, err := http.Get(ts.URL + "/marge/streaming/device/DEV1/streaming_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	token := strings.TrimPrefix(res.Header.Get("Authorization"), "Bearer ")
+	claims, err := jwt.Verify(server.streamingTokenSecret, token, time.Now())
+	if err != nil {
+		t.Fatalf("Expected a valid streaming token, got %q (%v)", token, err)
+	}
+	if claims.Account != "1234567" || claims.Device != "DEV1" || claims.Audience != marge.StreamingTokenAudience {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	if events := ds.GetDeviceEvents("DEV1"); len(events) != 1 || events[0].Type != "streaming-token-issued" {
+		t.Errorf("Expected the token to be recorded as issued, got %+v", events)
+	}
+
+	settings := "/marge/streaming/account/1234567/provider_settings"
+	expired, _, _ := marge.StreamingToken(server.streamingTokenSecret, "1234567", "DEV1", time.Hour, time.Now().Add(-2*time.Hour))
+	forged, _, _ := marge.StreamingToken([]byte("guessed"), "1234567", "DEV1", time.Hour, time.Now())
+	foreign, _ := jwt.Sign([]byte("guessed"), jwt.Claims{Issuer: "bose", Account: "1234567", Device: "DEV1"})
+	for _, tc := range []struct {
+		name, path, token string
+		status            int
+	}{
+		{"Valid", settings, token, http.StatusOK},
+		{"NoToken", settings, "", http.StatusOK},
+		{"NotIssuedBySoundcork", settings, "soundcork-local-token-1700000000", http.StatusOK},
+		{"OtherDevice", "/marge/accounts/1234567/devices/DEV2/presets", token, http.StatusUnauthorized},
+		{"OtherAccount", "/marge/streaming/account/7654321/provider_settings", token, http.StatusUnauthorized},
+		{"Expired", settings, expired, http.StatusUnauthorized},
+		{"Forged", settings, forged, http.StatusUnauthorized},
+		{"OtherIssuer", settings, foreign, http.StatusUnauthorized},
+		{"MalformedJWT", settings, "eyJhbGciOiJub25lIn0.e30.", http.StatusUnauthorized},
+		{"ForgedOnOrion", "/core02/svc-bmx-adapter-orion/prod/orion/v1/navigate", forged, http.StatusUnauthorized},
+		{"ExpiredCanBeRenewed", "/marge/streaming/device/DEV1/streaming_token", expired, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status := get(tc.path, tc.token); status != tc.status {
+				t.Errorf("Expected %d, got %d", tc.status, status)
+			}
+		})
+	}
+
+	t.Run("BMXAccessToken", func(t *testing.T) {
+		res, err := http.Post(ts.URL+"/bmx/tunein/v1/token", "application/json", strings.NewReader(`{"grant_type":"refresh_token","refresh_token":"x"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp models.BmxTokenResponse
+		json.NewDecoder(res.Body).Decode(&resp)
+		res.Body.Close()
+		if status := get("/bmx/registry/v1/services", resp.AccessToken); status != http.StatusOK {
+			t.Errorf("Expected the BMX access token to be accepted, got %d", status)
+		}
+		if status := get("/bmx/registry/v1/services", forged); status != http.StatusUnauthorized {
+			t.Errorf("Expected a forged token to be rejected, got %d", status)
+		}
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/setup/tokens")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var uses []marge.TokenUse
+		json.NewDecoder(res.Body).Decode(&uses)
+
+		statuses := map[string]int{}
+		for _, u := range uses {
+			statuses[u.Status]++
+			if u.TokenID == claims.ID && u.Status == marge.TokenValid && (u.Caller != "DEV1" || u.Account != "1234567") {
+				t.Errorf("Unexpected audit entry %+v", u)
+			}
+		}
+		if statuses[marge.TokenValid] != 2 || statuses[marge.TokenUnverified] != 1 || statuses[marge.TokenRejected] != 6 {
+			t.Errorf("Unexpected audit %+v", uses)
+		}
+
+		rejected := 0
+		for _, e := range ds.GetDeviceEvents("DEV2") {
+			if e.Type == "token-rejected" {
+				rejected++
+			}
+		}
+		if rejected != 1 {
+			t.Errorf("Expected the rejection to be recorded for DEV2, got %d", rejected)
+		}
+	})
+}
@@ -3,31 +3,54 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gesellix/bose-soundtouch-api/internal/auth"
+	"github.com/gesellix/bose-soundtouch-api/internal/bmx"
+	"github.com/gesellix/bose-soundtouch-api/internal/certs"
+	"github.com/gesellix/bose-soundtouch-api/internal/constants"
 	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/jwt"
+	"github.com/gesellix/bose-soundtouch-api/internal/marge"
 	"github.com/gesellix/bose-soundtouch-api/internal/models"
 	"github.com/gesellix/bose-soundtouch-api/internal/proxy"
+	"github.com/gesellix/bose-soundtouch-api/internal/resolver"
+	"github.com/gesellix/bose-soundtouch-api/internal/secrets"
 	"github.com/gesellix/bose-soundtouch-api/internal/setup"
+	"github.com/gesellix/bose-soundtouch-api/internal/spotify"
 	"github.com/gesellix/bose-soundtouch/pkg/discovery"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 type Server struct {
-	ds           *datastore.DataStore
+	ds           datastore.Store
 	sm           *setup.Manager
 	serverURL    string
 	proxyURL     string
 	discovering  bool
 	proxyRedact  bool
 	proxyLogBody bool
+
+	tuneIn         *bmx.Client
+	registry       *bmx.Registry
+	bmxTokenSecret []byte
+	spotify        *spotify.Client
+
+	streamingTokenSecret []byte
+	streamingTokenTTL    time.Duration
+	tokenAudit           marge.TokenAudit
+
+	auth *auth.Manager
+	ca   *certs.CA
 }
 
 func (s *Server) discoverDevices() {
@@ -183,12 +206,43 @@ func main() {
 	if dataDir == "" {
 		dataDir = "data"
 	}
-	ds := datastore.NewDataStore(dataDir)
+	var ds datastore.Store
+	switch backend := os.Getenv("DATA_BACKEND"); backend {
+	case "", "xml":
+		ds = datastore.NewDataStore(dataDir)
+	case "sqlite":
+		dbPath := os.Getenv("SQLITE_PATH")
+		if dbPath == "" {
+			dbPath = filepath.Join(dataDir, "soundcork.db")
+		}
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			log.Fatalf("Failed to create directory for %s: %v", dbPath, err)
+		}
+		db, err := datastore.NewSQLiteStore(dbPath)
+		if err != nil {
+			log.Fatalf("Failed to open SQLite datastore: %v", err)
+		}
+		ds = db
+		log.Printf("Using SQLite datastore at %s", dbPath)
+	default:
+		log.Fatalf("Unknown DATA_BACKEND %q (expected xml or sqlite)", backend)
+	}
+	secretBox, err := secrets.LoadBox(os.Getenv("SOURCE_SECRET_KEY"), os.Getenv("SOURCE_SECRET_KEY_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load source secret key: %v", err)
+	}
+	if secretBox != nil {
+		ds.SetSecretBox(secretBox)
+		log.Printf("Encrypting source secrets with key %s", secretBox.KeyID())
+	}
 	if err := ds.Initialize(); err != nil {
 		log.Printf("Warning: Failed to initialize datastore: %v", err)
 	}
 
 	serverURL := os.Getenv("SERVER_URL")
+	if serverURL == "" {
+		serverURL = os.Getenv("BASE_URL")
+	}
 	if serverURL == "" {
 		// Try to guess the server URL
 		hostname, _ := os.Hostname()
@@ -200,6 +254,144 @@ func main() {
 
 	sm := setup.NewManager(serverURL, ds)
 
+	bmxTokenSecret := []byte(os.Getenv("BMX_TOKEN_SECRET"))
+	if len(bmxTokenSecret) == 0 {
+		// Without a configured secret, a generated one is kept in the data
+		// directory, so tokens held by the speakers survive a restart.
+		secretPath := filepath.Join(dataDir, "token_secret")
+		bmxTokenSecret, err = jwt.LoadOrCreateSecret(secretPath)
+		if err != nil {
+			log.Fatalf("Failed to load BMX token secret: %v", err)
+		}
+		log.Printf("BMX_TOKEN_SECRET not set, using the secret in %s", secretPath)
+	}
+
+	// Streaming tokens are signed with the BMX secret unless they have one of their own
+	streamingTokenSecret := []byte(os.Getenv("STREAMING_TOKEN_SECRET"))
+	if len(streamingTokenSecret) == 0 {
+		streamingTokenSecret = bmxTokenSecret
+	}
+	streamingTokenTTL, err := time.ParseDuration(os.Getenv("STREAMING_TOKEN_TTL"))
+	if err != nil || streamingTokenTTL <= 0 {
+		streamingTokenTTL = marge.DefaultStreamingTokenTTL
+	}
+
+	// TUNEIN_BASE_URL allows pointing at a mirror or a local stand-in (e.g. in air-gapped setups)
+	tuneIn := bmx.NewClient(os.Getenv("TUNEIN_BASE_URL"), nil)
+	log.Printf("Using TuneIn upstream: %s", tuneIn.BaseURL)
+
+	if os.Getenv("TUNEIN_CACHE") != "false" {
+		cacheTTL, _ := time.ParseDuration(os.Getenv("TUNEIN_CACHE_TTL"))
+		cacheSize, _ := strconv.Atoi(os.Getenv("TUNEIN_CACHE_SIZE"))
+		tuneIn.Cache = bmx.NewCache(cacheTTL, cacheSize)
+		if os.Getenv("TUNEIN_CACHE_PERSIST") == "true" {
+			cachePath := filepath.Join(dataDir, constants.CacheDir, "tunein.json")
+			if err := tuneIn.Cache.Persist(cachePath); err != nil {
+				log.Printf("Warning: Failed to load TuneIn cache from %s: %v", cachePath, err)
+			}
+		}
+	}
+
+	// STREAM_PROBE_TIMEOUT (e.g. 2s) enables probing candidate streams before playback
+	if probeTimeout, err := time.ParseDuration(os.Getenv("STREAM_PROBE_TIMEOUT")); err == nil && probeTimeout > 0 {
+		tuneIn.ProbeTimeout = probeTimeout
+		tuneIn.Recorder = ds
+		log.Printf("Probing streams with timeout %s", probeTimeout)
+	}
+
+	registryPath := filepath.Join(dataDir, "bmx_services.json")
+	registry, err := bmx.NewRegistry(registryPath)
+	if err != nil {
+		if registry == nil {
+			log.Fatalf("Failed to load BMX services: %v", err)
+		}
+		log.Printf("Warning: Ignoring BMX service overrides: %v", err)
+	}
+
+	// SPOTIFY_CLIENT_ID/SECRET are the credentials of a Spotify app with the
+	// confirm endpoint of the setup API registered as redirect URI.
+	spotifyRedirectURL := os.Getenv("SPOTIFY_REDIRECT_URL")
+	if spotifyRedirectURL == "" {
+		spotifyRedirectURL = serverURL + "/setup/spotify/confirm"
+	}
+	spotifyClient := spotify.NewClient(spotify.Config{
+		ClientID:     os.Getenv("SPOTIFY_CLIENT_ID"),
+		ClientSecret: os.Getenv("SPOTIFY_CLIENT_SECRET"),
+		RedirectURL:  spotifyRedirectURL,
+		AccountsURL:  os.Getenv("SPOTIFY_ACCOUNTS_URL"),
+		APIURL:       os.Getenv("SPOTIFY_API_URL"),
+	}, nil)
+
+	// Without SETUP_ADMIN_PASSWORD or SETUP_ADMIN_TOKEN, the management API stays open
+	authManager, err := auth.NewManager(auth.Config{
+		AdminPassword:    os.Getenv("SETUP_ADMIN_PASSWORD"),
+		ReadOnlyPassword: os.Getenv("SETUP_READONLY_PASSWORD"),
+		AdminToken:       os.Getenv("SETUP_ADMIN_TOKEN"),
+	}, filepath.Join(dataDir, "api_tokens.json"))
+	if err != nil {
+		log.Fatalf("Failed to load API tokens: %v", err)
+	}
+	if !authManager.Enabled() {
+		log.Printf("Warning: SETUP_ADMIN_PASSWORD not set, the /setup API is open to everyone on the network")
+	}
+
+	// DNS override: answer the Bose hostnames with the address of soundcork
+	var dnsServer *resolver.Server
+	if os.Getenv("DNS_OVERRIDE") == "true" {
+		overrideIP := os.Getenv("DNS_OVERRIDE_IP")
+		if overrideIP == "" {
+			if u, err := url.Parse(serverURL); err == nil {
+				overrideIP = u.Hostname()
+			}
+		}
+		ip := net.ParseIP(overrideIP)
+		if ip == nil {
+			log.Fatalf("DNS_OVERRIDE needs the IP address of soundcork in DNS_OVERRIDE_IP or SERVER_URL, got %q", overrideIP)
+		}
+		upstream := os.Getenv("DNS_UPSTREAM")
+		if upstream == "" {
+			upstream, err = resolver.SystemUpstream("/etc/resolv.conf")
+			if err != nil {
+				log.Fatalf("Failed to find a DNS upstream, set DNS_UPSTREAM: %v", err)
+			}
+		} else if _, _, err := net.SplitHostPort(upstream); err != nil {
+			upstream = net.JoinHostPort(upstream, "53")
+		}
+		dnsServer = resolver.NewServer(ip, upstream)
+	}
+
+	// HTTPS with TLS_CERT_FILE/TLS_KEY_FILE, or with a certificate from a local CA
+	tlsCertFile, tlsKeyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	var ca *certs.CA
+	if tlsCertFile == "" && os.Getenv("TLS_LOCAL_CA") == "true" {
+		tlsDir := filepath.Join(dataDir, constants.TLSDir)
+		ca, err = certs.LoadOrCreateCA(tlsDir)
+		if err != nil {
+			log.Fatalf("Failed to load local CA: %v", err)
+		}
+		var extraHosts []string
+		if v := os.Getenv("TLS_HOSTS"); v != "" {
+			extraHosts = strings.Split(v, ",")
+		}
+		if dnsServer != nil {
+			extraHosts = append(extraHosts, resolver.BoseHosts...)
+		}
+		serverHost := ""
+		if u, err := url.Parse(serverURL); err == nil {
+			serverHost = u.Host
+		}
+		hosts := certs.Hosts(serverHost, extraHosts)
+		tlsCertFile, tlsKeyFile, err = ca.ServerCert(tlsDir, hosts, time.Now())
+		if err != nil {
+			log.Fatalf("Failed to issue server certificate: %v", err)
+		}
+		log.Printf("Serving HTTPS for %v with a certificate from the local CA %s", hosts, ca.Fingerprint())
+	}
+	tlsPort := os.Getenv("TLS_PORT")
+	if tlsPort == "" {
+		tlsPort = "8443"
+	}
+
 	redact := os.Getenv("REDACT_PROXY_LOGS") != "false"
 	logBody := os.Getenv("LOG_PROXY_BODY") == "true"
 
@@ -209,6 +401,17 @@ func main() {
 		serverURL:    serverURL,
 		proxyRedact:  redact,
 		proxyLogBody: logBody,
+
+		tuneIn:         tuneIn,
+		bmxTokenSecret: bmxTokenSecret,
+		registry:       registry,
+		spotify:        spotifyClient,
+
+		streamingTokenSecret: streamingTokenSecret,
+		streamingTokenTTL:    streamingTokenTTL,
+
+		auth: authManager,
+		ca:   ca,
 	}
 
 	pyProxy := httputil.NewSingleHostReverseProxy(target)
@@ -253,6 +456,8 @@ func main() {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(routeBoseHosts(r))
+	r.Use(server.identifyCaller)
 
 	mediaDir := os.Getenv("MEDIA_DIR")
 	if mediaDir == "" {
@@ -289,29 +494,60 @@ func main() {
 
 	// Phase 3: BMX endpoints
 	r.Route("/bmx", func(r chi.Router) {
-		r.Get("/registry/v1/services", server.handleBMXRegistry)
-		r.Get("/tunein/v1/playback/station/{stationID}", server.handleTuneInPlayback)
-		r.Get("/tunein/v1/playback/episodes/{podcastID}", server.handleTuneInPodcastInfo)
-		r.Get("/tunein/v1/playback/episode/{podcastID}", server.handleTuneInPlaybackPodcast)
-		r.Post("/orion/v1/playback/station/{data}", server.handleOrionPlayback)
+		// Refreshing a token must work with an expired one
+		r.Post("/tunein/v1/token", server.handleTuneInToken)
+		r.Group(func(r chi.Router) {
+			r.Use(server.verifyToken)
+			r.Get("/registry/v1/services", server.handleBMXRegistry)
+			r.Get("/tunein/v1/playback/station/{stationID}", server.handleTuneInPlayback)
+			r.Get("/tunein/v1/now-playing/station/{stationID}", server.handleTuneInNowPlaying)
+			r.Get("/tunein/v1/favorites", server.handleTuneInFavorites)
+			r.Post("/tunein/v1/favorite/{favoriteID}", server.handleTuneInAddFavorite)
+			r.Put("/tunein/v1/favorite/{favoriteID}", server.handleTuneInAddFavorite)
+			r.Delete("/tunein/v1/favorite/{favoriteID}", server.handleTuneInRemoveFavorite)
+			r.Get("/tunein/v1/playback/episodes/{podcastID}", server.handleTuneInPodcastInfo)
+			r.Get("/tunein/v1/playback/episode/{podcastID}", server.handleTuneInPlaybackPodcast)
+			r.Post("/tunein/v1/report", server.handleTuneInReport)
+			r.Post("/orion/v1/playback/station/{data}", server.handleOrionPlayback)
+			r.Get("/orion/v1/navigate", server.handleLibraryNavigate)
+			r.Get("/orion/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+			r.Post("/orion/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+		})
+	})
+
+	// Local station library under the LOCAL_INTERNET_RADIO base URL from the BMX registry
+	r.Route("/core02/svc-bmx-adapter-orion/prod/orion", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(server.verifyToken)
+			r.Get("/v1/navigate", server.handleLibraryNavigate)
+			r.Get("/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+			r.Post("/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+		})
 	})
 
 	// Phase 4: Marge endpoints
 	r.Route("/marge", func(r chi.Router) {
-		r.Get("/streaming/sourceproviders", server.handleMargeSourceProviders)
-		r.Get("/accounts/{account}/full", server.handleMargeAccountFull)
-		r.Post("/streaming/support/power_on", server.handleMargePowerOn)
-		r.Get("/updates/soundtouch", server.handleMargeSoftwareUpdate)
-		r.Get("/accounts/{account}/devices/{device}/presets", server.handleMargePresets)
-		r.Post("/accounts/{account}/devices/{device}/presets/{presetNumber}", server.handleMargeUpdatePreset)
-		r.Post("/accounts/{account}/devices/{device}/recents", server.handleMargeAddRecent)
-		r.Post("/accounts/{account}/devices", server.handleMargeAddDevice)
-		r.Delete("/accounts/{account}/devices/{device}", server.handleMargeRemoveDevice)
-		r.Get("/streaming/account/{account}/provider_settings", server.handleMargeProviderSettings)
+		// Requesting a new streaming token must work with an expired one
 		r.Get("/streaming/device/{device}/streaming_token", server.handleMargeStreamingToken)
-		r.Post("/streaming/support/customersupport", server.handleMargeCustomerSupport)
+		r.Group(func(r chi.Router) {
+			r.Use(server.verifyToken)
+			r.Get("/streaming/sourceproviders", server.handleMargeSourceProviders)
+			r.Get("/accounts/{account}/full", server.handleMargeAccountFull)
+			r.Post("/streaming/support/power_on", server.handleMargePowerOn)
+			r.Get("/updates/soundtouch", server.handleMargeSoftwareUpdate)
+			r.Get("/accounts/{account}/devices/{device}/presets", server.handleMargePresets)
+			r.Post("/accounts/{account}/devices/{device}/presets/{presetNumber}", server.handleMargeUpdatePreset)
+			r.Post("/accounts/{account}/devices/{device}/recents", server.handleMargeAddRecent)
+			r.Post("/accounts/{account}/devices", server.handleMargeAddDevice)
+			r.Delete("/accounts/{account}/devices/{device}", server.handleMargeRemoveDevice)
+			r.Get("/streaming/account/{account}/provider_settings", server.handleMargeProviderSettings)
+			r.Post("/streaming/support/customersupport", server.handleMargeCustomerSupport)
+		})
 	})
 
+	// Spotify token refresh of speakers playing from their SPOTIFY source
+	r.With(server.verifyToken).Post("/oauth/device/{device}/music/musicprovider/{provider}/token/{tokenType}", server.handleSpotifyDeviceToken)
+
 	// Phase 10: Stats endpoints
 	r.Route("/streaming/stats", func(r chi.Router) {
 		r.Post("/usage", server.handleUsageStats)
@@ -323,18 +559,52 @@ func main() {
 
 	// Phase 7: Setup and Discovery endpoints
 	r.Route("/setup", func(r chi.Router) {
-		r.Get("/devices", server.handleListDiscoveredDevices)
-		r.Post("/discover", server.handleTriggerDiscovery)
-		r.Get("/discovery-status", server.handleGetDiscoveryStatus)
-		r.Get("/settings", server.handleGetSettings)
-		r.Get("/info/{deviceIP}", server.handleGetDeviceInfo)
-		r.Get("/summary/{deviceIP}", server.handleGetMigrationSummary)
-		r.Post("/migrate/{deviceIP}", server.handleMigrateDevice)
-		r.Post("/ensure-remote-services/{deviceIP}", server.handleEnsureRemoteServices)
-		r.Post("/backup/{deviceIP}", server.handleBackupConfig)
-		r.Get("/proxy-settings", server.handleGetProxySettings)
-		r.Post("/proxy-settings", server.handleUpdateProxySettings)
-		r.Get("/devices/{deviceId}/events", server.handleGetDeviceEvents)
+		r.Get("/auth", server.handleAuthStatus)
+		r.Post("/login", server.handleLogin)
+		r.Post("/logout", server.handleLogout)
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireSetupAuth)
+			r.Get("/devices", server.handleListDiscoveredDevices)
+			r.Post("/discover", server.handleTriggerDiscovery)
+			r.Get("/discovery-status", server.handleGetDiscoveryStatus)
+			r.Get("/settings", server.handleGetSettings)
+			r.Get("/info/{deviceIP}", server.handleGetDeviceInfo)
+			r.Get("/summary/{deviceIP}", server.handleGetMigrationSummary)
+			r.Post("/migrate/{deviceIP}", server.handleMigrateDevice)
+			r.Post("/ensure-remote-services/{deviceIP}", server.handleEnsureRemoteServices)
+			r.Post("/backup/{deviceIP}", server.handleBackupConfig)
+			r.Get("/export", server.handleExport)
+			r.Post("/import", server.handleImport)
+			r.Post("/import/{deviceIP}", server.handleImportFromSpeaker)
+			r.Get("/proxy-settings", server.handleGetProxySettings)
+			r.Post("/proxy-settings", server.handleUpdateProxySettings)
+			r.Get("/devices/{deviceId}/events", server.handleGetDeviceEvents)
+			r.Get("/stations", server.handleListStations)
+			r.Post("/stations", server.handleCreateStation)
+			r.Get("/stations/{stationID}", server.handleGetStation)
+			r.Put("/stations/{stationID}", server.handleUpdateStation)
+			r.Delete("/stations/{stationID}", server.handleDeleteStation)
+			r.Get("/bmx-services", server.handleGetBMXServices)
+			r.Post("/bmx-services", server.handleUpdateBMXServices)
+			r.Get("/playback-positions", server.handleListPlaybackPositions)
+			r.Delete("/playback-positions/{account}/{episodeID}", server.handleDeletePlaybackPosition)
+			r.Get("/preset-history/{account}", server.handleListPresetHistory)
+			r.Get("/preset-history/{account}/{device}", server.handleListPresetHistory)
+			r.Post("/preset-history/{account}/{versionID}/restore", server.handleRestorePresetVersion)
+			r.Get("/accounts", server.handleListAccounts)
+			r.Post("/accounts", server.handleCreateAccount)
+			r.Get("/accounts/{account}", server.handleGetAccount)
+			r.Put("/accounts/{account}", server.handleRenameAccount)
+			r.Delete("/accounts/{account}", server.handleDeleteAccount)
+			r.Get("/spotify/init", server.handleSpotifyInit)
+			r.Get("/spotify/confirm", server.handleSpotifyConfirm)
+			r.Get("/tokens", server.handleListTokenUses)
+			r.Get("/api-tokens", server.handleListAPITokens)
+			r.Post("/api-tokens", server.handleCreateAPIToken)
+			r.Delete("/api-tokens/{tokenID}", server.handleDeleteAPIToken)
+			r.Get("/tls/ca.pem", server.handleGetCACert)
+			r.Post("/tls/install-ca/{deviceIP}", server.handleInstallCA)
+		})
 	})
 
 	// Delegation Logic: Proxy everything else to Python
@@ -342,6 +612,26 @@ func main() {
 		pyProxy.ServeHTTP(w, r)
 	})
 
+	if dnsServer != nil {
+		dnsPort := os.Getenv("DNS_PORT")
+		if dnsPort == "" {
+			dnsPort = "53"
+		}
+		dnsAddr := bindAddr + ":" + dnsPort
+		go func() {
+			log.Printf("DNS listening on %s, answering %v with %s and forwarding to %s", dnsAddr, dnsServer.Hosts, dnsServer.IP, dnsServer.Upstream)
+			log.Fatal(dnsServer.ListenAndServe(dnsAddr))
+		}()
+	}
+
+	if tlsCertFile != "" {
+		tlsAddr := bindAddr + ":" + tlsPort
+		go func() {
+			log.Printf("HTTPS listening on %s", tlsAddr)
+			log.Fatal(http.ListenAndServeTLS(tlsAddr, tlsCertFile, tlsKeyFile, r))
+		}()
+	}
+
 	log.Printf("Go service starting on %s, proxying to %s", addr, targetURL)
 	log.Fatal(http.ListenAndServe(addr, r))
 }
@@ -3,17 +3,36 @@ package main
 import (
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/gesellix/bose-soundtouch-api/internal/auth"
+	"github.com/gesellix/bose-soundtouch-api/internal/bmx"
 	"github.com/gesellix/bose-soundtouch-api/internal/datastore"
+	"github.com/gesellix/bose-soundtouch-api/internal/setup"
+	"github.com/gesellix/bose-soundtouch-api/internal/spotify"
 	"github.com/go-chi/chi/v5"
 )
 
-func setupRouter(targetURL string, ds *datastore.DataStore) (*chi.Mux, *Server) {
+func setupRouter(targetURL string, ds datastore.Store) (*chi.Mux, *Server) {
 	target, _ := url.Parse(targetURL)
 	proxy := &reverseProxy{target: target}
-	server := &Server{ds: ds}
+	server := &Server{
+		ds:             ds,
+		tuneIn:         bmx.NewClient(bmx.DefaultTuneInBaseURL, nil),
+		bmxTokenSecret: []byte("test-secret"),
+		serverURL:      "http://localhost:8000",
+		sm:             setup.NewManager("http://localhost:8000", ds),
+		spotify:        spotify.NewClient(spotify.Config{}, nil),
+
+		streamingTokenSecret: []byte("test-streaming-secret"),
+		streamingTokenTTL:    time.Hour,
+	}
+	server.auth, _ = auth.NewManager(auth.Config{}, "")
+	server.registry, _ = bmx.NewRegistry("")
 
 	r := chi.NewRouter()
+	r.Use(routeBoseHosts(r))
+	r.Use(server.identifyCaller)
 	r.Get("/", server.handleRoot)
 
 	// Setup media directory for tests
@@ -22,33 +41,97 @@ func setupRouter(targetURL string, ds *datastore.DataStore) (*chi.Mux, *Server)
 
 	// Setup BMX for tests
 	r.Route("/bmx", func(r chi.Router) {
-		r.Get("/registry/v1/services", server.handleBMXRegistry)
-		r.Get("/tunein/v1/playback/station/{stationID}", server.handleTuneInPlayback)
-		r.Get("/tunein/v1/playback/episodes/{podcastID}", server.handleTuneInPodcastInfo)
-		r.Get("/tunein/v1/playback/episode/{podcastID}", server.handleTuneInPlaybackPodcast)
-		r.Post("/orion/v1/playback/station/{data}", server.handleOrionPlayback)
+		// Refreshing a token must work with an expired one
+		r.Post("/tunein/v1/token", server.handleTuneInToken)
+		r.Group(func(r chi.Router) {
+			r.Use(server.verifyToken)
+			r.Get("/registry/v1/services", server.handleBMXRegistry)
+			r.Get("/tunein/v1/playback/station/{stationID}", server.handleTuneInPlayback)
+			r.Get("/tunein/v1/now-playing/station/{stationID}", server.handleTuneInNowPlaying)
+			r.Get("/tunein/v1/favorites", server.handleTuneInFavorites)
+			r.Post("/tunein/v1/favorite/{favoriteID}", server.handleTuneInAddFavorite)
+			r.Put("/tunein/v1/favorite/{favoriteID}", server.handleTuneInAddFavorite)
+			r.Delete("/tunein/v1/favorite/{favoriteID}", server.handleTuneInRemoveFavorite)
+			r.Get("/tunein/v1/playback/episodes/{podcastID}", server.handleTuneInPodcastInfo)
+			r.Get("/tunein/v1/playback/episode/{podcastID}", server.handleTuneInPlaybackPodcast)
+			r.Post("/tunein/v1/report", server.handleTuneInReport)
+			r.Post("/orion/v1/playback/station/{data}", server.handleOrionPlayback)
+			r.Get("/orion/v1/navigate", server.handleLibraryNavigate)
+			r.Get("/orion/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+			r.Post("/orion/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+		})
+	})
+
+	// Local station library under the LOCAL_INTERNET_RADIO base URL from the BMX registry
+	r.Route("/core02/svc-bmx-adapter-orion/prod/orion", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(server.verifyToken)
+			r.Get("/v1/navigate", server.handleLibraryNavigate)
+			r.Get("/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+			r.Post("/v1/playback/library/{stationID}", server.handleLibraryPlayback)
+		})
 	})
 
 	// Setup Marge for tests
 	r.Route("/marge", func(r chi.Router) {
-		r.Get("/streaming/sourceproviders", server.handleMargeSourceProviders)
-		r.Get("/accounts/{account}/full", server.handleMargeAccountFull)
-		r.Post("/streaming/support/power_on", server.handleMargePowerOn)
-		r.Get("/updates/soundtouch", server.handleMargeSoftwareUpdate)
-		r.Get("/accounts/{account}/devices/{device}/presets", server.handleMargePresets)
-		r.Post("/accounts/{account}/devices/{device}/presets/{presetNumber}", server.handleMargeUpdatePreset)
-		r.Post("/accounts/{account}/devices/{device}/recents", server.handleMargeAddRecent)
-		r.Post("/accounts/{account}/devices", server.handleMargeAddDevice)
-		r.Delete("/accounts/{account}/devices/{device}", server.handleMargeRemoveDevice)
-		r.Get("/streaming/account/{account}/provider_settings", server.handleMargeProviderSettings)
+		// Requesting a new streaming token must work with an expired one
 		r.Get("/streaming/device/{device}/streaming_token", server.handleMargeStreamingToken)
-		r.Post("/streaming/support/customersupport", server.handleMargeCustomerSupport)
+		r.Group(func(r chi.Router) {
+			r.Use(server.verifyToken)
+			r.Get("/streaming/sourceproviders", server.handleMargeSourceProviders)
+			r.Get("/accounts/{account}/full", server.handleMargeAccountFull)
+			r.Post("/streaming/support/power_on", server.handleMargePowerOn)
+			r.Get("/updates/soundtouch", server.handleMargeSoftwareUpdate)
+			r.Get("/accounts/{account}/devices/{device}/presets", server.handleMargePresets)
+			r.Post("/accounts/{account}/devices/{device}/presets/{presetNumber}", server.handleMargeUpdatePreset)
+			r.Post("/accounts/{account}/devices/{device}/recents", server.handleMargeAddRecent)
+			r.Post("/accounts/{account}/devices", server.handleMargeAddDevice)
+			r.Delete("/accounts/{account}/devices/{device}", server.handleMargeRemoveDevice)
+			r.Get("/streaming/account/{account}/provider_settings", server.handleMargeProviderSettings)
+			r.Post("/streaming/support/customersupport", server.handleMargeCustomerSupport)
+		})
 	})
 
+	r.With(server.verifyToken).Post("/oauth/device/{device}/music/musicprovider/{provider}/token/{tokenType}", server.handleSpotifyDeviceToken)
+
 	// Setup Setup for tests
 	r.Route("/setup", func(r chi.Router) {
-		r.Get("/proxy-settings", server.handleGetProxySettings)
-		r.Post("/proxy-settings", server.handleUpdateProxySettings)
+		r.Get("/auth", server.handleAuthStatus)
+		r.Post("/login", server.handleLogin)
+		r.Post("/logout", server.handleLogout)
+		r.Group(func(r chi.Router) {
+			r.Use(server.requireSetupAuth)
+			r.Get("/proxy-settings", server.handleGetProxySettings)
+			r.Post("/proxy-settings", server.handleUpdateProxySettings)
+			r.Get("/stations", server.handleListStations)
+			r.Post("/stations", server.handleCreateStation)
+			r.Get("/stations/{stationID}", server.handleGetStation)
+			r.Put("/stations/{stationID}", server.handleUpdateStation)
+			r.Delete("/stations/{stationID}", server.handleDeleteStation)
+			r.Get("/bmx-services", server.handleGetBMXServices)
+			r.Post("/bmx-services", server.handleUpdateBMXServices)
+			r.Get("/playback-positions", server.handleListPlaybackPositions)
+			r.Delete("/playback-positions/{account}/{episodeID}", server.handleDeletePlaybackPosition)
+			r.Get("/preset-history/{account}", server.handleListPresetHistory)
+			r.Get("/preset-history/{account}/{device}", server.handleListPresetHistory)
+			r.Post("/preset-history/{account}/{versionID}/restore", server.handleRestorePresetVersion)
+			r.Get("/accounts", server.handleListAccounts)
+			r.Post("/accounts", server.handleCreateAccount)
+			r.Get("/accounts/{account}", server.handleGetAccount)
+			r.Put("/accounts/{account}", server.handleRenameAccount)
+			r.Delete("/accounts/{account}", server.handleDeleteAccount)
+			r.Get("/spotify/init", server.handleSpotifyInit)
+			r.Get("/spotify/confirm", server.handleSpotifyConfirm)
+			r.Get("/tokens", server.handleListTokenUses)
+			r.Get("/export", server.handleExport)
+			r.Post("/import", server.handleImport)
+			r.Post("/import/{deviceIP}", server.handleImportFromSpeaker)
+			r.Get("/api-tokens", server.handleListAPITokens)
+			r.Post("/api-tokens", server.handleCreateAPIToken)
+			r.Delete("/api-tokens/{tokenID}", server.handleDeleteAPIToken)
+			r.Get("/tls/ca.pem", server.handleGetCACert)
+			r.Post("/tls/install-ca/{deviceIP}", server.handleInstallCA)
+		})
 	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {